@@ -0,0 +1,140 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"nx-scaffolder/internal/utils"
+
+	"github.com/spf13/cobra"
+)
+
+var cacheCmd = &cobra.Command{
+	Use:   "cache",
+	Short: "Inspect and maintain the local template cache",
+	Long:  "Manages the directory where downloaded template archives are cached by owner, repository and commit",
+}
+
+var cacheListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List cached template archives",
+	Args:  cobra.NoArgs,
+	RunE:  runCacheList,
+}
+
+var cachePruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "Remove cached template archives that have not been used recently",
+	Args:  cobra.NoArgs,
+	RunE:  runCachePrune,
+}
+
+var cacheVerifyCmd = &cobra.Command{
+	Use:   "verify",
+	Short: "Check cached template archives against their recorded checksums",
+	Args:  cobra.NoArgs,
+	RunE:  runCacheVerify,
+}
+
+var (
+	cacheCmdDir    string
+	pruneOlderThan time.Duration
+	pruneAll       bool
+	verifyRemove   bool
+)
+
+func init() {
+	rootCmd.AddCommand(cacheCmd)
+	cacheCmd.AddCommand(cacheListCmd, cachePruneCmd, cacheVerifyCmd)
+
+	cacheCmd.PersistentFlags().StringVar(&cacheCmdDir, "cache-dir", "", "Template cache directory (default: $NX_SCAFFOLDER_CACHE_DIR or the user cache dir)")
+	cachePruneCmd.Flags().DurationVar(&pruneOlderThan, "older-than", 30*24*time.Hour, "Remove entries not used within this duration")
+	cachePruneCmd.Flags().BoolVar(&pruneAll, "all", false, "Remove every cached entry")
+	cacheVerifyCmd.Flags().BoolVar(&verifyRemove, "remove", false, "Remove entries that fail verification")
+}
+
+func runCacheList(cmd *cobra.Command, args []string) error {
+	cache, err := utils.OpenTemplateCache(cacheCmdDir)
+	if err != nil {
+		return err
+	}
+
+	entries, err := cache.List()
+	if err != nil {
+		return fmt.Errorf("failed to list cache: %w", err)
+	}
+	if len(entries) == 0 {
+		fmt.Printf("Template cache at %s is empty\n", cache.Dir)
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "REPOSITORY\tREF\tCOMMIT\tSIZE\tLAST USED")
+	for _, entry := range entries {
+		fmt.Fprintf(w, "%s/%s/%s\t%s\t%.12s\t%s\t%s\n",
+			entry.Host, entry.Owner, entry.Repo, entry.Ref, entry.Commit,
+			utils.FormatBytes(entry.Size), entry.LastUsed.Local().Format(time.DateTime))
+	}
+	return w.Flush()
+}
+
+func runCachePrune(cmd *cobra.Command, args []string) error {
+	cache, err := utils.OpenTemplateCache(cacheCmdDir)
+	if err != nil {
+		return err
+	}
+
+	maxAge := pruneOlderThan
+	if pruneAll {
+		maxAge = 0
+	}
+
+	removed, err := cache.Prune(maxAge)
+	if err != nil {
+		return fmt.Errorf("failed to prune cache: %w", err)
+	}
+
+	var freed int64
+	for _, entry := range removed {
+		fmt.Printf("Removed %s/%s@%.12s\n", entry.Owner, entry.Repo, entry.Commit)
+		freed += entry.Size
+	}
+	fmt.Printf("✅ Pruned %d entries (%s)\n", len(removed), utils.FormatBytes(freed))
+	return nil
+}
+
+func runCacheVerify(cmd *cobra.Command, args []string) error {
+	cache, err := utils.OpenTemplateCache(cacheCmdDir)
+	if err != nil {
+		return err
+	}
+
+	results, err := cache.Verify()
+	if err != nil {
+		return fmt.Errorf("failed to verify cache: %w", err)
+	}
+
+	failed := 0
+	for _, result := range results {
+		entry := result.Entry
+		if result.Err == nil {
+			fmt.Printf("✅ %s/%s@%.12s\n", entry.Owner, entry.Repo, entry.Commit)
+			continue
+		}
+
+		failed++
+		fmt.Printf("❌ %s/%s@%.12s: %v\n", entry.Owner, entry.Repo, entry.Commit, result.Err)
+		if verifyRemove {
+			if err := cache.Remove(entry); err != nil {
+				return fmt.Errorf("failed to remove corrupt entry: %w", err)
+			}
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d cache entries failed verification", failed, len(results))
+	}
+	return nil
+}
@@ -2,10 +2,13 @@ package cmd
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"os"
+	"os/signal"
 	"path/filepath"
-	"regexp"
-	"strconv"
 	"strings"
 
 	"nx-scaffolder/internal/utils"
@@ -16,38 +19,151 @@ import (
 var createCmd = &cobra.Command{
 	Use:   "create [workspace-name]",
 	Short: "Create a new Nx React monorepo workspace",
-	Long:  "Creates an Nx monorepo and configures multiple React applications from existing repos or new apps",
-	Args:  cobra.ExactArgs(1),
-	RunE:  runCreate,
+	Long: `Creates an Nx monorepo and configures multiple React applications from existing repos or new apps.
+
+The workspace can also be described in a YAML or JSON spec file given with
+--spec, listing the template, apps and imports. Flags given on the command
+line override the spec.`,
+	Args: cobra.RangeArgs(0, 1),
+	RunE: runCreate,
 }
 
 var (
 	owner    string
 	repo     string
 	branch   string
+	ref      string
 	template string
 	inject   string
 	output   string // Add this variable
+
+	templatePath   string
+	templateSubdir string
+	includeGlobs   []string
+	excludeGlobs   []string
+
+	cacheDir string
+	offline  bool
+	refresh  bool
+
+	providerName string
+	providerURL  string
+
+	templateSHA256 string
+	setValues      []string
+
+	specPath string
+
+	onConflict  string
+	jobs        int
+	keepPartial bool
+	dryRun      bool
+	planJSON    bool
+
+	dryRunDownload  bool
+	preserveHistory bool
+
+	runPostSteps bool
 )
 
 func init() {
 	rootCmd.AddCommand(createCmd)
 
-	createCmd.Flags().StringVarP(&owner, "owner", "", "nrwl", "GitHub repository owner")
-	createCmd.Flags().StringVarP(&repo, "repo", "r", "nx", "GitHub repository name")
+	createCmd.Flags().StringVarP(&owner, "owner", "", "nrwl", "Repository owner (GitLab groups may contain slashes)")
+	createCmd.Flags().StringVarP(&repo, "repo", "r", "nx", "Repository name")
 	createCmd.Flags().StringVarP(&branch, "branch", "b", "master", "Git branch to download")
+	createCmd.Flags().StringVar(&ref, "ref", "", "Branch, tag or commit SHA of the template to download (default: --branch)")
+	createCmd.Flags().MarkDeprecated("branch", "use --ref instead")
 	createCmd.Flags().StringVarP(&template, "template", "t", "react", "Template type (react, angular, etc.)")
-	createCmd.Flags().StringVarP(&inject, "inject", "i", "", "Pipe-delimited list of repos to inject or {create-new} expressions")
+	createCmd.Flags().StringVarP(&inject, "inject", "i", "", "Pipe-delimited list of git URLs, local directories or archives to import, {create-new}, {create-new:a,b} and {create-new*N:prefix} expressions, or {create-lib:name} and lib:source libraries")
 	createCmd.Flags().StringVarP(&output, "output", "o", ".", "Output directory for the workspace") // Fix this line
+	createCmd.Flags().StringVar(&templatePath, "template-path", "", "Use a local template directory or .zip/.tar.gz archive instead of GitHub")
+	createCmd.Flags().StringVar(&templateSubdir, "template-subdir", "", "Only use this directory of the template repository (e.g. examples/react-vite)")
+	createCmd.Flags().StringSliceVar(&includeGlobs, "include", nil, "Glob patterns of template files to include (repeatable)")
+	createCmd.Flags().StringSliceVar(&excludeGlobs, "exclude", nil, "Glob patterns of template files to exclude (repeatable)")
+	createCmd.Flags().StringVar(&providerName, "provider", "github", "Git hosting provider of the template (github, gitlab or gitea)")
+	createCmd.Flags().StringVar(&providerURL, "provider-url", "", "Base URL of a self-managed GitLab or Gitea instance (default: $GITLAB_URL/$GITEA_URL)")
+	createCmd.Flags().StringVar(&templateSHA256, "template-sha256", "", "Expected SHA-256 checksum of the template ZIP archive, verified before extraction")
+	createCmd.Flags().StringArrayVar(&setValues, "set", nil, "Set a template variable as key=value (repeatable)")
+	createCmd.Flags().StringVar(&cacheDir, "cache-dir", "", "Template cache directory (default: $NX_SCAFFOLDER_CACHE_DIR or the user cache dir)")
+	createCmd.Flags().BoolVar(&offline, "offline", false, "Build only from templates already in the cache")
+	createCmd.Flags().BoolVar(&refresh, "refresh", false, "Download the template again even if it is cached")
+	createCmd.Flags().StringVar(&specPath, "spec", "", "YAML or JSON workspace spec describing the template, apps and imports")
+	createCmd.Flags().StringVar(&onConflict, "on-conflict", utils.ConflictFail, "What to do when project names conflict: fail, or suffix to rename them to name-2, name-3, ...")
+	createCmd.Flags().IntVarP(&jobs, "jobs", "j", 4, "Number of injection instructions to process at the same time")
+	createCmd.Flags().BoolVar(&keepPartial, "keep-partial", false, "Keep the partial workspace of a failed create for debugging")
+	createCmd.Flags().BoolVar(&dryRun, "dry-run", false, "Build the workspace in a temporary directory and print the files it would write, without writing them")
+	createCmd.Flags().BoolVar(&planJSON, "json", false, "Print the --dry-run plan as JSON")
+	createCmd.Flags().BoolVar(&dryRunDownload, "dry-run-download", false, "Let --dry-run download a template that is not cached, without caching it")
+	createCmd.Flags().BoolVar(&preserveHistory, "preserve-history", false, "Make the workspace a git repository and merge in the full history of imported repositories")
+	createCmd.Flags().BoolVar(&runPostSteps, "run-post-steps", false, "Run the post-generation steps of the template manifest, which are shell commands from the template")
+	createCmd.MarkFlagsMutuallyExclusive("offline", "refresh")
+	createCmd.MarkFlagsMutuallyExclusive("spec", "inject")
 }
 
 func runCreate(cmd *cobra.Command, args []string) error {
-	workspaceName := args[0]
+	// An interrupt cancels the create, which then cleans up after itself
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	var spec *utils.WorkspaceSpec
+	if specPath != "" {
+		var err error
+		spec, err = utils.LoadWorkspaceSpec(specPath)
+		if err != nil {
+			return err
+		}
+		applySpecTemplate(cmd, spec.Template)
+	}
+
+	var workspaceName string
+	switch {
+	case len(args) == 1:
+		workspaceName = args[0]
+	case spec != nil && spec.Name != "":
+		workspaceName = spec.Name
+	default:
+		return fmt.Errorf("a workspace name is required, either as an argument or as name in the --spec file")
+	}
+	if onConflict != utils.ConflictFail && onConflict != utils.ConflictSuffix {
+		return fmt.Errorf("invalid --on-conflict %q: expected %s or %s", onConflict, utils.ConflictFail, utils.ConflictSuffix)
+	}
+	if jobs < 1 {
+		return fmt.Errorf("invalid --jobs %d: expected at least 1", jobs)
+	}
+	if planJSON && !dryRun {
+		return fmt.Errorf("--json requires --dry-run")
+	}
+	if dryRunDownload && !dryRun {
+		return fmt.Errorf("--dry-run-download requires --dry-run")
+	}
+	if dryRun && refresh && !dryRunDownload {
+		return fmt.Errorf("--refresh with --dry-run requires --dry-run-download")
+	}
+	var progress io.Writer = os.Stdout
+	if planJSON {
+		progress = os.Stderr // So stdout only carries the plan
+	}
+
+	// Parse injection instructions and check their names before any work starts
+	var instructions []utils.InjectionInstruction
+	var err error
+	if inject != "" {
+		instructions, err = utils.ParseInjectInstructions(inject)
+		if err != nil {
+			return fmt.Errorf("failed to parse inject instructions: %w", err)
+		}
+	} else if spec != nil {
+		instructions = spec.Instructions()
+	}
+	instructions, err = resolveNameConflicts(progress, "", instructions)
+	if err != nil {
+		return err
+	}
+
 	// Use the output variable directly instead of cmd.Flags().GetString("output")
 	outputDir := output
 
-	ctx := context.Background()
-
 	var destPath string
 	if filepath.IsAbs(workspaceName) {
 		// If workspace name is an absolute path, use it directly
@@ -64,105 +180,441 @@ func runCreate(cmd *cobra.Command, args []string) error {
 	}
 	destPath = absDestPath
 
-	fmt.Printf("Creating Nx React monorepo at '%s'...\n", destPath)
+	if dryRun {
+		return runDryRun(ctx, progress, os.Stdout, destPath, spec, instructions)
+	}
+
+	fmt.Fprintf(progress, "Creating Nx React monorepo at '%s'...\n", destPath)
+
+	// Build the workspace next to destPath and move it into place only once
+	// every step has succeeded
+	staged, err := utils.StageWorkspace(destPath)
+	if err != nil {
+		return err
+	}
+	steps := &createSteps{out: progress}
+	err = buildWorkspace(ctx, progress, steps, staged, spec, instructions, nil)
+	if err == nil {
+		steps.start("moving the workspace into place")
+		err = staged.Commit()
+	}
+	if err != nil {
+		steps.reportFailure(staged, keepPartial)
+		return err
+	}
+
+	fmt.Fprintf(progress, "✅ Successfully created Nx React monorepo at '%s'\n", destPath)
+	return nil
+}
+
+// runDryRun builds the workspace in a temporary directory and prints the
+// files it would write to destPath on planOut, with progress on out. Nothing
+// is written outside the temporary directory: the template comes from the
+// cache unless --dry-run-download is given, and new apps and git imports,
+// which need the network, are listed but not built.
+func runDryRun(ctx context.Context, out, planOut io.Writer, destPath string, spec *utils.WorkspaceSpec, instructions []utils.InjectionInstruction) error {
+	fmt.Fprintf(out, "Planning Nx React monorepo at '%s' (dry run)...\n", destPath)
+
+	staged, err := utils.StageDryRun(destPath)
+	if err != nil {
+		return err
+	}
+
+	plan := &utils.WorkspacePlan{Destination: destPath}
+	steps := &createSteps{out: out}
+	err = buildWorkspace(ctx, out, steps, staged, spec, instructions, plan)
+	if err == nil {
+		steps.start("comparing the workspace with the template")
+		err = plan.Compare(staged.Path)
+	}
+	if err != nil {
+		steps.reportFailure(staged, keepPartial)
+		return err
+	}
+	staged.Discard()
+
+	if planJSON {
+		encoder := json.NewEncoder(planOut)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(plan)
+	}
+	printPlan(planOut, plan)
+	return nil
+}
+
+// printPlan prints a dry run plan: the projects, every file that is not
+// copied from the template as is, and the diffs of modified JSON files.
+func printPlan(out io.Writer, plan *utils.WorkspacePlan) {
+	fmt.Fprintf(out, "\nPlan for '%s':\n", plan.Destination)
+	if plan.Template.Commit != "" {
+		fmt.Fprintf(out, "  Template: %s/%s at %s\n", plan.Template.Owner, plan.Template.Repo, plan.Template.Commit)
+	} else if plan.Template.Path != "" {
+		fmt.Fprintf(out, "  Template: %s\n", plan.Template.Path)
+	}
+	for _, project := range plan.Projects {
+		source := project.Source
+		if source == "" {
+			source = project.Type
+		}
+		note := ""
+		if project.Skipped {
+			note = ", skipped: needs the network, so its files are not listed"
+		}
+		fmt.Fprintf(out, "  Project:  %s (%s%s)\n", project.Path, source, note)
+	}
+
+	fmt.Fprintf(out, "\nFiles (+ added, ~ modified, - deleted, relative to the template):\n")
+	markers := map[string]string{utils.FileAdded: "+", utils.FileModified: "~", utils.FileDeleted: "-"}
+	for _, file := range plan.Files {
+		marker, ok := markers[file.Action]
+		if !ok {
+			continue
+		}
+		note := ""
+		if file.Replaces {
+			note = " (already exists at the destination, which makes create fail)"
+		}
+		fmt.Fprintf(out, "  %s %s%s\n", marker, file.Path, note)
+	}
+	fmt.Fprintf(out, "  %d added, %d modified, %d deleted; %d template files copied as is\n",
+		plan.Count(utils.FileAdded), plan.Count(utils.FileModified), plan.Count(utils.FileDeleted), plan.Count(utils.FileTemplate))
+
+	for _, file := range plan.Files {
+		if file.Diff != "" {
+			fmt.Fprintf(out, "\n%s", file.Diff)
+		}
+	}
+
+	if runPostSteps {
+		printPostSteps(out, "Post-generation steps that would run", plan.PostSteps)
+	} else {
+		printPostSteps(out, "Post-generation steps that would be skipped (run them with --run-post-steps)", plan.PostSteps)
+	}
+	fmt.Fprintf(out, "\nDry run: nothing was written to '%s'\n", plan.Destination)
+}
+
+// printPostSteps lists the commands of post-generation steps under title.
+func printPostSteps(out io.Writer, title string, steps []string) {
+	if len(steps) == 0 {
+		return
+	}
+	fmt.Fprintf(out, "\n%s:\n", title)
+	for _, step := range steps {
+		fmt.Fprintf(out, "  %s\n", step)
+	}
+}
+
+// createSteps records the steps of a create for the failure summary.
+type createSteps struct {
+	out     io.Writer
+	done    []string
+	current string
+}
+
+// start marks the current step as done and begins the next one.
+func (s *createSteps) start(step string) {
+	if s.current != "" {
+		s.done = append(s.done, s.current)
+	}
+	s.current = step
+}
+
+// reportFailure prints which step failed and removes the staged workspace,
+// unless keep is set.
+func (s *createSteps) reportFailure(staged *utils.StagedWorkspace, keep bool) {
+	fmt.Fprintf(s.out, "❌ Create failed while %s\n", s.current)
+	if len(s.done) > 0 {
+		fmt.Fprintf(s.out, "   Completed steps: %s\n", strings.Join(s.done, ", "))
+	}
+	if keep {
+		fmt.Fprintf(s.out, "   Partial workspace kept at %s\n", staged.Path)
+		return
+	}
+	if err := staged.Discard(); err != nil {
+		fmt.Fprintf(s.out, "Warning: failed to remove partial workspace %s: %v\n", staged.Path, err)
+		return
+	}
+	fmt.Fprintf(s.out, "   Nothing was written to %s (use --keep-partial to inspect the partial workspace)\n", staged.Dest)
+}
+
+// buildWorkspace runs every step of a create in the staged workspace. Its
+// name is that of the destination, which the staging directory does not
+// carry. With a plan, the template is recorded in it and post-generation
+// steps are listed instead of run.
+func buildWorkspace(ctx context.Context, out io.Writer, steps *createSteps, staged *utils.StagedWorkspace, spec *utils.WorkspaceSpec, instructions []utils.InjectionInstruction, plan *utils.WorkspacePlan) error {
+	workPath, name := staged.Path, filepath.Base(staged.Dest)
 
 	// Create base Nx workspace
-	fmt.Printf("Downloading base template from %s/%s (branch: %s)\n", owner, repo, branch)
-	err = utils.FetchNxTemplate(ctx, owner, repo, branch, destPath)
+	steps.start("fetching the base template")
+	source, err := newTemplateSource(ctx, out)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(out, "Fetching base template from %s\n", source.Describe())
+	if templateSubdir != "" {
+		fmt.Fprintf(out, "Using template subdirectory: %s\n", templateSubdir)
+	}
+	extractOpts := utils.ExtractOptions{
+		Subdir:  templateSubdir,
+		Include: includeGlobs,
+		Exclude: excludeGlobs,
+	}
+	templateInfo, err := source.Fetch(ctx, workPath, extractOpts)
+	if _, remote := source.(*utils.RemoteSource); err != nil && remote && dryRun && !dryRunDownload {
+		return fmt.Errorf("failed to download base template: %w (a dry run only uses cached templates unless given --dry-run-download)", err)
+	}
 	if err != nil {
 		return fmt.Errorf("failed to download base template: %w", err)
 	}
+	if templateInfo.Commit != "" {
+		fmt.Fprintf(out, "Resolved template %s to commit %s\n", templateInfo.Ref, templateInfo.Commit)
+	}
+	if plan != nil {
+		plan.Template = templateInfo
+		err = plan.SnapshotTemplate(workPath)
+		if err != nil {
+			return fmt.Errorf("failed to record the template files: %w", err)
+		}
+	}
 
-	// Configure base workspace
-	err = utils.ConfigureMonorepo(destPath, filepath.Base(destPath))
+	steps.start("applying the template manifest")
+	given, err := parseSetValues(setValues)
 	if err != nil {
-		return fmt.Errorf("failed to configure base workspace: %w", err)
+		return err
+	}
+	if spec != nil {
+		for key, value := range spec.Template.Variables {
+			if _, ok := given[key]; !ok {
+				given[key] = value
+			}
+		}
 	}
 
-	// Process injection instructions
-	if inject != "" {
-		instructions, err := parseInjectInstructions(inject)
+	manifest, err := utils.LoadManifest(workPath)
+	if err != nil {
+		return err
+	}
+	if manifest != nil {
+		fmt.Fprintf(out, "Applying template manifest %s\n", utils.ManifestFile)
+		templateInfo.Variables, err = resolveTemplateVariables(out, manifest, given, name)
 		if err != nil {
-			return fmt.Errorf("failed to parse inject instructions: %w", err)
+			return err
+		}
+		err = manifest.ApplyFileRules(workPath)
+		if err != nil {
+			return fmt.Errorf("failed to apply template manifest: %w", err)
+		}
+		err = manifest.RenderFiles(workPath, templateInfo.Variables)
+		if err != nil {
+			return fmt.Errorf("failed to render template: %w", err)
+		}
+	} else if len(given) > 0 {
+		// Without a manifest every given value is a variable
+		templateInfo.Variables = given
+		if _, ok := given["workspaceName"]; !ok {
+			templateInfo.Variables["workspaceName"] = name
+		}
+		err = utils.RenderTemplate(workPath, templateInfo.Variables, utils.RenderSettings{})
+		if err != nil {
+			return fmt.Errorf("failed to render template: %w", err)
 		}
+	}
 
-		err = utils.ProcessInjectionInstructions(ctx, destPath, instructions)
+	// Configure base workspace
+	steps.start("configuring the workspace")
+	if manifest == nil || !manifest.SkipDefaultConfig {
+		err = utils.ConfigureMonorepo(out, workPath, name)
+		if err != nil {
+			return fmt.Errorf("failed to configure base workspace: %w", err)
+		}
+	}
+
+	if manifest != nil {
+		err = manifest.ApplyPatches(workPath, templateInfo.Variables)
+		if err != nil {
+			return fmt.Errorf("failed to apply template manifest: %w", err)
+		}
+	}
+
+	// Record the exact template commit so the workspace can be reproduced
+	err = utils.WriteTemplateInfo(workPath, templateInfo)
+	if err != nil {
+		return fmt.Errorf("failed to record template information: %w", err)
+	}
+
+	// Process injection instructions, once their names are known not to
+	// clash with the template or with projects already at the destination
+	steps.start("processing injection instructions")
+	instructions, err = resolveNameConflicts(out, workPath, instructions, staged.Dest)
+	if err != nil {
+		return err
+	}
+	if plan != nil {
+		plan.AddInstructions(instructions)
+	}
+	if len(instructions) > 0 {
+		err = utils.ProcessInjectionInstructions(ctx, workPath, instructions, utils.InjectionOptions{Jobs: jobs, PreserveHistory: preserveHistory && plan == nil, Output: out, SkipExternal: plan != nil})
 		if err != nil {
 			return fmt.Errorf("failed to process injection instructions: %w", err)
 		}
 	}
 
-	fmt.Printf("✅ Successfully created Nx React monorepo at '%s'\n", destPath)
+	if manifest != nil && plan != nil {
+		for _, step := range manifest.PostSteps {
+			plan.PostSteps = append(plan.PostSteps, step.Run)
+		}
+	} else if manifest != nil && len(manifest.PostSteps) > 0 && !runPostSteps {
+		// Post steps are arbitrary shell commands from the template
+		var skipped []string
+		for _, step := range manifest.PostSteps {
+			skipped = append(skipped, step.Run)
+		}
+		printPostSteps(out, "Skipped post-generation steps (run them with --run-post-steps)", skipped)
+	} else if manifest != nil && len(manifest.PostSteps) > 0 {
+		steps.start("running post-generation steps")
+		fmt.Fprintf(out, "Running %d post-generation steps...\n", len(manifest.PostSteps))
+		err = manifest.RunPostSteps(ctx, out, workPath, templateInfo.Variables)
+		if err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
-// parseInjectInstructions parses the inject string and returns a list of instructions
-func parseInjectInstructions(injectStr string) ([]utils.InjectionInstruction, error) {
-	parts := strings.Split(injectStr, "|")
-	var instructions []utils.InjectionInstruction
+// resolveNameConflicts applies the --on-conflict policy to the project
+// names of instructions. An empty workspacePath only checks the
+// instructions against each other.
+func resolveNameConflicts(out io.Writer, workspacePath string, instructions []utils.InjectionInstruction, existingDirs ...string) ([]utils.InjectionInstruction, error) {
+	resolved, err := utils.ResolveNameConflicts(out, workspacePath, instructions, onConflict, existingDirs...)
+	var conflictErr *utils.NameConflictError
+	if errors.As(err, &conflictErr) && onConflict == utils.ConflictFail && conflictErr.Renamable() {
+		return nil, fmt.Errorf("%w\nrename the projects or use --on-conflict=suffix to rename them automatically", err)
+	}
+	return resolved, err
+}
 
-	createNewRegex := regexp.MustCompile(`^{create-new([+*])(\d+)}$`)
-
-	for i, part := range parts {
-		part = strings.TrimSpace(part)
-
-		if part == "{create-new}" {
-			instructions = append(instructions, utils.InjectionInstruction{
-				Type:    "create-new",
-				AppName: fmt.Sprintf("app-%d", len(instructions)+1),
-			})
-		} else if matches := createNewRegex.FindStringSubmatch(part); matches != nil {
-			operator := matches[1]
-			count, err := strconv.Atoi(matches[2])
-			if err != nil {
-				return nil, fmt.Errorf("invalid number in expression %s: %w", part, err)
-			}
+// applySpecTemplate uses the template settings of a workspace spec for
+// every template flag that was not given on the command line.
+func applySpecTemplate(cmd *cobra.Command, t utils.SpecTemplate) {
+	flags := cmd.Flags()
+	setString := func(name string, target *string, value string) {
+		if value != "" && !flags.Changed(name) {
+			*target = value
+		}
+	}
+	setString("provider", &providerName, t.Provider)
+	setString("provider-url", &providerURL, t.ProviderURL)
+	setString("owner", &owner, t.Owner)
+	setString("repo", &repo, t.Repo)
+	setString("ref", &ref, t.Ref)
+	setString("template-path", &templatePath, t.Path)
+	setString("template-subdir", &templateSubdir, t.Subdir)
+	setString("template-sha256", &templateSHA256, t.SHA256)
+	if len(t.Include) > 0 && !flags.Changed("include") {
+		includeGlobs = t.Include
+	}
+	if len(t.Exclude) > 0 && !flags.Changed("exclude") {
+		excludeGlobs = t.Exclude
+	}
+}
 
-			var numApps int
-			switch operator {
-			case "+":
-				numApps = count + 1 // +5 means create 6 apps total
-			case "*":
-				numApps = count // *3 means create 3 apps
-			default:
-				return nil, fmt.Errorf("unsupported operator %s in expression %s", operator, part)
-			}
+// newTemplateSource picks the template source from the create flags: a
+// --template-path wins over the --provider/--owner/--repo/--ref remote.
+func newTemplateSource(ctx context.Context, out io.Writer) (utils.TemplateSource, error) {
+	if templatePath != "" {
+		source, err := utils.NewLocalTemplateSource(templatePath)
+		if err != nil || templateSHA256 == "" {
+			return source, err
+		}
+		archive, ok := source.(*utils.ArchiveFileSource)
+		if !ok {
+			return nil, fmt.Errorf("--template-sha256 requires a template archive, not a directory")
+		}
+		archive.SHA256 = templateSHA256
+		return archive, nil
+	}
 
-			// Calculate starting app number before the loop
-			startingAppNum := len(instructions) + 1
-			for j := 0; j < numApps; j++ {
-				instructions = append(instructions, utils.InjectionInstruction{
-					Type:    "create-new",
-					AppName: fmt.Sprintf("app-%d", startingAppNum+j),
-				})
-			}
-		} else if strings.HasPrefix(part, "http") {
-			// Extract repo name from URL for app naming
-			appName := extractRepoName(part)
-			if appName == "" {
-				appName = fmt.Sprintf("imported-app-%d", i+1)
-			}
+	templateRef := ref
+	if templateRef == "" {
+		templateRef = branch
+	}
 
-			instructions = append(instructions, utils.InjectionInstruction{
-				Type:    "import-repo",
-				RepoURL: part,
-				AppName: appName,
-			})
-		} else {
-			return nil, fmt.Errorf("invalid injection instruction: %s", part)
-		}
+	cache, err := utils.OpenTemplateCache(cacheDir)
+	if err != nil {
+		return nil, err
+	}
+
+	provider, err := utils.NewProvider(utils.ProviderConfig{Name: providerName, BaseURL: providerURL})
+	if err != nil {
+		return nil, err
 	}
 
-	return instructions, nil
+	return &utils.RemoteSource{
+		Provider: provider,
+		Owner:    owner,
+		Repo:     repo,
+		Ref:      templateRef,
+		// A dry run never writes to the cache, and only goes online when
+		// it is allowed to
+		Cache: utils.CacheOptions{
+			Cache:    cache,
+			Offline:  offline || (dryRun && !dryRunDownload),
+			Refresh:  refresh,
+			ReadOnly: dryRun,
+		},
+		SHA256:   templateSHA256,
+		Progress: utils.TerminalProgress(os.Stderr),
+		Output:   out,
+	}, nil
+}
+
+// parseSetValues parses the key=value pairs given with --set.
+func parseSetValues(pairs []string) (map[string]string, error) {
+	values := make(map[string]string, len(pairs))
+	for _, pair := range pairs {
+		key, value, found := strings.Cut(pair, "=")
+		key = strings.TrimSpace(key)
+		if !found || key == "" {
+			return nil, fmt.Errorf("invalid --set value %q: expected key=value", pair)
+		}
+		values[key] = value
+	}
+	return values, nil
 }
 
-// extractRepoName extracts repository name from GitHub URL
-func extractRepoName(url string) string {
-	// Handle GitHub URLs like https://github.com/owner/repo or https://github.com/owner/repo.git
-	urlRegex := regexp.MustCompile(`github\.com/[^/]+/([^/\.]+)`)
-	matches := urlRegex.FindStringSubmatch(url)
-	if len(matches) > 1 {
-		return matches[1]
+// resolveTemplateVariables collects the manifest variables from --set
+// values, prompting for the rest when running in a terminal. --set values
+// for variables the manifest does not declare are an error. workspaceName
+// is always available.
+func resolveTemplateVariables(out io.Writer, manifest *utils.Manifest, given map[string]string, workspaceName string) (map[string]string, error) {
+	// workspaceName is built in, so it may be set without being declared
+	values := make(map[string]string, len(given))
+	for key, value := range given {
+		values[key] = value
+	}
+	if value, ok := values["workspaceName"]; ok {
+		workspaceName = value
+		delete(values, "workspaceName")
+		for _, v := range manifest.Variables {
+			if v.Name == "workspaceName" {
+				values["workspaceName"] = value
+			}
+		}
+	}
+
+	var prompt utils.Prompter
+	if utils.IsTerminal(os.Stdin) {
+		prompt = utils.NewLinePrompter(os.Stdin, out)
+	}
+
+	values, err := manifest.ResolveVariables(out, values, prompt)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := values["workspaceName"]; !ok {
+		values["workspaceName"] = workspaceName
 	}
-	return ""
+	return values, nil
 }
@@ -3,6 +3,7 @@ package cmd
 import (
 	"context"
 	"fmt"
+	"os"
 
 	"nx-scaffolder/internal/utils"
 
@@ -10,15 +11,32 @@ import (
 )
 
 var fetchCmd = &cobra.Command{
-	Use:   "fetch [owner] [repo] [file-path]",
-	Short: "Fetch a specific file from a GitHub repository",
-	Long:  "Downloads a single file from a GitHub repository using the GitHub API",
-	Args:  cobra.ExactArgs(3),
-	RunE:  runFetch,
+	Use:   "fetch [owner] [repo] [path]",
+	Short: "Fetch files from a GitHub repository",
+	Long: `Downloads a file, a directory or every file matching a glob from a GitHub
+repository using the GitHub API. Files keep their repository paths below --dest.
+
+Examples:
+  nx-scaffolder fetch nrwl nx .github --dest ./reference
+  nx-scaffolder fetch nrwl nx 'tools/**/*.json' --ref 19.0.0
+  nx-scaffolder fetch nrwl nx package.json --stdout | jq .version`,
+	Args: cobra.ExactArgs(3),
+	RunE: runFetch,
 }
 
+var (
+	fetchRef    string
+	fetchDest   string
+	fetchStdout bool
+)
+
 func init() {
 	rootCmd.AddCommand(fetchCmd)
+
+	fetchCmd.Flags().StringVar(&fetchRef, "ref", "", "Branch, tag or commit SHA to fetch from (default: the repository's default branch)")
+	fetchCmd.Flags().StringVar(&fetchDest, "dest", ".", "Directory to write the fetched files to")
+	fetchCmd.Flags().BoolVar(&fetchStdout, "stdout", false, "Write a single fetched file to stdout")
+	fetchCmd.MarkFlagsMutuallyExclusive("dest", "stdout")
 }
 
 func runFetch(cmd *cobra.Command, args []string) error {
@@ -28,13 +46,26 @@ func runFetch(cmd *cobra.Command, args []string) error {
 
 	ctx := context.Background()
 
+	opts := utils.FetchOptions{Ref: fetchRef, Dest: fetchDest}
+	if fetchStdout {
+		opts.Stdout = os.Stdout
+		_, _, err := utils.FetchGitHubPaths(ctx, owner, repo, filePath, opts)
+		if err != nil {
+			return fmt.Errorf("failed to fetch file: %w", err)
+		}
+		return nil
+	}
+
 	fmt.Printf("Fetching %s from %s/%s...\n", filePath, owner, repo)
 
-	err := utils.FetchGitHubRepo(ctx, owner, repo, filePath)
+	commit, files, err := utils.FetchGitHubPaths(ctx, owner, repo, filePath, opts)
 	if err != nil {
-		return fmt.Errorf("failed to fetch file: %w", err)
+		return fmt.Errorf("failed to fetch %s: %w", filePath, err)
 	}
 
-	fmt.Printf("✅ Successfully fetched %s\n", filePath)
+	for _, file := range files {
+		fmt.Printf("  %s\n", file.LocalPath)
+	}
+	fmt.Printf("✅ Successfully fetched %d files from %s/%s@%.12s\n", len(files), owner, repo, commit)
 	return nil
 }
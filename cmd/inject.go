@@ -0,0 +1,118 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"nx-scaffolder/internal/utils"
+
+	"github.com/spf13/cobra"
+)
+
+var injectCmd = &cobra.Command{
+	Use:   "inject",
+	Short: "Work with --inject expressions",
+	Long:  "Inspects the pipe-delimited expressions given to create --inject",
+}
+
+var injectExplainCmd = &cobra.Command{
+	Use:   "explain <expression>",
+	Short: "Show the apps and libraries an --inject expression creates",
+	Long: `Parses an --inject expression and prints the resulting instructions, in
+order, with how each name was derived. Nothing is downloaded or written.`,
+	Example: `  nx-scaffolder inject explain '{create-new*3:site}|https://github.com/org/repo@v2'`,
+	Args:    cobra.ExactArgs(1),
+	RunE:    runInjectExplain,
+}
+
+var explainJSON bool
+
+func init() {
+	rootCmd.AddCommand(injectCmd)
+	injectCmd.AddCommand(injectExplainCmd)
+
+	injectExplainCmd.Flags().BoolVar(&explainJSON, "json", false, "Print the plan as JSON")
+}
+
+// explainedStep is an instruction of the JSON plan.
+type explainedStep struct {
+	Index      int      `json:"index"`
+	Type       string   `json:"type"`
+	Name       string   `json:"name"`
+	Path       string   `json:"path"`
+	Source     string   `json:"source,omitempty"`
+	Ref        string   `json:"ref,omitempty"`
+	Subdir     string   `json:"subdir,omitempty"`
+	Framework  string   `json:"framework,omitempty"`
+	Buildable  bool     `json:"buildable,omitempty"`
+	Tags       []string `json:"tags,omitempty"`
+	Expression string   `json:"expression"`
+	Column     int      `json:"column"`
+	Note       string   `json:"note,omitempty"`
+}
+
+func runInjectExplain(cmd *cobra.Command, args []string) error {
+	steps, err := utils.ParseInjectExpression(args[0])
+	if err != nil {
+		return fmt.Errorf("invalid inject expression: %w", err)
+	}
+
+	if explainJSON {
+		plan := make([]explainedStep, len(steps))
+		for i, step := range steps {
+			instruction := step.Instruction
+			plan[i] = explainedStep{
+				Index:      i + 1,
+				Type:       instruction.Type,
+				Name:       instruction.AppName,
+				Path:       instruction.ProjectRoot(),
+				Source:     instruction.RepoURL,
+				Ref:        instruction.Branch,
+				Subdir:     instruction.Subdir,
+				Framework:  instruction.Framework,
+				Buildable:  instruction.Buildable,
+				Tags:       instruction.Tags,
+				Expression: step.Expr,
+				Column:     step.Column,
+				Note:       step.Note,
+			}
+		}
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(plan)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "#\tTYPE\tPATH\tSOURCE\tOPTIONS\tFROM\tNOTE")
+	for i, step := range steps {
+		instruction := step.Instruction
+		var options []string
+		if instruction.Branch != "" {
+			options = append(options, "ref "+instruction.Branch)
+		}
+		if instruction.Subdir != "" {
+			options = append(options, "subdir "+instruction.Subdir)
+		}
+		if instruction.Framework != "" {
+			options = append(options, instruction.Framework)
+		}
+		if instruction.Buildable {
+			options = append(options, "buildable")
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%d: %s\t%s\n",
+			i+1, instruction.Type, instruction.ProjectRoot(), orDash(instruction.RepoURL),
+			orDash(strings.Join(options, ", ")), step.Column, step.Expr, step.Note)
+	}
+	return w.Flush()
+}
+
+// orDash returns s, or "-" for an empty table cell.
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,93 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"nx-scaffolder/internal/utils"
+
+	"github.com/spf13/cobra"
+)
+
+var syncCmd = &cobra.Command{
+	Use:   "sync",
+	Short: "Sync shared files from their source repositories",
+	Long: `Updates the files listed in nx-scaffolder.sync.yaml from the GitHub repositories
+they were copied from. The blob SHA of every synced file is recorded in
+nx-scaffolder.sync.lock, so files edited locally are reported instead of
+overwritten. Files changed only upstream are updated.
+
+Example nx-scaffolder.sync.yaml:
+  sources:
+    - repo: acme/shared-config
+      path: eslint
+      ref: v2
+    - repo: acme/shared-config
+      path: workflows/*.yml
+      dest: .github/workflows
+
+Examples:
+  nx-scaffolder sync
+  nx-scaffolder sync --check
+  nx-scaffolder sync --force --dir ./my-workspace`,
+	Args: cobra.NoArgs,
+	RunE: runSync,
+}
+
+var (
+	syncDir   string
+	syncCheck bool
+	syncForce bool
+)
+
+func init() {
+	rootCmd.AddCommand(syncCmd)
+
+	syncCmd.Flags().StringVar(&syncDir, "dir", ".", "Workspace containing nx-scaffolder.sync.yaml")
+	syncCmd.Flags().BoolVar(&syncCheck, "check", false, "Report drift without changing any files; fails when files are out of sync")
+	syncCmd.Flags().BoolVar(&syncForce, "force", false, "Overwrite local edits with the upstream versions")
+	syncCmd.MarkFlagsMutuallyExclusive("check", "force")
+}
+
+func runSync(cmd *cobra.Command, args []string) error {
+	results, err := utils.Sync(context.Background(), syncDir, utils.SyncOptions{Check: syncCheck, Force: syncForce})
+	if err != nil {
+		return fmt.Errorf("failed to sync: %w", err)
+	}
+
+	var updated, drifted, diverged int
+	for _, result := range results {
+		if result.State == utils.SyncUpToDate {
+			continue
+		}
+		line := fmt.Sprintf("  %-17s %s (%s)", result.State, result.Path, result.Source)
+		if result.Note != "" {
+			line += ": " + result.Note
+		}
+		fmt.Println(line)
+
+		switch {
+		case result.Updated:
+			updated++
+		case result.State == utils.SyncDiverged:
+			diverged++
+			drifted++
+		default:
+			drifted++
+		}
+	}
+
+	if syncCheck {
+		if drifted > 0 {
+			return fmt.Errorf("%d of %d synced files are out of sync", drifted, len(results))
+		}
+		fmt.Printf("✅ All %d synced files are up to date\n", len(results))
+		return nil
+	}
+
+	if diverged > 0 {
+		return fmt.Errorf("%d files changed both locally and upstream; resolve them by hand or rerun with --force", diverged)
+	}
+	fmt.Printf("✅ Synced %d files (%d updated)\n", len(results), updated)
+	return nil
+}
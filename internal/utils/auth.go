@@ -0,0 +1,265 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/google/go-github/v53/github"
+	"golang.org/x/oauth2"
+	"gopkg.in/yaml.v3"
+)
+
+// Credential is an access token for a git host together with where it was
+// found, so errors can tell the user which source was tried.
+type Credential struct {
+	Token  string
+	Source string
+	Hint   string // How to provide a credential when none was found
+}
+
+// String describes the credential source for error messages.
+func (c Credential) String() string {
+	if c.Token == "" {
+		return "no credentials (anonymous request)"
+	}
+	return "token from " + c.Source
+}
+
+// ResolveGitHubCredential looks up a token for a GitHub host. Sources are
+// tried in order: the GITHUB_TOKEN and GH_TOKEN environment variables,
+// ~/.netrc (or $NETRC) and the gh CLI hosts file.
+func ResolveGitHubCredential(host string) Credential {
+	for _, name := range []string{"GITHUB_TOKEN", "GH_TOKEN"} {
+		if token := os.Getenv(name); token != "" {
+			return Credential{Token: token, Source: name + " environment variable"}
+		}
+	}
+
+	if cred, ok := netrcCredential(host, "api."+host); ok {
+		return cred
+	}
+
+	if cred, ok := ghHostsCredential(host); ok {
+		return cred
+	}
+
+	return Credential{Hint: "set GITHUB_TOKEN, add the host to ~/.netrc or run 'gh auth login'"}
+}
+
+// netrcCredential returns the password of the first netrc machine entry
+// matching one of hosts.
+func netrcCredential(hosts ...string) (Credential, bool) {
+	netrcPath := os.Getenv("NETRC")
+	if netrcPath == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return Credential{}, false
+		}
+		netrcPath = filepath.Join(home, ".netrc")
+	}
+
+	data, err := os.ReadFile(netrcPath)
+	if err != nil {
+		return Credential{}, false
+	}
+
+	passwords := parseNetrc(string(data))
+	for _, host := range hosts {
+		if password, ok := passwords[host]; ok && password != "" {
+			return Credential{Token: password, Source: netrcPath}, true
+		}
+	}
+	return Credential{}, false
+}
+
+// parseNetrc maps machine names to passwords. The "default" entry is stored
+// under the empty name.
+func parseNetrc(data string) map[string]string {
+	passwords := make(map[string]string)
+	fields := strings.Fields(data)
+
+	machine := ""
+	inMachine := false
+	for i := 0; i < len(fields); i++ {
+		switch fields[i] {
+		case "machine":
+			if i+1 < len(fields) {
+				i++
+				machine = fields[i]
+				inMachine = true
+			}
+		case "default":
+			machine = ""
+			inMachine = true
+		case "password":
+			if i+1 < len(fields) {
+				i++
+				if inMachine {
+					passwords[machine] = fields[i]
+				}
+			}
+		case "login", "account":
+			i++ // Skip the value
+		}
+	}
+	return passwords
+}
+
+// ghHostsCredential reads the token stored by `gh auth login` when the gh CLI
+// keeps it in its hosts file rather than the system keyring.
+func ghHostsCredential(host string) (Credential, bool) {
+	configDir := os.Getenv("GH_CONFIG_DIR")
+	if configDir == "" {
+		if xdg := os.Getenv("XDG_CONFIG_HOME"); xdg != "" {
+			configDir = filepath.Join(xdg, "gh")
+		} else if home, err := os.UserHomeDir(); err == nil {
+			configDir = filepath.Join(home, ".config", "gh")
+		} else {
+			return Credential{}, false
+		}
+	}
+
+	hostsPath := filepath.Join(configDir, "hosts.yml")
+	data, err := os.ReadFile(hostsPath)
+	if err != nil {
+		return Credential{}, false
+	}
+
+	var hosts map[string]struct {
+		OAuthToken string `yaml:"oauth_token"`
+	}
+	if err := yaml.Unmarshal(data, &hosts); err != nil {
+		return Credential{}, false
+	}
+
+	if entry, ok := hosts[host]; ok && entry.OAuthToken != "" {
+		return Credential{Token: entry.OAuthToken, Source: hostsPath}, true
+	}
+	return Credential{}, false
+}
+
+// newAuthenticatedClient returns an HTTP client that sends cred's token only
+// to the listed hosts, so redirects to other hosts never see it.
+func newAuthenticatedClient(cred Credential, hosts ...string) *http.Client {
+	if cred.Token == "" {
+		return &http.Client{}
+	}
+
+	scoped := &hostScopedTransport{
+		hosts: make(map[string]bool),
+		authed: &oauth2.Transport{
+			Source: oauth2.StaticTokenSource(&oauth2.Token{AccessToken: cred.Token}),
+			Base:   http.DefaultTransport,
+		},
+		base: http.DefaultTransport,
+	}
+	for _, host := range hosts {
+		scoped.hosts[host] = true
+	}
+	return &http.Client{Transport: scoped}
+}
+
+// hostScopedTransport routes requests for selected hosts through an
+// authenticating transport.
+type hostScopedTransport struct {
+	hosts  map[string]bool
+	authed http.RoundTripper
+	base   http.RoundTripper
+}
+
+func (t *hostScopedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.hosts[req.URL.Hostname()] {
+		return t.authed.RoundTrip(req)
+	}
+	return t.base.RoundTrip(req)
+}
+
+// githubSession is the authenticated HTTP client shared by the GitHub API
+// client and template archive downloads.
+type githubSession struct {
+	http *http.Client
+	api  *github.Client
+	cred Credential
+}
+
+// newGitHubSession builds the clients for a credential.
+func newGitHubSession(cred Credential) *githubSession {
+	httpClient := newGitHubHTTPClient(cred)
+	return &githubSession{
+		http: httpClient,
+		api:  github.NewClient(httpClient),
+		cred: cred,
+	}
+}
+
+var (
+	defaultSessionOnce sync.Once
+	defaultSession     *githubSession
+)
+
+// defaultGitHubSession returns the session shared by every GitHub request
+// of a run, so rate limit information is not lost between calls. Its
+// credentials are resolved on first use.
+func defaultGitHubSession() *githubSession {
+	defaultSessionOnce.Do(func() {
+		defaultSession = newGitHubSession(ResolveGitHubCredential(githubHost))
+	})
+	return defaultSession
+}
+
+// HTTPStatusError reports an unexpected HTTP response together with the
+// credential source that was used for the request.
+type HTTPStatusError struct {
+	URL        string
+	StatusCode int
+	Status     string
+	Credential Credential
+}
+
+func (e *HTTPStatusError) Error() string {
+	switch e.StatusCode {
+	case http.StatusUnauthorized:
+		if e.Credential.Token == "" {
+			return fmt.Sprintf("authentication required for %s (401): no credentials found; %s", e.URL, e.Credential.Hint)
+		}
+		return fmt.Sprintf("authentication failed for %s (401): the %s was rejected; check that it is valid and not expired", e.URL, e.Credential)
+	case http.StatusForbidden:
+		return fmt.Sprintf("access denied to %s (403) using %s: the token may lack access to this repository or the rate limit was exceeded", e.URL, e.Credential)
+	case http.StatusNotFound:
+		return fmt.Sprintf("%s not found (404) using %s: the repository or ref does not exist, or it is private and not visible to these credentials", e.URL, e.Credential)
+	default:
+		return fmt.Sprintf("request to %s failed: %s", e.URL, e.Status)
+	}
+}
+
+// checkResponse turns a non-2xx response into an HTTPStatusError.
+func checkResponse(resp *http.Response, cred Credential) error {
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	return &HTTPStatusError{
+		URL:        resp.Request.URL.Redacted(),
+		StatusCode: resp.StatusCode,
+		Status:     resp.Status,
+		Credential: cred,
+	}
+}
+
+// explainGitHubError rewrites authentication and visibility errors returned
+// by the GitHub API client into an HTTPStatusError naming the credential.
+func explainGitHubError(err error, cred Credential) error {
+	var ghErr *github.ErrorResponse
+	if !errors.As(err, &ghErr) || ghErr.Response == nil {
+		return err
+	}
+	switch ghErr.Response.StatusCode {
+	case http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound:
+		return checkResponse(ghErr.Response, cred)
+	}
+	return err
+}
@@ -0,0 +1,81 @@
+package utils
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestResolveGitHubCredentialSources(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("GITHUB_TOKEN", "")
+	t.Setenv("GH_TOKEN", "")
+	t.Setenv("NETRC", filepath.Join(home, ".netrc"))
+	t.Setenv("GH_CONFIG_DIR", filepath.Join(home, "gh"))
+
+	if cred := ResolveGitHubCredential(githubHost); cred.Token != "" {
+		t.Fatalf("expected no credential; got one from %s", cred.Source)
+	}
+
+	err := os.MkdirAll(filepath.Join(home, "gh"), 0755)
+	if err != nil {
+		t.Fatalf("error creating gh config dir. Err: %v", err)
+	}
+	hosts := "github.com:\n    user: octocat\n    oauth_token: gho_hosts\n"
+	if err := os.WriteFile(filepath.Join(home, "gh", "hosts.yml"), []byte(hosts), 0600); err != nil {
+		t.Fatalf("error writing hosts.yml. Err: %v", err)
+	}
+	if cred := ResolveGitHubCredential(githubHost); cred.Token != "gho_hosts" {
+		t.Errorf("expected the gh hosts token; got %q", cred.Token)
+	}
+
+	netrc := "machine example.com login x password nope\nmachine api.github.com\n  login octocat\n  password ghp_netrc\n"
+	if err := os.WriteFile(filepath.Join(home, ".netrc"), []byte(netrc), 0600); err != nil {
+		t.Fatalf("error writing .netrc. Err: %v", err)
+	}
+	if cred := ResolveGitHubCredential(githubHost); cred.Token != "ghp_netrc" {
+		t.Errorf("expected the netrc token to take precedence; got %q", cred.Token)
+	}
+
+	t.Setenv("GITHUB_TOKEN", "ghp_env")
+	cred := ResolveGitHubCredential(githubHost)
+	if cred.Token != "ghp_env" || !strings.Contains(cred.Source, "GITHUB_TOKEN") {
+		t.Errorf("expected the environment token first; got %q from %s", cred.Token, cred.Source)
+	}
+}
+
+func TestAuthenticatedClientScopesTokenToHost(t *testing.T) {
+	var gotAuth string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotAuth = r.Header.Get("Authorization")
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	cred := Credential{Token: "secret", Source: "test"}
+	resp, err := newAuthenticatedClient(cred, "127.0.0.1").Get(server.URL)
+	if err != nil {
+		t.Fatalf("error making request to server. Err: %v", err)
+	}
+	resp.Body.Close()
+	if gotAuth != "Bearer secret" {
+		t.Errorf("expected the token to be sent to a listed host; got %q", gotAuth)
+	}
+
+	err = checkResponse(resp, cred)
+	if err == nil || !strings.Contains(err.Error(), "404") || !strings.Contains(err.Error(), "token from test") {
+		t.Errorf("expected a 404 error naming the credential source; got %v", err)
+	}
+
+	resp, err = newAuthenticatedClient(cred, "github.com").Get(server.URL)
+	if err != nil {
+		t.Fatalf("error making request to server. Err: %v", err)
+	}
+	resp.Body.Close()
+	if gotAuth != "" {
+		t.Errorf("expected no token for an unlisted host; got %q", gotAuth)
+	}
+}
@@ -0,0 +1,437 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"time"
+)
+
+// TemplateCache stores downloaded template archives on disk. Archives are
+// keyed by host/owner/repo/commit, so an entry never changes once written.
+//
+// Layout:
+//
+//	<dir>/templates/<host>/<owner>/<repo>/refs.json
+//	<dir>/templates/<host>/<owner>/<repo>/<commit>/archive.zip (or archive.tar.gz)
+//	<dir>/templates/<host>/<owner>/<repo>/<commit>/meta.json
+type TemplateCache struct {
+	Dir string
+}
+
+// CacheEntry describes a single cached template archive.
+type CacheEntry struct {
+	Host      string    `json:"host"`
+	Owner     string    `json:"owner"`
+	Repo      string    `json:"repo"`
+	Ref       string    `json:"ref"`
+	Commit    string    `json:"commit"`
+	Format    string    `json:"format,omitempty"` // ArchiveZip (default) or ArchiveTarGz
+	SHA256    string    `json:"sha256"`
+	Size      int64     `json:"size"`
+	FetchedAt time.Time `json:"fetchedAt"`
+	LastUsed  time.Time `json:"lastUsed"`
+
+	dir string
+}
+
+// CacheVerifyResult is the outcome of checking one cache entry.
+type CacheVerifyResult struct {
+	Entry CacheEntry
+	Err   error // nil if the archive matches its recorded checksum
+}
+
+// Archive formats stored in the cache.
+const (
+	ArchiveZip   = "zip"
+	ArchiveTarGz = "tar.gz"
+)
+
+const (
+	cacheMetaName = "meta.json"
+	cacheRefsName = "refs.json"
+)
+
+var commitSHARegex = regexp.MustCompile(`^[0-9a-f]{40}$`)
+
+// DefaultCacheDir returns $NX_SCAFFOLDER_CACHE_DIR, or nx-scaffolder inside
+// the user cache directory.
+func DefaultCacheDir() (string, error) {
+	if dir := os.Getenv("NX_SCAFFOLDER_CACHE_DIR"); dir != "" {
+		return dir, nil
+	}
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to determine cache directory: %w", err)
+	}
+	return filepath.Join(dir, "nx-scaffolder"), nil
+}
+
+// OpenTemplateCache returns the cache rooted at dir, or at DefaultCacheDir
+// when dir is empty.
+func OpenTemplateCache(dir string) (*TemplateCache, error) {
+	if dir == "" {
+		var err error
+		dir, err = DefaultCacheDir()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &TemplateCache{Dir: dir}, nil
+}
+
+// ArchivePath returns the path of the cached archive.
+func (e *CacheEntry) ArchivePath() string {
+	return filepath.Join(e.dir, cacheArchiveName(e.Format))
+}
+
+func cacheArchiveName(format string) string {
+	if format == ArchiveTarGz {
+		return "archive.tar.gz"
+	}
+	return "archive.zip"
+}
+
+func (c *TemplateCache) repoDir(host, owner, repo string) string {
+	return filepath.Join(c.Dir, "templates", host, owner, repo)
+}
+
+// Lookup returns the cached archive for a commit, if present.
+func (c *TemplateCache) Lookup(host, owner, repo, commit string) (*CacheEntry, bool) {
+	entry, err := readCacheEntry(filepath.Join(c.repoDir(host, owner, repo), commit))
+	if err != nil {
+		return nil, false
+	}
+	if _, err := os.Stat(entry.ArchivePath()); err != nil {
+		return nil, false
+	}
+	return entry, true
+}
+
+// Touch records that a cached entry was used, which protects it from pruning.
+func (c *TemplateCache) Touch(entry *CacheEntry) error {
+	entry.LastUsed = time.Now().UTC()
+	return writeCacheEntry(entry)
+}
+
+// Store saves a ZIP archive for a commit and returns its entry.
+func (c *TemplateCache) Store(host, owner, repo, ref, commit string, archive io.Reader) (*CacheEntry, error) {
+	w, err := c.Create(host, owner, repo, ref, commit, ArchiveZip)
+	if err != nil {
+		return nil, err
+	}
+	defer w.Abort()
+
+	_, err = io.Copy(w, archive)
+	if err != nil {
+		return nil, fmt.Errorf("failed to save archive to cache: %w", err)
+	}
+	return w.Commit()
+}
+
+// CacheWriter receives an archive while it is downloaded. The archive is
+// written to a temporary directory, so a failed download never leaves a
+// partial entry behind.
+type CacheWriter struct {
+	entry   *CacheEntry
+	repoDir string
+	file    *os.File
+	hash    hash.Hash
+	done    bool
+}
+
+// Create starts a new cache entry for a commit. The caller writes the
+// archive and then calls Commit, or Abort to discard it.
+func (c *TemplateCache) Create(host, owner, repo, ref, commit, format string) (*CacheWriter, error) {
+	repoDir := c.repoDir(host, owner, repo)
+	err := os.MkdirAll(repoDir, 0755)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cache directory: %w", err)
+	}
+
+	tmpDir, err := os.MkdirTemp(repoDir, ".tmp-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cache directory: %w", err)
+	}
+
+	file, err := os.Create(filepath.Join(tmpDir, cacheArchiveName(format)))
+	if err != nil {
+		os.RemoveAll(tmpDir)
+		return nil, fmt.Errorf("failed to create cached archive: %w", err)
+	}
+
+	return &CacheWriter{
+		entry: &CacheEntry{
+			Host:   host,
+			Owner:  owner,
+			Repo:   repo,
+			Ref:    ref,
+			Commit: commit,
+			Format: format,
+			dir:    tmpDir,
+		},
+		repoDir: repoDir,
+		file:    file,
+		hash:    sha256.New(),
+	}, nil
+}
+
+func (w *CacheWriter) Write(p []byte) (int, error) {
+	n, err := w.file.Write(p)
+	w.hash.Write(p[:n])
+	w.entry.Size += int64(n)
+	return n, err
+}
+
+// Commit makes the entry visible in the cache and returns it.
+func (w *CacheWriter) Commit() (*CacheEntry, error) {
+	w.done = true
+	defer os.RemoveAll(w.entry.dir)
+
+	err := w.file.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to save archive to cache: %w", err)
+	}
+
+	now := time.Now().UTC()
+	entry := w.entry
+	entry.SHA256 = hex.EncodeToString(w.hash.Sum(nil))
+	entry.FetchedAt = now
+	entry.LastUsed = now
+	err = writeCacheEntry(entry)
+	if err != nil {
+		return nil, err
+	}
+
+	// Replace any previous (e.g. corrupt) entry for the same commit
+	tmpDir := entry.dir
+	entryDir := filepath.Join(w.repoDir, entry.Commit)
+	err = os.RemoveAll(entryDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to replace cache entry: %w", err)
+	}
+	err = os.Rename(tmpDir, entryDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to commit cache entry: %w", err)
+	}
+	entry.dir = entryDir
+
+	return entry, nil
+}
+
+// Abort discards an entry that was not committed. It is a no-op after Commit.
+func (w *CacheWriter) Abort() {
+	if w.done {
+		return
+	}
+	w.done = true
+	w.file.Close()
+	os.RemoveAll(w.entry.dir)
+}
+
+// RecordRef remembers which commit a ref resolved to, so offline runs can
+// find the archive again without asking the remote.
+func (c *TemplateCache) RecordRef(host, owner, repo, ref, commit string) error {
+	refsPath := filepath.Join(c.repoDir(host, owner, repo), cacheRefsName)
+
+	refs := make(map[string]string)
+	if data, err := os.ReadFile(refsPath); err == nil {
+		_ = json.Unmarshal(data, &refs)
+	}
+	refs[ref] = commit
+
+	data, err := json.MarshalIndent(refs, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(refsPath, data, 0644)
+}
+
+// ResolveOffline maps a ref onto a commit using only what is in the cache.
+// Full commit SHAs resolve to themselves.
+func (c *TemplateCache) ResolveOffline(host, owner, repo, ref string) (string, error) {
+	if commitSHARegex.MatchString(ref) {
+		return ref, nil
+	}
+
+	data, err := os.ReadFile(filepath.Join(c.repoDir(host, owner, repo), cacheRefsName))
+	if err != nil {
+		return "", fmt.Errorf("no cached templates for %s/%s", owner, repo)
+	}
+
+	refs := make(map[string]string)
+	err = json.Unmarshal(data, &refs)
+	if err != nil {
+		return "", fmt.Errorf("failed to read cached refs for %s/%s: %w", owner, repo, err)
+	}
+
+	commit, ok := refs[ref]
+	if !ok {
+		return "", fmt.Errorf("ref %q of %s/%s has never been fetched", ref, owner, repo)
+	}
+	return commit, nil
+}
+
+// List returns every cache entry, most recently used first. The tree is
+// walked rather than globbed, as GitLab owners may span several directories.
+func (c *TemplateCache) List() ([]CacheEntry, error) {
+	var entries []CacheEntry
+	root := filepath.Join(c.Dir, "templates")
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if path == root && os.IsNotExist(err) {
+			return filepath.SkipAll // Nothing cached yet
+		}
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || d.Name() != cacheMetaName {
+			return nil
+		}
+		// Skip temporary directories left behind by interrupted downloads
+		if !commitSHARegex.MatchString(filepath.Base(filepath.Dir(path))) {
+			return nil
+		}
+		entry, err := readCacheEntry(filepath.Dir(path))
+		if err != nil {
+			return nil
+		}
+		entries = append(entries, *entry)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].LastUsed.After(entries[j].LastUsed)
+	})
+	return entries, nil
+}
+
+// Prune removes entries that have not been used within maxAge, or every
+// entry when maxAge is zero. It returns the removed entries.
+func (c *TemplateCache) Prune(maxAge time.Duration) ([]CacheEntry, error) {
+	entries, err := c.List()
+	if err != nil {
+		return nil, err
+	}
+
+	cutoff := time.Now().Add(-maxAge)
+	var removed []CacheEntry
+	for _, entry := range entries {
+		if maxAge > 0 && entry.LastUsed.After(cutoff) {
+			continue
+		}
+		err := c.Remove(entry)
+		if err != nil {
+			return removed, err
+		}
+		removed = append(removed, entry)
+	}
+
+	return removed, nil
+}
+
+// Remove deletes a cache entry and any refs that resolve to it.
+func (c *TemplateCache) Remove(entry CacheEntry) error {
+	err := os.RemoveAll(entry.dir)
+	if err != nil {
+		return fmt.Errorf("failed to remove %s: %w", entry.dir, err)
+	}
+	c.forgetCommit(entry.Host, entry.Owner, entry.Repo, entry.Commit)
+	return nil
+}
+
+// forgetCommit drops refs pointing at a removed commit.
+func (c *TemplateCache) forgetCommit(host, owner, repo, commit string) {
+	refsPath := filepath.Join(c.repoDir(host, owner, repo), cacheRefsName)
+	data, err := os.ReadFile(refsPath)
+	if err != nil {
+		return
+	}
+
+	refs := make(map[string]string)
+	if json.Unmarshal(data, &refs) != nil {
+		return
+	}
+	for ref, refCommit := range refs {
+		if refCommit == commit {
+			delete(refs, ref)
+		}
+	}
+
+	if len(refs) == 0 {
+		os.Remove(refsPath)
+		os.Remove(c.repoDir(host, owner, repo))
+		return
+	}
+	if data, err := json.MarshalIndent(refs, "", "  "); err == nil {
+		os.WriteFile(refsPath, data, 0644)
+	}
+}
+
+// Verify recomputes the checksum of every cached archive.
+func (c *TemplateCache) Verify() ([]CacheVerifyResult, error) {
+	entries, err := c.List()
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]CacheVerifyResult, 0, len(entries))
+	for _, entry := range entries {
+		results = append(results, CacheVerifyResult{Entry: entry, Err: verifyCacheEntry(&entry)})
+	}
+	return results, nil
+}
+
+func verifyCacheEntry(entry *CacheEntry) error {
+	f, err := os.Open(entry.ArchivePath())
+	if err != nil {
+		return fmt.Errorf("archive missing: %w", err)
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(hash, f)
+	if err != nil {
+		return fmt.Errorf("failed to read archive: %w", err)
+	}
+	if size != entry.Size {
+		return fmt.Errorf("size mismatch: expected %d bytes, found %d", entry.Size, size)
+	}
+	if sum := hex.EncodeToString(hash.Sum(nil)); sum != entry.SHA256 {
+		return fmt.Errorf("checksum mismatch: expected %s, found %s", entry.SHA256, sum)
+	}
+	return nil
+}
+
+func readCacheEntry(dir string) (*CacheEntry, error) {
+	data, err := os.ReadFile(filepath.Join(dir, cacheMetaName))
+	if err != nil {
+		return nil, err
+	}
+
+	var entry CacheEntry
+	err = json.Unmarshal(data, &entry)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", filepath.Join(dir, cacheMetaName), err)
+	}
+	entry.dir = dir
+	return &entry, nil
+}
+
+func writeCacheEntry(entry *CacheEntry) error {
+	data, err := json.MarshalIndent(entry, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(entry.dir, cacheMetaName), data, 0644)
+}
@@ -0,0 +1,74 @@
+package utils
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestTemplateCacheRoundTrip(t *testing.T) {
+	cache := &TemplateCache{Dir: t.TempDir()}
+	commit := strings.Repeat("a", 40)
+
+	entry, err := cache.Store(githubHost, "nrwl", "nx", "master", commit, strings.NewReader("zip-bytes"))
+	if err != nil {
+		t.Fatalf("error storing archive. Err: %v", err)
+	}
+	if err := cache.RecordRef(githubHost, "nrwl", "nx", "master", commit); err != nil {
+		t.Fatalf("error recording ref. Err: %v", err)
+	}
+
+	resolved, err := cache.ResolveOffline(githubHost, "nrwl", "nx", "master")
+	if err != nil || resolved != commit {
+		t.Fatalf("expected master to resolve to %s offline; got %q (%v)", commit, resolved, err)
+	}
+	if _, ok := cache.Lookup(githubHost, "nrwl", "nx", commit); !ok {
+		t.Fatalf("expected commit %s to be cached", commit)
+	}
+
+	results, err := cache.Verify()
+	if err != nil || len(results) != 1 || results[0].Err != nil {
+		t.Fatalf("expected one valid entry; got %+v (%v)", results, err)
+	}
+
+	// Corrupt the archive and verify again
+	if err := os.WriteFile(entry.ArchivePath(), []byte("tampered"), 0644); err != nil {
+		t.Fatalf("error corrupting archive. Err: %v", err)
+	}
+	results, _ = cache.Verify()
+	if len(results) != 1 || results[0].Err == nil {
+		t.Errorf("expected verification to fail for a corrupted archive")
+	}
+
+	removed, err := cache.Prune(0)
+	if err != nil || len(removed) != 1 {
+		t.Fatalf("expected prune to remove one entry; got %d (%v)", len(removed), err)
+	}
+	if _, err := cache.ResolveOffline(githubHost, "nrwl", "nx", "master"); err == nil {
+		t.Errorf("expected pruned refs to be forgotten")
+	}
+}
+
+func TestTemplateCacheListNestedOwner(t *testing.T) {
+	cache := &TemplateCache{Dir: t.TempDir()}
+	commit := strings.Repeat("b", 40)
+
+	_, err := cache.Store("gitlab.com", "platform/templates", "nx-react", "main", commit, strings.NewReader("zip-bytes"))
+	if err != nil {
+		t.Fatalf("error storing archive. Err: %v", err)
+	}
+
+	entries, err := cache.List()
+	if err != nil || len(entries) != 1 || entries[0].Owner != "platform/templates" {
+		t.Fatalf("expected the subgroup entry to be listed; got %+v (%v)", entries, err)
+	}
+	if removed, err := cache.Prune(0); err != nil || len(removed) != 1 {
+		t.Errorf("expected prune to remove the subgroup entry; got %d (%v)", len(removed), err)
+	}
+
+	// An empty cache lists nothing
+	entries, err = (&TemplateCache{Dir: t.TempDir()}).List()
+	if err != nil || len(entries) != 0 {
+		t.Errorf("expected no entries for an empty cache; got %+v (%v)", entries, err)
+	}
+}
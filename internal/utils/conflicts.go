@@ -0,0 +1,187 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Policies for project names that conflict with each other or the workspace
+const (
+	ConflictFail   = "fail"   // Report every conflict and stop
+	ConflictSuffix = "suffix" // Rename conflicting projects to name-2, name-3, ...
+)
+
+// NameConflict is a project name that cannot be used as is.
+type NameConflict struct {
+	Index       int // Position of the instruction, from 0
+	Instruction InjectionInstruction
+	Reason      string
+	Renamable   bool // The suffix policy would resolve it
+}
+
+// NameConflictError reports every name conflict of a set of instructions.
+type NameConflictError struct {
+	Conflicts []NameConflict
+}
+
+func (e *NameConflictError) Error() string {
+	var b strings.Builder
+	if len(e.Conflicts) == 1 {
+		b.WriteString("1 project name conflict:")
+	} else {
+		fmt.Fprintf(&b, "%d project name conflicts:", len(e.Conflicts))
+	}
+	for _, conflict := range e.Conflicts {
+		fmt.Fprintf(&b, "\n  [%d] %s: %s", conflict.Index+1, describeInstruction(conflict.Instruction), conflict.Reason)
+	}
+	return b.String()
+}
+
+// Renamable reports whether the suffix policy would resolve every conflict.
+func (e *NameConflictError) Renamable() bool {
+	for _, conflict := range e.Conflicts {
+		if !conflict.Renamable {
+			return false
+		}
+	}
+	return true
+}
+
+// describeInstruction returns a short description of an instruction for
+// error messages, e.g. import-repo shop (https://github.com/acme/shop).
+func describeInstruction(instruction InjectionInstruction) string {
+	if instruction.RepoURL != "" {
+		return fmt.Sprintf("%s %s (%s)", instruction.Type, instruction.AppName, instruction.RepoURL)
+	}
+	return fmt.Sprintf("%s %s", instruction.Type, instruction.AppName)
+}
+
+// ResolveNameConflicts checks the project names of instructions before any
+// of them runs: names must be valid npm and Nx project names, unique across
+// apps and libraries, not taken by a directory under apps/ or libs/ and not
+// shadow the workspace root project or one of its dependencies, which npm
+// workspaces would link in its place. An empty workspacePath skips the
+// checks against the workspace. Directories under apps/ or libs/ of
+// existingDirs, such as an existing destination the workspace will be moved
+// into, are taken as well.
+//
+// With ConflictFail every conflict is returned in a NameConflictError. With
+// ConflictSuffix conflicting projects are renamed, with a warning on out,
+// and the renamed instructions returned; invalid names are still an error.
+// The caller's instructions are not modified.
+func ResolveNameConflicts(out io.Writer, workspacePath string, instructions []InjectionInstruction, policy string, existingDirs ...string) ([]InjectionInstruction, error) {
+	if policy != ConflictFail && policy != ConflictSuffix {
+		return nil, fmt.Errorf("unknown conflict policy %q; expected %s or %s", policy, ConflictFail, ConflictSuffix)
+	}
+
+	resolved := make([]InjectionInstruction, len(instructions))
+	copy(resolved, instructions)
+
+	reserved := reservedProjectNames(workspacePath)
+	taken := make(map[string]int)
+	conflictReason := func(name string) string {
+		if other, ok := taken[name]; ok {
+			return fmt.Sprintf("name %q is already used by [%d] %s", name, other+1, describeInstruction(resolved[other]))
+		}
+		if reason, ok := reserved[name]; ok {
+			return fmt.Sprintf("name %q is reserved: %s", name, reason)
+		}
+		if workspacePath != "" {
+			for _, dir := range []string{"apps", "libs"} {
+				if _, err := os.Stat(filepath.Join(workspacePath, dir, name)); err == nil {
+					return fmt.Sprintf("%s/%s already exists in the workspace", dir, name)
+				}
+			}
+		}
+		for _, existing := range existingDirs {
+			for _, dir := range []string{"apps", "libs"} {
+				if _, err := os.Lstat(filepath.Join(existing, dir, name)); err == nil {
+					return fmt.Sprintf("%s/%s already exists in %s", dir, name, existing)
+				}
+			}
+		}
+		return ""
+	}
+
+	var conflicts []NameConflict
+	for i := range resolved {
+		instruction := &resolved[i]
+		if err := ValidateProjectName(instruction.AppName); err != nil {
+			conflicts = append(conflicts, NameConflict{Index: i, Instruction: *instruction, Reason: err.Error()})
+			continue
+		}
+
+		if reason := conflictReason(instruction.AppName); reason != "" {
+			if policy == ConflictFail {
+				conflicts = append(conflicts, NameConflict{Index: i, Instruction: *instruction, Reason: reason, Renamable: true})
+				continue
+			}
+			name := instruction.AppName
+			for n := 2; conflictReason(name) != ""; n++ {
+				name = suffixedName(instruction.AppName, n)
+			}
+			fmt.Fprintf(out, "Warning: renaming %s to %s: %s\n", describeInstruction(*instruction), name, reason)
+			instruction.AppName = name
+		}
+		taken[instruction.AppName] = i
+	}
+
+	if len(conflicts) > 0 {
+		return nil, &NameConflictError{Conflicts: conflicts}
+	}
+	return resolved, nil
+}
+
+// reservedProjectNames returns names projects cannot take, with the reason.
+func reservedProjectNames(workspacePath string) map[string]string {
+	reserved := map[string]string{
+		"nx": "it is the Nx package",
+	}
+	if workspacePath == "" {
+		return reserved
+	}
+
+	data, err := os.ReadFile(filepath.Join(workspacePath, "package.json"))
+	if err != nil {
+		return reserved
+	}
+	var packageJSON struct {
+		Name                 string            `json:"name"`
+		Dependencies         map[string]string `json:"dependencies"`
+		DevDependencies      map[string]string `json:"devDependencies"`
+		PeerDependencies     map[string]string `json:"peerDependencies"`
+		OptionalDependencies map[string]string `json:"optionalDependencies"`
+	}
+	if json.Unmarshal(data, &packageJSON) != nil {
+		return reserved
+	}
+
+	for _, deps := range []map[string]string{
+		packageJSON.Dependencies,
+		packageJSON.DevDependencies,
+		packageJSON.PeerDependencies,
+		packageJSON.OptionalDependencies,
+	} {
+		for name := range deps {
+			reserved[name] = "it is a dependency of the workspace"
+		}
+	}
+	if packageJSON.Name != "" {
+		reserved[packageJSON.Name] = "it is the workspace root project"
+	}
+	return reserved
+}
+
+// suffixedName returns name-n, shortening name to stay within the length
+// limit of npm package names.
+func suffixedName(name string, n int) string {
+	suffix := fmt.Sprintf("-%d", n)
+	if len(name)+len(suffix) > 214 {
+		name = name[:214-len(suffix)]
+	}
+	return name + suffix
+}
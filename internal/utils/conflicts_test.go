@@ -0,0 +1,80 @@
+package utils
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestResolveNameConflicts(t *testing.T) {
+	workspace := t.TempDir()
+	os.MkdirAll(filepath.Join(workspace, "apps", "app-1"), 0755)
+	os.WriteFile(filepath.Join(workspace, "package.json"), []byte(`{"name": "store", "dependencies": {"react": "18"}}`), 0644)
+
+	instructions := []InjectionInstruction{
+		{Type: "create-new", AppName: "app-1"},
+		{Type: "import-repo", RepoURL: "https://github.com/acme/shop", AppName: "shop"},
+		{Type: "import-repo", RepoURL: "https://gitlab.com/acme/shop", AppName: "shop"},
+		{Type: "create-lib", AppName: "shop"},
+		{Type: "import-repo", RepoURL: "https://github.com/facebook/react", AppName: "react"},
+		{Type: "create-new", AppName: "store"},
+	}
+
+	// fail reports every conflict at once
+	_, err := ResolveNameConflicts(io.Discard, workspace, instructions, ConflictFail)
+	var conflictErr *NameConflictError
+	if !errors.As(err, &conflictErr) {
+		t.Fatalf("expected a NameConflictError; got %v", err)
+	}
+	var indexes []int
+	for _, conflict := range conflictErr.Conflicts {
+		indexes = append(indexes, conflict.Index)
+	}
+	if !reflect.DeepEqual(indexes, []int{0, 2, 3, 4, 5}) || !conflictErr.Renamable() {
+		t.Errorf("expected renamable conflicts for instructions [0 2 3 4 5]; got %v", indexes)
+	}
+	for _, want := range []string{"5 project name conflicts", "apps/app-1 already exists", `name "shop" is already used by [2]`, "dependency of the workspace", "workspace root project"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected the report to contain %q; got %v", want, err)
+		}
+	}
+
+	// suffix renames later projects and leaves the input alone
+	resolved, err := ResolveNameConflicts(io.Discard, workspace, instructions, ConflictSuffix)
+	if err != nil {
+		t.Fatalf("error resolving conflicts. Err: %v", err)
+	}
+	var names []string
+	for _, instruction := range resolved {
+		names = append(names, instruction.AppName)
+	}
+	want := []string{"app-1-2", "shop", "shop-2", "shop-3", "react-2", "store-2"}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("expected names %v; got %v", want, names)
+	}
+	if instructions[2].AppName != "shop" {
+		t.Errorf("expected the instructions passed in to be unchanged; got %s", instructions[2].AppName)
+	}
+
+	// Projects at an existing destination are taken too
+	dest := t.TempDir()
+	os.MkdirAll(filepath.Join(dest, "libs", "shop"), 0755)
+	resolved, err = ResolveNameConflicts(io.Discard, workspace, instructions[1:2], ConflictSuffix, dest)
+	if err != nil || resolved[0].AppName != "shop-2" {
+		t.Errorf("expected shop to be renamed to shop-2; got %v (%v)", resolved, err)
+	}
+
+	// Invalid names cannot be renamed
+	_, err = ResolveNameConflicts(io.Discard, "", []InjectionInstruction{{Type: "create-new", AppName: "Admin"}}, ConflictSuffix)
+	if !errors.As(err, &conflictErr) || conflictErr.Renamable() {
+		t.Errorf("expected an invalid name to fail with the suffix policy; got %v", err)
+	}
+
+	if _, err := ResolveNameConflicts(io.Discard, "", nil, "rename"); err == nil {
+		t.Errorf("expected an error for an unknown policy")
+	}
+}
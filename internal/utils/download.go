@@ -0,0 +1,408 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Downloader fetches large files over HTTP. Transient failures are retried
+// with exponential backoff, and an interrupted transfer resumes from the
+// last byte written using a Range request.
+type Downloader struct {
+	Client      *http.Client
+	Credential  Credential    // Named in authentication errors
+	MaxAttempts int           // Defaults to 5
+	Backoff     time.Duration // Delay before the first retry, doubled after each attempt; defaults to 1s
+	MaxBackoff  time.Duration // Defaults to 30s
+	Progress    io.Writer     // Receives a progress bar; nil disables it
+	Output      io.Writer     // Receives retry notices (default: os.Stdout)
+}
+
+// NewDownloader returns a downloader using the provider's authenticated client.
+func NewDownloader(provider Provider) *Downloader {
+	return &Downloader{
+		Client:     provider.HTTPClient(),
+		Credential: provider.Credential(),
+	}
+}
+
+// retryableError marks a failure that may succeed when the request is sent again.
+type retryableError struct {
+	err        error
+	retryAfter time.Duration // Server-requested delay, if any
+}
+
+func (e *retryableError) Error() string { return e.err.Error() }
+func (e *retryableError) Unwrap() error { return e.err }
+
+// Download writes the resource at rawURL to file, which must be empty. It
+// returns the number of bytes written.
+func (d *Downloader) Download(ctx context.Context, rawURL string, file *os.File) (int64, error) {
+	body, err := d.Open(ctx, rawURL)
+	if err != nil {
+		return 0, err
+	}
+	defer body.Close()
+
+	return io.Copy(file, body)
+}
+
+// Open starts downloading rawURL and returns its body. Reads that fail
+// because the connection dropped are retried transparently, resuming from
+// the last byte returned.
+func (d *Downloader) Open(ctx context.Context, rawURL string) (io.ReadCloser, error) {
+	r := &resumableReader{
+		ctx:      ctx,
+		d:        d,
+		url:      rawURL,
+		backoff:  d.Backoff,
+		progress: newProgressBar(d.Progress),
+	}
+	if r.backoff <= 0 {
+		r.backoff = time.Second
+	}
+
+	err := r.connect()
+	if err != nil {
+		r.progress.finish()
+		return nil, err
+	}
+	return r, nil
+}
+
+// resumableReader is the body of a download that reconnects with a Range
+// request when the transfer is interrupted.
+type resumableReader struct {
+	ctx      context.Context
+	d        *Downloader
+	url      string
+	body     io.ReadCloser
+	offset   int64 // Bytes returned to the caller so far
+	attempt  int
+	backoff  time.Duration
+	progress *progressBar
+}
+
+func (r *resumableReader) Read(p []byte) (int, error) {
+	for {
+		if r.body == nil {
+			if err := r.connect(); err != nil {
+				return 0, err
+			}
+		}
+
+		n, err := r.body.Read(p)
+		r.offset += int64(n)
+		r.progress.add(n)
+		if err == nil || err == io.EOF {
+			return n, err
+		}
+
+		// Hand out what was read; the next call reconnects
+		r.body.Close()
+		r.body = nil
+		if r.ctx.Err() != nil {
+			return n, r.ctx.Err()
+		}
+		err = r.wait(&retryableError{err: fmt.Errorf("connection lost after %s: %w", FormatBytes(r.offset), err)})
+		if n > 0 || err != nil {
+			return n, err
+		}
+	}
+}
+
+func (r *resumableReader) Close() error {
+	r.progress.finish()
+	if r.body == nil {
+		return nil
+	}
+	return r.body.Close()
+}
+
+// connect sends requests until one returns the body from the current
+// offset, or the failure is permanent.
+func (r *resumableReader) connect() error {
+	for {
+		err := r.request()
+		if err == nil {
+			return nil
+		}
+		err = r.wait(err)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// wait sleeps before the next attempt, or returns the error that ends the
+// download when it cannot be retried.
+func (r *resumableReader) wait(err error) error {
+	maxAttempts := r.d.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = 5
+	}
+	maxBackoff := r.d.MaxBackoff
+	if maxBackoff <= 0 {
+		maxBackoff = 30 * time.Second
+	}
+
+	r.attempt++
+	var retryable *retryableError
+	if !errors.As(err, &retryable) || r.attempt >= maxAttempts || r.ctx.Err() != nil {
+		if r.attempt > 1 {
+			return fmt.Errorf("download failed after %d attempts: %w", r.attempt, err)
+		}
+		return err
+	}
+
+	delay := r.backoff
+	if retryable.retryAfter > delay {
+		delay = retryable.retryAfter
+	}
+	r.progress.clear()
+	out := r.d.Output
+	if out == nil {
+		out = os.Stdout
+	}
+	fmt.Fprintf(out, "Download interrupted (%v); retrying in %s (attempt %d of %d)\n", err, delay, r.attempt+1, maxAttempts)
+
+	select {
+	case <-r.ctx.Done():
+		return r.ctx.Err()
+	case <-time.After(delay):
+	}
+
+	r.backoff *= 2
+	if r.backoff > maxBackoff {
+		r.backoff = maxBackoff
+	}
+	return nil
+}
+
+// request sends one GET request, asking for the remaining bytes when part
+// of the body has already been read.
+func (r *resumableReader) request() error {
+	req, err := http.NewRequestWithContext(r.ctx, http.MethodGet, r.url, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create download request: %w", err)
+	}
+	if r.offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", r.offset))
+	}
+
+	client := r.d.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return &retryableError{err: err}
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusPartialContent:
+		start, total, ok := parseContentRange(resp.Header.Get("Content-Range"))
+		if !ok || start != r.offset {
+			resp.Body.Close()
+			return fmt.Errorf("server resumed at an unexpected position (%s)", resp.Header.Get("Content-Range"))
+		}
+		r.progress.start(r.offset, total)
+	case resp.StatusCode == http.StatusOK:
+		// The server ignored the Range header, so skip what was already read
+		if r.offset > 0 {
+			_, err := io.CopyN(io.Discard, resp.Body, r.offset)
+			if err != nil {
+				resp.Body.Close()
+				return &retryableError{err: err}
+			}
+		}
+		r.progress.start(r.offset, resp.ContentLength)
+	case resp.StatusCode == http.StatusRequestTimeout, resp.StatusCode == http.StatusTooManyRequests, resp.StatusCode >= 500:
+		resp.Body.Close()
+		return &retryableError{
+			err:        checkResponse(resp, r.d.Credential),
+			retryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
+		}
+	default:
+		resp.Body.Close()
+		return checkResponse(resp, r.d.Credential)
+	}
+
+	r.body = resp.Body
+	return nil
+}
+
+// parseContentRange parses "bytes start-end/total". total is -1 when unknown.
+func parseContentRange(value string) (start, total int64, ok bool) {
+	value, found := strings.CutPrefix(value, "bytes ")
+	if !found {
+		return 0, 0, false
+	}
+	span, size, found := strings.Cut(value, "/")
+	if !found {
+		return 0, 0, false
+	}
+	first, _, found := strings.Cut(span, "-")
+	if !found {
+		return 0, 0, false
+	}
+
+	start, err := strconv.ParseInt(first, 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	total = -1
+	if size != "*" {
+		total, err = strconv.ParseInt(size, 10, 64)
+		if err != nil {
+			return 0, 0, false
+		}
+	}
+	return start, total, true
+}
+
+// parseRetryAfter reads a Retry-After header given in seconds or as an HTTP date.
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		return time.Until(at)
+	}
+	return 0
+}
+
+// IsTerminal reports whether f is connected to a terminal.
+func IsTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// TerminalProgress returns f when it is a terminal, and nil otherwise so
+// that progress bars stay out of logs and pipes.
+func TerminalProgress(f *os.File) io.Writer {
+	if !IsTerminal(f) {
+		return nil
+	}
+	return f
+}
+
+// progressBar renders download progress on a single terminal line. All
+// methods are no-ops when it has no output.
+type progressBar struct {
+	out      io.Writer
+	done     int64
+	total    int64 // -1 when the size is unknown
+	started  time.Time
+	base     int64 // Bytes already present when the current transfer started
+	rendered time.Time
+}
+
+func newProgressBar(out io.Writer) *progressBar {
+	return &progressBar{out: out, total: -1}
+}
+
+func (p *progressBar) start(done, total int64) {
+	p.done = done
+	p.base = done
+	p.total = total
+	if total >= 0 && total < done {
+		p.total = -1
+	}
+	p.started = time.Now()
+	p.render(true)
+}
+
+func (p *progressBar) add(n int) {
+	p.done += int64(n)
+	p.render(false)
+}
+
+func (p *progressBar) render(force bool) {
+	if p.out == nil {
+		return
+	}
+	now := time.Now()
+	if !force && now.Sub(p.rendered) < 100*time.Millisecond {
+		return
+	}
+	p.rendered = now
+
+	rate := ""
+	if elapsed := now.Sub(p.started).Seconds(); elapsed > 0.5 {
+		rate = fmt.Sprintf("  %s/s", FormatBytes(int64(float64(p.done-p.base)/elapsed)))
+	}
+
+	if p.total <= 0 {
+		fmt.Fprintf(p.out, "\r\033[KDownloading %s%s", FormatBytes(p.done), rate)
+		return
+	}
+
+	const width = 30
+	filled := int(float64(width) * float64(p.done) / float64(p.total))
+	if filled > width {
+		filled = width
+	}
+	bar := strings.Repeat("=", filled) + strings.Repeat(" ", width-filled)
+	fmt.Fprintf(p.out, "\r\033[KDownloading [%s] %3d%%  %s / %s%s",
+		bar, p.done*100/p.total, FormatBytes(p.done), FormatBytes(p.total), rate)
+}
+
+// clear erases the bar so another message can be printed on its line.
+func (p *progressBar) clear() {
+	if p.out != nil && !p.rendered.IsZero() {
+		fmt.Fprint(p.out, "\r\033[K")
+	}
+}
+
+func (p *progressBar) finish() {
+	if p.out != nil && !p.rendered.IsZero() {
+		p.render(true)
+		fmt.Fprintln(p.out)
+	}
+}
+
+// FormatBytes formats a byte count using binary units.
+func FormatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// ChecksumError reports an archive whose SHA-256 digest differs from the
+// expected one.
+type ChecksumError struct {
+	Name     string
+	Expected string
+	Actual   string
+}
+
+func (e *ChecksumError) Error() string {
+	return fmt.Sprintf("checksum mismatch for %s: expected sha256 %s, got %s", e.Name, e.Expected, e.Actual)
+}
+
+// verifyChecksum compares a hex SHA-256 digest with the expected one. An
+// empty expectation always passes.
+func verifyChecksum(name, expected, actual string) error {
+	if expected == "" || strings.EqualFold(expected, actual) {
+		return nil
+	}
+	return &ChecksumError{Name: name, Expected: strings.ToLower(expected), Actual: actual}
+}
@@ -0,0 +1,116 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDownloaderRetriesAndResumes(t *testing.T) {
+	payload := strings.Repeat("0123456789", 1000)
+	var requests atomic.Int32
+	var resumedFrom atomic.Int64
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch requests.Add(1) {
+		case 1:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case 2:
+			// Drop the connection half way through the body
+			w.Header().Set("Content-Length", strconv.Itoa(len(payload)))
+			w.Write([]byte(payload[:len(payload)/2]))
+		default:
+			start := 0
+			if value := r.Header.Get("Range"); value != "" {
+				fmt.Sscanf(value, "bytes=%d-", &start)
+				resumedFrom.Store(int64(start))
+				w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, len(payload)-1, len(payload)))
+				w.WriteHeader(http.StatusPartialContent)
+			}
+			w.Write([]byte(payload[start:]))
+		}
+	}))
+	defer server.Close()
+
+	file, err := os.Create(filepath.Join(t.TempDir(), "archive"))
+	if err != nil {
+		t.Fatalf("error creating file. Err: %v", err)
+	}
+	defer file.Close()
+
+	downloader := &Downloader{Client: server.Client(), Backoff: time.Millisecond}
+	n, err := downloader.Download(context.Background(), server.URL, file)
+	if err != nil {
+		t.Fatalf("error downloading. Err: %v", err)
+	}
+
+	data, _ := os.ReadFile(file.Name())
+	if n != int64(len(payload)) || string(data) != payload {
+		t.Errorf("expected the full payload after resuming; got %d bytes", len(data))
+	}
+	if requests.Load() != 3 || resumedFrom.Load() != int64(len(payload)/2) {
+		t.Errorf("expected a resume from byte %d on the third request; got %d requests resuming from %d",
+			len(payload)/2, requests.Load(), resumedFrom.Load())
+	}
+}
+
+func TestDownloaderDoesNotRetryClientErrors(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		http.NotFound(w, r)
+	}))
+	defer server.Close()
+
+	file, err := os.Create(filepath.Join(t.TempDir(), "archive"))
+	if err != nil {
+		t.Fatalf("error creating file. Err: %v", err)
+	}
+	defer file.Close()
+
+	downloader := &Downloader{Client: server.Client(), Backoff: time.Millisecond}
+	_, err = downloader.Download(context.Background(), server.URL, file)
+	var statusErr *HTTPStatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusNotFound {
+		t.Errorf("expected a 404 HTTPStatusError; got %v", err)
+	}
+	if requests.Load() != 1 {
+		t.Errorf("expected a single request; got %d", requests.Load())
+	}
+}
+
+func TestRemoteSourceVerifiesChecksum(t *testing.T) {
+	server := newFakeForge(t, "secret")
+	defer server.Close()
+	ctx := context.Background()
+
+	provider, err := NewGiteaProvider(server.URL, "secret")
+	if err != nil {
+		t.Fatalf("error creating provider. Err: %v", err)
+	}
+	source := &RemoteSource{Provider: provider, Owner: "org", Repo: "app", Ref: "v1.0.0", SHA256: strings.Repeat("0", 64)}
+
+	dest := t.TempDir()
+	_, err = source.Fetch(ctx, dest, ExtractOptions{})
+	var checksumErr *ChecksumError
+	if !errors.As(err, &checksumErr) {
+		t.Fatalf("expected a ChecksumError; got %v", err)
+	}
+	if entries, _ := os.ReadDir(dest); len(entries) != 0 {
+		t.Errorf("expected nothing to be extracted after a checksum mismatch; got %d entries", len(entries))
+	}
+
+	source.SHA256 = checksumErr.Actual
+	if _, err := source.Fetch(ctx, t.TempDir(), ExtractOptions{}); err != nil {
+		t.Errorf("expected the matching checksum to be accepted; got %v", err)
+	}
+}
@@ -0,0 +1,1028 @@
+package utils
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// ExtractOptions controls which entries of a template archive are extracted
+// and where they land inside the destination path.
+type ExtractOptions struct {
+	Subdir  string         // Only extract this directory of the template (relative to the archive root)
+	Include []string       // Glob patterns a file must match to be extracted (optional)
+	Exclude []string       // Glob patterns of files and directories to skip
+	Policy  *ExtractPolicy // Safety limits (defaults to DefaultExtractPolicy)
+	Workers int            // Files written in parallel (defaults to the number of CPUs)
+}
+
+// ExtractPolicy limits what an archive is allowed to write to disk.
+type ExtractPolicy struct {
+	MaxTotalBytes int64 // Decompressed size budget for the whole archive (0 = unlimited)
+	MaxFileBytes  int64 // Decompressed size budget for a single entry (0 = unlimited)
+	AllowSymlinks bool  // Create symlinks whose target stays inside the destination
+}
+
+// DefaultExtractPolicy returns the policy applied to template archives when
+// the caller does not provide one.
+func DefaultExtractPolicy() ExtractPolicy {
+	return ExtractPolicy{
+		MaxTotalBytes: 4 << 30,   // 4 GiB
+		MaxFileBytes:  512 << 20, // 512 MiB
+		AllowSymlinks: true,
+	}
+}
+
+func (o ExtractOptions) workers() int {
+	if o.Workers > 0 {
+		return o.Workers
+	}
+	return runtime.NumCPU()
+}
+
+func (o ExtractOptions) policy() ExtractPolicy {
+	if o.Policy != nil {
+		return *o.Policy
+	}
+	return DefaultExtractPolicy()
+}
+
+// RejectedEntry is an archive entry refused by the extraction policy.
+type RejectedEntry struct {
+	Name   string
+	Reason string
+}
+
+// ExtractError lists every archive entry that was refused. Nothing is written
+// to disk when an archive is rejected during planning.
+type ExtractError struct {
+	Rejected []RejectedEntry
+}
+
+func (e *ExtractError) Error() string {
+	var b strings.Builder
+	if len(e.Rejected) == 1 {
+		b.WriteString("archive rejected: 1 unsafe entry")
+	} else {
+		fmt.Fprintf(&b, "archive rejected: %d unsafe entries", len(e.Rejected))
+	}
+	for _, r := range e.Rejected {
+		fmt.Fprintf(&b, "\n  - %s: %s", r.Name, r.Reason)
+	}
+	return b.String()
+}
+
+func (e *ExtractError) reject(name, format string, args ...interface{}) {
+	e.Rejected = append(e.Rejected, RejectedEntry{Name: name, Reason: fmt.Sprintf(format, args...)})
+}
+
+// archiveEntry is the format-independent view of a single archive member.
+type archiveEntry struct {
+	Name     string      // Slash-separated name as stored in the archive
+	Mode     os.FileMode // Type bits and Unix permissions
+	Size     int64       // Declared decompressed size
+	Linkname string      // Symlink target (symlinks only)
+	Open     func() (io.ReadCloser, error)
+}
+
+// plannedEntry is an archive entry that passed the policy checks, together
+// with its destination path relative to the extraction root.
+type plannedEntry struct {
+	archiveEntry
+	RelPath string
+}
+
+// extractZipFile extracts a ZIP archive on disk to the destination path.
+func extractZipFile(zipPath, destPath string, opts ExtractOptions) error {
+	// Insecure names are reported by the extraction policy instead
+	zipReader, err := zip.OpenReader(zipPath)
+	if err != nil && !errors.Is(err, zip.ErrInsecurePath) {
+		return fmt.Errorf("failed to open ZIP file: %w", err)
+	}
+	defer zipReader.Close()
+
+	entries, err := zipEntries(&zipReader.Reader)
+	if err != nil {
+		return err
+	}
+
+	return extractEntries(entries, entriesRoot(entries), destPath, opts)
+}
+
+// zipEntries converts the members of a ZIP archive into archive entries.
+func zipEntries(zr *zip.Reader) ([]archiveEntry, error) {
+	entries := make([]archiveEntry, 0, len(zr.File))
+	for _, file := range zr.File {
+		entry := archiveEntry{
+			Name: file.Name,
+			Mode: file.Mode(),
+			Size: int64(file.UncompressedSize64),
+			Open: file.Open,
+		}
+
+		// ZIP stores the symlink target as the entry's content
+		if entry.Mode&os.ModeSymlink != 0 {
+			target, err := readSymlinkTarget(file)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read symlink %s: %w", file.Name, err)
+			}
+			entry.Linkname = target
+		}
+
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+func readSymlinkTarget(file *zip.File) (string, error) {
+	rc, err := file.Open()
+	if err != nil {
+		return "", err
+	}
+	defer rc.Close()
+
+	target, err := io.ReadAll(io.LimitReader(rc, 4096))
+	if err != nil {
+		return "", err
+	}
+	return string(target), nil
+}
+
+// extractTarGzFile extracts a gzip-compressed tar archive on disk to the
+// destination path. The archive is read twice: once to check every header
+// against the policy and once to write the planned entries.
+func extractTarGzFile(archivePath, destPath string, opts ExtractOptions) error {
+	entries, positions, err := tarGzEntries(archivePath)
+	if err != nil {
+		return err
+	}
+
+	cursor := &tarCursor{path: archivePath, index: -1}
+	defer cursor.Close()
+	for i := range entries {
+		position := positions[i]
+		entries[i].Open = func() (io.ReadCloser, error) {
+			return cursor.seek(position)
+		}
+	}
+
+	// The cursor reads the archive front to back, one entry at a time
+	opts.Workers = 1
+	return extractEntries(entries, entriesRoot(entries), destPath, opts)
+}
+
+// extractTarGzStream extracts a gzip-compressed tar archive while it is
+// read from r, e.g. during a download. Entries are checked as they arrive and
+// written to a staging directory next to destPath, which is moved into place
+// only once the whole archive has been accepted.
+//
+// The archive root is taken from the first entry, since forge archives wrap
+// the repository in a single <repo>-<ref>/ folder.
+func extractTarGzStream(r io.Reader, destPath string, opts ExtractOptions) error {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return fmt.Errorf("failed to open tar.gz archive: %w", err)
+	}
+	defer gz.Close()
+
+	parent := filepath.Dir(destPath)
+	err = os.MkdirAll(parent, 0755)
+	if err != nil {
+		return fmt.Errorf("failed to create directory %s: %w", parent, err)
+	}
+	staging, err := os.MkdirTemp(parent, "."+filepath.Base(destPath)+".extract-*")
+	if err != nil {
+		return fmt.Errorf("failed to create staging directory: %w", err)
+	}
+	defer func() { os.RemoveAll(staging) }()
+
+	policy := opts.policy()
+	budget := &byteBudget{limit: policy.MaxTotalBytes}
+	var planner *extractPlanner
+	var seen []archiveEntry
+	var symlinks []plannedEntry
+	written := 0
+
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read tar.gz archive: %w", err)
+		}
+		if header.Typeflag == tar.TypeXGlobalHeader {
+			continue
+		}
+
+		entry := tarEntry(header)
+		if planner == nil {
+			planner = newExtractPlanner(streamRoot(entry.Name), opts)
+		}
+		if !underRoot(entry.Name, planner.root) {
+			// The root was guessed from the first entry, but the archive has
+			// no single top-level folder after all
+			if opts.Subdir != "" || len(opts.Include) > 0 || len(opts.Exclude) > 0 {
+				return fmt.Errorf("failed to extract tar.gz archive: %s is outside the folder %s/ of the first entry; selecting a subdirectory or files needs a single top-level folder", entry.Name, planner.root)
+			}
+			staging, err = rerootStaging(staging, planner.root)
+			if err != nil {
+				return err
+			}
+			planner = newExtractPlanner("", opts)
+			symlinks = nil
+			for _, previous := range seen {
+				planned, ok := planner.plan(previous)
+				if ok && planned.Mode&os.ModeSymlink != 0 {
+					symlinks = append(symlinks, planned)
+				}
+			}
+		}
+		seen = append(seen, entry)
+
+		// Keep reading to report every rejected entry, but stop writing
+		planned, ok := planner.plan(entry)
+		if !ok || !planner.ok() {
+			continue
+		}
+
+		target := filepath.Join(staging, filepath.FromSlash(planned.RelPath))
+		switch {
+		case planned.Mode.IsDir():
+			err = mkdirNoClobber(target)
+		case planned.Mode&os.ModeSymlink != 0:
+			symlinks = append(symlinks, planned)
+		default:
+			planned.Open = func() (io.ReadCloser, error) {
+				return io.NopCloser(tr), nil
+			}
+			if err = mkdirNoClobber(filepath.Dir(target)); err == nil {
+				err = writeRegularFile(context.Background(), planned, staging, policy, budget)
+			}
+		}
+		if err != nil {
+			return err
+		}
+		written++
+	}
+
+	if planner == nil {
+		planner = newExtractPlanner("", opts)
+	}
+	if err := planner.finish(); err != nil {
+		return err
+	}
+	if written == 0 && opts.Subdir != "" {
+		return fmt.Errorf("template subdirectory %q not found in archive", opts.Subdir)
+	}
+
+	// Links are created last so no file is written through one
+	for _, entry := range symlinks {
+		target := filepath.Join(staging, filepath.FromSlash(entry.RelPath))
+		if err := checkNoSymlinks(staging, entry.RelPath); err != nil {
+			return err
+		}
+		if err := mkdirNoClobber(filepath.Dir(target)); err != nil {
+			return err
+		}
+		if err := os.Symlink(entry.Linkname, target); err != nil {
+			return fmt.Errorf("failed to create symlink %s: %w", entry.RelPath, err)
+		}
+	}
+
+	return moveTree(staging, destPath)
+}
+
+// streamRoot guesses the archive root from the first entry of a streamed
+// archive: the top-level folder it lives in, if any.
+func streamRoot(name string) string {
+	first, _, found := strings.Cut(strings.TrimPrefix(name, "./"), "/")
+	if !found {
+		return ""
+	}
+	return first
+}
+
+// rerootStaging moves what was extracted into staging so far below root in
+// a new staging directory, for when the guessed root turns out to be wrong.
+func rerootStaging(staging, root string) (string, error) {
+	parent := filepath.Dir(staging)
+	rerooted, err := os.MkdirTemp(parent, filepath.Base(staging)+"-*")
+	if err != nil {
+		return staging, fmt.Errorf("failed to create staging directory: %w", err)
+	}
+	err = os.Rename(staging, filepath.Join(rerooted, root))
+	if err != nil {
+		os.RemoveAll(rerooted)
+		return staging, fmt.Errorf("failed to move extracted files under %s: %w", root, err)
+	}
+	return rerooted, nil
+}
+
+func underRoot(name, root string) bool {
+	name = strings.TrimPrefix(name, "./")
+	return root == "" || name == root || strings.HasPrefix(name, root+"/")
+}
+
+// moveTree moves the contents of src into dst, merging directories that
+// already exist. Existing files are replaced, but existing symlinks are
+// never written through.
+func moveTree(src, dst string) error {
+	err := mkdirNoClobber(dst)
+	if err != nil {
+		return err
+	}
+
+	items, err := os.ReadDir(src)
+	if err != nil {
+		return err
+	}
+	for _, item := range items {
+		from := filepath.Join(src, item.Name())
+		to := filepath.Join(dst, item.Name())
+
+		info, err := os.Lstat(to)
+		switch {
+		case os.IsNotExist(err):
+			err = os.Rename(from, to)
+		case err != nil:
+		case info.Mode()&os.ModeSymlink != 0:
+			err = fmt.Errorf("refusing to write %s: it is a symlink", to)
+		case item.IsDir() && info.IsDir():
+			err = moveTree(from, to)
+		case item.IsDir() || info.IsDir():
+			err = fmt.Errorf("cannot replace %s: a file and a directory share the path", to)
+		default:
+			err = os.Rename(from, to)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// tarGzEntries reads the headers of a tar.gz archive without extracting it.
+// It also returns the position of each entry among the archive's headers.
+func tarGzEntries(archivePath string) ([]archiveEntry, []int, error) {
+	f, err := os.Open(archivePath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open archive: %w", err)
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open tar.gz archive: %w", err)
+	}
+	defer gz.Close()
+
+	var entries []archiveEntry
+	var positions []int
+	tr := tar.NewReader(gz)
+	for position := 0; ; position++ {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read tar.gz archive: %w", err)
+		}
+
+		// git archive stores the commit in a pax global header; it is not a file
+		if header.Typeflag == tar.TypeXGlobalHeader {
+			continue
+		}
+		entries = append(entries, tarEntry(header))
+		positions = append(positions, position)
+	}
+	return entries, positions, nil
+}
+
+// tarEntry converts a tar header into an archive entry without content.
+func tarEntry(header *tar.Header) archiveEntry {
+	entry := archiveEntry{
+		Name:     header.Name,
+		Mode:     header.FileInfo().Mode(),
+		Size:     header.Size,
+		Linkname: header.Linkname,
+	}
+
+	// FileInfo reports hard links as regular files with no content
+	if header.Typeflag == tar.TypeLink {
+		entry.Mode = os.ModeIrregular
+	}
+	return entry
+}
+
+// tarCursor streams the contents of a tar.gz archive entry by entry. Entries
+// must be requested in archive order, which writeEntries preserves.
+type tarCursor struct {
+	path  string
+	file  *os.File
+	gz    *gzip.Reader
+	tr    *tar.Reader
+	index int
+}
+
+func (c *tarCursor) seek(index int) (io.ReadCloser, error) {
+	if c.tr == nil {
+		f, err := os.Open(c.path)
+		if err != nil {
+			return nil, err
+		}
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		c.file, c.gz, c.tr = f, gz, tar.NewReader(gz)
+	}
+
+	if index <= c.index {
+		return nil, fmt.Errorf("tar entry %d requested out of order", index)
+	}
+	for c.index < index {
+		if _, err := c.tr.Next(); err != nil {
+			return nil, fmt.Errorf("failed to read tar.gz archive: %w", err)
+		}
+		c.index++
+	}
+	return io.NopCloser(c.tr), nil
+}
+
+func (c *tarCursor) Close() error {
+	if c.file == nil {
+		return nil
+	}
+	c.gz.Close()
+	return c.file.Close()
+}
+
+// extractEntries validates every entry against the extraction policy and,
+// if none is rejected, writes them below destPath. Entry names are taken
+// relative to root, which is stripped when non-empty.
+func extractEntries(entries []archiveEntry, root, destPath string, opts ExtractOptions) error {
+	planned, err := planExtraction(entries, root, opts)
+	if err != nil {
+		return err
+	}
+
+	if len(planned) == 0 && opts.Subdir != "" {
+		return fmt.Errorf("template subdirectory %q not found in archive", opts.Subdir)
+	}
+
+	return writeEntries(planned, destPath, opts.policy(), opts.workers())
+}
+
+// planExtraction maps entries onto their destination paths and checks them
+// against the policy. All problems are collected into a single ExtractError.
+func planExtraction(entries []archiveEntry, root string, opts ExtractOptions) ([]plannedEntry, error) {
+	planner := newExtractPlanner(root, opts)
+	var planned []plannedEntry
+	for _, entry := range entries {
+		if entry, ok := planner.plan(entry); ok {
+			planned = append(planned, entry)
+		}
+	}
+
+	if err := planner.finish(); err != nil {
+		return nil, err
+	}
+	return planned, nil
+}
+
+// extractPlanner checks archive entries one at a time, so the same rules
+// apply whether the archive is listed up front or streamed.
+type extractPlanner struct {
+	root       string
+	opts       ExtractOptions
+	policy     ExtractPolicy
+	rejected   *ExtractError
+	totalBytes int64
+	files      map[string]bool
+	paths      []plannedEntry
+}
+
+func newExtractPlanner(root string, opts ExtractOptions) *extractPlanner {
+	return &extractPlanner{
+		root:     root,
+		opts:     opts,
+		policy:   opts.policy(),
+		rejected: &ExtractError{},
+		files:    make(map[string]bool),
+	}
+}
+
+// plan returns the planned entry, or false when the entry is filtered out
+// or rejected. Rejections are reported by finish.
+func (p *extractPlanner) plan(entry archiveEntry) (plannedEntry, bool) {
+	if reason := unsafeEntryName(entry.Name); reason != "" {
+		p.rejected.reject(entry.Name, "%s", reason)
+		return plannedEntry{}, false
+	}
+
+	relPath, ok := p.opts.relativePath(entry.Name, entry.Mode.IsDir(), p.root)
+	if !ok {
+		return plannedEntry{}, false
+	}
+
+	switch {
+	case entry.Mode.IsDir():
+	case entry.Mode&os.ModeSymlink != 0:
+		if !p.policy.AllowSymlinks {
+			p.rejected.reject(entry.Name, "symlinks are not allowed")
+			return plannedEntry{}, false
+		}
+		if reason := unsafeSymlinkTarget(relPath, entry.Linkname); reason != "" {
+			p.rejected.reject(entry.Name, "%s", reason)
+			return plannedEntry{}, false
+		}
+	case entry.Mode.IsRegular():
+		if p.policy.MaxFileBytes > 0 && entry.Size > p.policy.MaxFileBytes {
+			p.rejected.reject(entry.Name, "size %d bytes exceeds the per-file limit of %d bytes", entry.Size, p.policy.MaxFileBytes)
+			return plannedEntry{}, false
+		}
+		p.totalBytes += entry.Size
+	default:
+		p.rejected.reject(entry.Name, "unsupported entry type: only files, directories and symlinks can be extracted")
+		return plannedEntry{}, false
+	}
+
+	if !entry.Mode.IsDir() {
+		p.files[relPath] = true
+	}
+	planned := plannedEntry{archiveEntry: entry, RelPath: relPath}
+	p.paths = append(p.paths, planned)
+	return planned, true
+}
+
+// ok reports whether no entry has been rejected so far.
+func (p *extractPlanner) ok() bool {
+	return len(p.rejected.Rejected) == 0
+}
+
+// finish runs the checks that need every entry and returns the
+// ExtractError listing all rejected entries, if any.
+func (p *extractPlanner) finish() error {
+	// A file and a directory cannot share a path
+	for _, entry := range p.paths {
+		for dir := path.Dir(entry.RelPath); dir != "."; dir = path.Dir(dir) {
+			if p.files[dir] {
+				p.rejected.reject(entry.Name, "parent directory %s is also a file in the archive", dir)
+				break
+			}
+		}
+	}
+
+	// Each target was checked on its own, so one may still escape through
+	// another link, e.g. b -> x/a/.. with x/a -> ..
+	links := make(map[string]bool)
+	for _, entry := range p.paths {
+		if entry.Mode&os.ModeSymlink != 0 {
+			links[entry.RelPath] = true
+		}
+	}
+	for _, entry := range p.paths {
+		if entry.Mode&os.ModeSymlink == 0 {
+			continue
+		}
+		if link := symlinkTargetThroughLink(entry.RelPath, entry.Linkname, links); link != "" {
+			p.rejected.reject(entry.Name, "symlink target %s goes through the symlink %s", entry.Linkname, link)
+		}
+	}
+
+	if p.policy.MaxTotalBytes > 0 && p.totalBytes > p.policy.MaxTotalBytes {
+		p.rejected.reject("(archive)", "total size %d bytes exceeds the limit of %d bytes", p.totalBytes, p.policy.MaxTotalBytes)
+	}
+
+	if len(p.rejected.Rejected) > 0 {
+		return p.rejected
+	}
+	return nil
+}
+
+// unsafeEntryName returns why an entry name may not be extracted, or "".
+func unsafeEntryName(name string) string {
+	switch {
+	case name == "":
+		return "empty name"
+	case strings.Contains(name, "\\"):
+		return "name contains a backslash"
+	case strings.HasPrefix(name, "/") || filepath.VolumeName(name) != "":
+		return "absolute path"
+	}
+	for _, segment := range strings.Split(name, "/") {
+		if segment == ".." {
+			return "path traverses outside the destination"
+		}
+	}
+	return ""
+}
+
+// unsafeSymlinkTarget returns why a symlink at relPath pointing to target may
+// not be created, or "". Only relative targets inside the destination pass.
+func unsafeSymlinkTarget(relPath, target string) string {
+	if target == "" {
+		return "symlink has an empty target"
+	}
+	if strings.HasPrefix(target, "/") || filepath.VolumeName(target) != "" {
+		return fmt.Sprintf("symlink target %s is absolute", target)
+	}
+	resolved := path.Join(path.Dir(relPath), target)
+	if resolved == ".." || strings.HasPrefix(resolved, "../") {
+		return fmt.Sprintf("symlink target %s escapes the destination", target)
+	}
+	return ""
+}
+
+// symlinkTargetThroughLink returns the first of links that the target of
+// the symlink at relPath passes through on its way, or "". A target ending
+// at a link is fine, as that link's own target is checked too.
+func symlinkTargetThroughLink(relPath, target string, links map[string]bool) string {
+	var parts []string
+	if dir := path.Dir(relPath); dir != "." {
+		parts = strings.Split(dir, "/")
+	}
+	segments := strings.Split(target, "/")
+	last := -1
+	for i, segment := range segments {
+		if segment != "" && segment != "." {
+			last = i
+		}
+	}
+	for i, segment := range segments[:last+1] {
+		switch segment {
+		case "", ".":
+			continue
+		case "..":
+			if len(parts) > 0 {
+				parts = parts[:len(parts)-1]
+			}
+			continue
+		}
+		parts = append(parts, segment)
+		if current := strings.Join(parts, "/"); i < last && links[current] {
+			return current
+		}
+	}
+	return ""
+}
+
+// writeEntries writes planned entries to disk: directories first, then
+// regular files, then symlinks so no file is ever written through a link
+// created by the same archive. Regular files are written by up to workers
+// goroutines once every directory exists.
+func writeEntries(planned []plannedEntry, destPath string, policy ExtractPolicy, workers int) error {
+	var files, symlinks []plannedEntry
+	dirs := make(map[string]bool)
+	for _, entry := range planned {
+		switch {
+		case entry.Mode.IsDir():
+			dirs[entry.RelPath] = true
+		case entry.Mode&os.ModeSymlink != 0:
+			symlinks = append(symlinks, entry)
+			dirs[path.Dir(entry.RelPath)] = true
+		default:
+			files = append(files, entry)
+			dirs[path.Dir(entry.RelPath)] = true
+		}
+	}
+
+	// Create every directory up front so workers never race on MkdirAll
+	dirList := make([]string, 0, len(dirs))
+	for dir := range dirs {
+		dirList = append(dirList, dir)
+	}
+	sort.Strings(dirList)
+	for _, dir := range dirList {
+		if dir != "." {
+			if err := checkNoSymlinks(destPath, dir); err != nil {
+				return err
+			}
+		}
+		if err := mkdirNoClobber(filepath.Join(destPath, filepath.FromSlash(dir))); err != nil {
+			return err
+		}
+	}
+
+	budget := &byteBudget{limit: policy.MaxTotalBytes}
+	err := writeFiles(files, destPath, policy, budget, workers)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range symlinks {
+		target := filepath.Join(destPath, filepath.FromSlash(entry.RelPath))
+		if err := checkNoSymlinks(destPath, entry.RelPath); err != nil {
+			return err
+		}
+		if err := os.Symlink(entry.Linkname, target); err != nil {
+			return fmt.Errorf("failed to create symlink %s: %w", entry.RelPath, err)
+		}
+	}
+
+	return nil
+}
+
+// writeFiles writes regular files using a bounded pool of workers. The
+// first error cancels the remaining writes.
+func writeFiles(files []plannedEntry, destPath string, policy ExtractPolicy, budget *byteBudget, workers int) error {
+	if workers > len(files) {
+		workers = len(files)
+	}
+	if workers <= 1 {
+		for _, entry := range files {
+			if err := writeRegularFile(context.Background(), entry, destPath, policy, budget); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		firstErr error
+	)
+	jobs := make(chan plannedEntry)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for entry := range jobs {
+				if err := writeRegularFile(ctx, entry, destPath, policy, budget); err != nil {
+					errOnce.Do(func() {
+						firstErr = err
+						cancel()
+					})
+				}
+			}
+		}()
+	}
+
+feed:
+	for _, entry := range files {
+		select {
+		case jobs <- entry:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	return firstErr
+}
+
+// byteBudget tracks the decompressed bytes written for an archive. It is
+// shared by all workers.
+type byteBudget struct {
+	limit   int64
+	written atomic.Int64
+}
+
+var errBudgetExceeded = errors.New("archive size budget exceeded")
+
+// budgetWriter charges every write against a byte budget.
+type budgetWriter struct {
+	w      io.Writer
+	budget *byteBudget
+}
+
+func (b budgetWriter) Write(p []byte) (int, error) {
+	if written := b.budget.written.Add(int64(len(p))); b.budget.limit > 0 && written > b.budget.limit {
+		return 0, errBudgetExceeded
+	}
+	return b.w.Write(p)
+}
+
+// contextReader stops a copy once its context is cancelled.
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (c contextReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.r.Read(p)
+}
+
+// writeRegularFile copies a single file entry below destPath, enforcing the
+// size limits on the bytes actually decompressed rather than the declared size.
+func writeRegularFile(ctx context.Context, entry plannedEntry, destPath string, policy ExtractPolicy, budget *byteBudget) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := checkNoSymlinks(destPath, entry.RelPath); err != nil {
+		return err
+	}
+	target := filepath.Join(destPath, filepath.FromSlash(entry.RelPath))
+
+	rc, err := entry.Open()
+	if err != nil {
+		return fmt.Errorf("failed to open %s in archive: %w", entry.Name, err)
+	}
+	defer rc.Close()
+
+	perm := entry.Mode.Perm()
+	if perm == 0 {
+		perm = 0644
+	}
+
+	destFile, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return fmt.Errorf("failed to create file: %w", err)
+	}
+	defer destFile.Close()
+
+	var src io.Reader = contextReader{ctx: ctx, r: rc}
+	if policy.MaxFileBytes > 0 {
+		src = io.LimitReader(src, policy.MaxFileBytes+1)
+	}
+
+	n, err := io.Copy(budgetWriter{w: destFile, budget: budget}, src)
+	if errors.Is(err, errBudgetExceeded) {
+		return &ExtractError{Rejected: []RejectedEntry{{
+			Name:   entry.Name,
+			Reason: fmt.Sprintf("decompressed archive size exceeds the limit of %d bytes", budget.limit),
+		}}}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to extract file %s: %w", entry.Name, err)
+	}
+	if policy.MaxFileBytes > 0 && n > policy.MaxFileBytes {
+		return &ExtractError{Rejected: []RejectedEntry{{
+			Name:   entry.Name,
+			Reason: fmt.Sprintf("decompressed size exceeds the limit of %d bytes", policy.MaxFileBytes),
+		}}}
+	}
+
+	return nil
+}
+
+// mkdirNoClobber creates dir and its parents, failing instead of deleting
+// anything when a non-directory already occupies one of the paths.
+func mkdirNoClobber(dir string) error {
+	if info, err := os.Stat(dir); err == nil && !info.IsDir() {
+		return fmt.Errorf("cannot create directory %s: a file with that name already exists", dir)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create directory %s: %w", dir, err)
+	}
+	return nil
+}
+
+// checkNoSymlinks makes sure no existing path between destPath and relPath
+// (inclusive) is a symlink, which could redirect the write elsewhere.
+func checkNoSymlinks(destPath, relPath string) error {
+	current := destPath
+	for _, segment := range strings.Split(relPath, "/") {
+		current = filepath.Join(current, segment)
+		info, err := os.Lstat(current)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			return fmt.Errorf("refusing to write %s: %s is a symlink", relPath, current)
+		}
+	}
+	return nil
+}
+
+// entriesRoot returns the top-level folder wrapping every entry of an
+// archive. GitHub archives put everything in a single <repo>-<ref>/ folder.
+func entriesRoot(entries []archiveEntry) string {
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		names = append(names, entry.Name)
+	}
+	return archiveRoot(names)
+}
+
+// archiveRoot returns the single top-level directory shared by every entry
+// name, or "" if the entries do not all live under one directory.
+func archiveRoot(names []string) string {
+	root := ""
+	for _, name := range names {
+		first, _, found := strings.Cut(strings.TrimPrefix(name, "./"), "/")
+		if !found || (root != "" && first != root) {
+			return ""
+		}
+		root = first
+	}
+	return root
+}
+
+// relativePath maps an archive entry name onto the slash-separated path it
+// should be extracted to, relative to the destination. It reports false for
+// the root entry itself and for entries filtered out by the options.
+func (o ExtractOptions) relativePath(name string, isDir bool, root string) (string, bool) {
+	name = strings.TrimPrefix(name, "./")
+	if root != "" {
+		name = strings.TrimPrefix(name, root+"/")
+	}
+	name = strings.TrimSuffix(name, "/")
+
+	if subdir := strings.Trim(filepath.ToSlash(o.Subdir), "/"); subdir != "" {
+		subdir = path.Clean(subdir)
+		if name != subdir && !strings.HasPrefix(name, subdir+"/") {
+			return "", false
+		}
+		name = strings.TrimPrefix(strings.TrimPrefix(name, subdir), "/")
+	}
+
+	if name == "" {
+		return "", false
+	}
+
+	for _, pattern := range o.Exclude {
+		if matchGlob(pattern, name) {
+			return "", false
+		}
+	}
+
+	// Directories are created on demand for included files
+	if len(o.Include) > 0 {
+		if isDir {
+			return "", false
+		}
+		included := false
+		for _, pattern := range o.Include {
+			if matchGlob(pattern, name) {
+				included = true
+				break
+			}
+		}
+		if !included {
+			return "", false
+		}
+	}
+
+	return name, true
+}
+
+// matchGlob reports whether name, a slash-separated relative path, matches
+// pattern. Segments use path.Match syntax and "**" matches any number of
+// segments. As with .gitignore, a pattern without a slash matches at any
+// depth, and a pattern matching a directory also matches everything below it.
+func matchGlob(pattern, name string) bool {
+	pattern = strings.Trim(filepath.ToSlash(pattern), "/")
+	if pattern == "" {
+		return false
+	}
+	if !strings.Contains(pattern, "/") {
+		pattern = "**/" + pattern
+	}
+
+	patternSegments := strings.Split(pattern, "/")
+	nameSegments := strings.Split(name, "/")
+	for i := len(nameSegments); i > 0; i-- {
+		if matchSegments(patternSegments, nameSegments[:i]) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
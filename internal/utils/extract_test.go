@@ -0,0 +1,427 @@
+package utils
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+type testArchiveEntry struct {
+	name string
+	body string
+	mode os.FileMode
+}
+
+func buildZip(t testing.TB, entries []testArchiveEntry) string {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, e := range entries {
+		header := &zip.FileHeader{Name: e.name, Method: zip.Deflate}
+		mode := e.mode
+		if mode == 0 {
+			mode = 0644
+			if strings.HasSuffix(e.name, "/") {
+				mode = os.ModeDir | 0755
+			}
+		}
+		header.SetMode(mode)
+		w, err := zw.CreateHeader(header)
+		if err != nil {
+			t.Fatalf("error creating zip entry %s. Err: %v", e.name, err)
+		}
+		if _, err := w.Write([]byte(e.body)); err != nil {
+			t.Fatalf("error writing zip entry %s. Err: %v", e.name, err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("error closing zip. Err: %v", err)
+	}
+
+	zipPath := filepath.Join(t.TempDir(), "template.zip")
+	if err := os.WriteFile(zipPath, buf.Bytes(), 0644); err != nil {
+		t.Fatalf("error writing zip. Err: %v", err)
+	}
+	return zipPath
+}
+
+func buildTarGz(t testing.TB, entries []testArchiveEntry) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for _, e := range entries {
+		header := &tar.Header{Name: e.name, Mode: 0644, Typeflag: tar.TypeReg, Size: int64(len(e.body))}
+		switch {
+		case strings.HasSuffix(e.name, "/"):
+			header.Typeflag, header.Mode, header.Size = tar.TypeDir, 0755, 0
+		case e.mode&os.ModeSymlink != 0:
+			header.Typeflag, header.Linkname, header.Size = tar.TypeSymlink, e.body, 0
+		case e.mode != 0:
+			header.Mode = int64(e.mode.Perm())
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			t.Fatalf("error writing tar header %s. Err: %v", e.name, err)
+		}
+		if header.Typeflag == tar.TypeReg {
+			if _, err := tw.Write([]byte(e.body)); err != nil {
+				t.Fatalf("error writing tar entry %s. Err: %v", e.name, err)
+			}
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("error closing tar. Err: %v", err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatalf("error closing gzip. Err: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestExtractStripsArchiveRoot(t *testing.T) {
+	zipPath := buildZip(t, []testArchiveEntry{
+		{name: "nx-master/"},
+		{name: "nx-master/package.json", body: "{}"},
+		{name: "nx-master/examples/react-vite/package.json", body: `{"name":"vite"}`},
+		{name: "nx-master/examples/react-vite/README.md", body: "readme"},
+		{name: "nx-master/examples/react-vite/src/main.tsx", body: "main"},
+	})
+
+	dest := t.TempDir()
+	if err := extractZipFile(zipPath, dest, ExtractOptions{}); err != nil {
+		t.Fatalf("error extracting archive. Err: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dest, "package.json")); err != nil {
+		t.Errorf("expected package.json at the destination root; got %v", err)
+	}
+
+	dest = t.TempDir()
+	opts := ExtractOptions{Subdir: "examples/react-vite", Exclude: []string{"*.md"}}
+	if err := extractZipFile(zipPath, dest, opts); err != nil {
+		t.Fatalf("error extracting subdirectory. Err: %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(dest, "package.json"))
+	if err != nil || string(data) != `{"name":"vite"}` {
+		t.Errorf("expected the subdirectory package.json; got %q (%v)", data, err)
+	}
+	if _, err := os.Stat(filepath.Join(dest, "README.md")); !os.IsNotExist(err) {
+		t.Errorf("expected README.md to be excluded; got %v", err)
+	}
+
+	opts = ExtractOptions{Subdir: "examples/missing"}
+	if err := extractZipFile(zipPath, t.TempDir(), opts); err == nil {
+		t.Errorf("expected an error for a missing subdirectory")
+	}
+}
+
+func TestMatchGlob(t *testing.T) {
+	tests := []struct {
+		pattern string
+		name    string
+		want    bool
+	}{
+		{"*.md", "README.md", true},
+		{"*.md", "docs/guide/intro.md", true},
+		{"node_modules", "packages/a/node_modules/x/index.js", true},
+		{"src/**/*.ts", "src/a/b/c.ts", true},
+		{"src/**/*.ts", "src/c.ts", true},
+		{"src/**/*.ts", "lib/c.ts", false},
+		{"docs", "docs/guide/intro.md", true},
+		{"docs/*.md", "docs/guide/intro.md", false},
+	}
+	for _, tt := range tests {
+		if got := matchGlob(tt.pattern, tt.name); got != tt.want {
+			t.Errorf("matchGlob(%q, %q): expected %v; got %v", tt.pattern, tt.name, tt.want, got)
+		}
+	}
+}
+
+func TestExtractRejectsUnsafeEntries(t *testing.T) {
+	zipPath := buildZip(t, []testArchiveEntry{
+		{name: "../evil.sh", body: "boom"},
+		{name: "/etc/passwd", body: "root"},
+		{name: "repo/link", body: "../../outside", mode: os.ModeSymlink | 0777},
+		{name: "repo/ok.txt", body: "ok"},
+	})
+
+	dest := t.TempDir()
+	err := extractZipFile(zipPath, dest, ExtractOptions{})
+	var extractErr *ExtractError
+	if !errors.As(err, &extractErr) {
+		t.Fatalf("expected an ExtractError; got %v", err)
+	}
+	if len(extractErr.Rejected) != 3 {
+		t.Errorf("expected 3 rejected entries; got %d: %v", len(extractErr.Rejected), err)
+	}
+	if entries, _ := os.ReadDir(dest); len(entries) != 0 {
+		t.Errorf("expected nothing to be written for a rejected archive; got %d entries", len(entries))
+	}
+}
+
+func TestExtractRejectsChainedSymlinks(t *testing.T) {
+	// x/a points at the destination itself, so x/a/.. is its parent
+	entries := []testArchiveEntry{
+		{name: "repo/x/a", body: "..", mode: os.ModeSymlink | 0777},
+		{name: "repo/b", body: "x/a/..", mode: os.ModeSymlink | 0777},
+		{name: "repo/c", body: "x/a", mode: os.ModeSymlink | 0777},
+		{name: "repo/ok.txt", body: "ok"},
+	}
+
+	dest := t.TempDir()
+	err := extractZipFile(buildZip(t, entries), dest, ExtractOptions{})
+	var extractErr *ExtractError
+	if !errors.As(err, &extractErr) {
+		t.Fatalf("expected an ExtractError; got %v", err)
+	}
+	if len(extractErr.Rejected) != 1 || !strings.Contains(err.Error(), "repo/b") {
+		t.Errorf("expected only the chained link b to be rejected; got %v", err)
+	}
+
+	err = extractTarGzStream(bytes.NewReader(buildTarGz(t, entries)), filepath.Join(t.TempDir(), "workspace"), ExtractOptions{})
+	if !errors.As(err, &extractErr) {
+		t.Errorf("expected the streamed archive to be rejected too; got %v", err)
+	}
+}
+
+func TestExtractSymlinksAndModes(t *testing.T) {
+	zipPath := buildZip(t, []testArchiveEntry{
+		{name: "repo/bin/run.sh", body: "#!/bin/sh\n", mode: 0755},
+		{name: "repo/bin/current", body: "run.sh", mode: os.ModeSymlink | 0777},
+	})
+
+	dest := t.TempDir()
+	if err := extractZipFile(zipPath, dest, ExtractOptions{}); err != nil {
+		t.Fatalf("error extracting archive. Err: %v", err)
+	}
+
+	info, err := os.Stat(filepath.Join(dest, "bin", "run.sh"))
+	if err != nil {
+		t.Fatalf("error reading extracted file. Err: %v", err)
+	}
+	if info.Mode().Perm()&0100 == 0 {
+		t.Errorf("expected run.sh to stay executable; got %v", info.Mode())
+	}
+	if target, err := os.Readlink(filepath.Join(dest, "bin", "current")); err != nil || target != "run.sh" {
+		t.Errorf("expected symlink to run.sh; got %q (%v)", target, err)
+	}
+
+	noLinks := ExtractPolicy{AllowSymlinks: false}
+	if err := extractZipFile(zipPath, t.TempDir(), ExtractOptions{Policy: &noLinks}); err == nil {
+		t.Errorf("expected symlinks to be rejected by the policy")
+	}
+}
+
+func TestExtractEnforcesSizeLimits(t *testing.T) {
+	zipPath := buildZip(t, []testArchiveEntry{
+		{name: "repo/a.txt", body: strings.Repeat("a", 600)},
+		{name: "repo/b.txt", body: strings.Repeat("b", 600)},
+	})
+
+	perFile := ExtractPolicy{MaxFileBytes: 500}
+	if err := extractZipFile(zipPath, t.TempDir(), ExtractOptions{Policy: &perFile}); err == nil {
+		t.Errorf("expected the per-file limit to be enforced")
+	}
+
+	total := ExtractPolicy{MaxTotalBytes: 1000}
+	if err := extractZipFile(zipPath, t.TempDir(), ExtractOptions{Policy: &total}); err == nil {
+		t.Errorf("expected the total size limit to be enforced")
+	}
+
+	// Declared sizes can lie, so the limit must also hold while copying
+	entries := []archiveEntry{{
+		Name: "bomb.txt",
+		Mode: 0644,
+		Size: 10,
+		Open: func() (io.ReadCloser, error) {
+			return io.NopCloser(strings.NewReader(strings.Repeat("x", 2048))), nil
+		},
+	}}
+	if err := extractEntries(entries, "", t.TempDir(), ExtractOptions{Policy: &perFile}); err == nil {
+		t.Errorf("expected the limit to be enforced on decompressed bytes")
+	}
+}
+
+func TestExtractTarGzStream(t *testing.T) {
+	archive := buildTarGz(t, []testArchiveEntry{
+		{name: "repo-abc/"},
+		{name: "repo-abc/package.json", body: "{}"},
+		{name: "repo-abc/examples/web/index.ts", body: "web"},
+		{name: "repo-abc/examples/web/current", body: "index.ts", mode: os.ModeSymlink | 0777},
+	})
+
+	parent := t.TempDir()
+	dest := filepath.Join(parent, "workspace")
+	if err := os.MkdirAll(dest, 0755); err != nil {
+		t.Fatalf("error creating destination. Err: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dest, "keep.txt"), []byte("keep"), 0644); err != nil {
+		t.Fatalf("error writing existing file. Err: %v", err)
+	}
+
+	opts := ExtractOptions{Subdir: "examples/web"}
+	if err := extractTarGzStream(bytes.NewReader(archive), dest, opts); err != nil {
+		t.Fatalf("error extracting stream. Err: %v", err)
+	}
+	if data, err := os.ReadFile(filepath.Join(dest, "index.ts")); err != nil || string(data) != "web" {
+		t.Errorf("expected index.ts from the subdirectory; got %q (%v)", data, err)
+	}
+	if target, err := os.Readlink(filepath.Join(dest, "current")); err != nil || target != "index.ts" {
+		t.Errorf("expected symlink to index.ts; got %q (%v)", target, err)
+	}
+	if _, err := os.Stat(filepath.Join(dest, "keep.txt")); err != nil {
+		t.Errorf("expected existing files to be kept; got %v", err)
+	}
+
+	unsafe := buildTarGz(t, []testArchiveEntry{
+		{name: "repo-abc/"},
+		{name: "repo-abc/ok.txt", body: "ok"},
+		{name: "repo-abc/../../evil.sh", body: "boom"},
+		{name: "other/file.txt", body: "outside"},
+		{name: "/etc/passwd", body: "absolute"},
+	})
+	dest = filepath.Join(parent, "rejected")
+	err := extractTarGzStream(bytes.NewReader(unsafe), dest, ExtractOptions{})
+	var extractErr *ExtractError
+	if !errors.As(err, &extractErr) || len(extractErr.Rejected) != 2 {
+		t.Fatalf("expected an ExtractError with 2 entries; got %v", err)
+	}
+	if _, err := os.Stat(dest); !os.IsNotExist(err) {
+		t.Errorf("expected nothing to be written for a rejected archive; got %v", err)
+	}
+	if entries, _ := os.ReadDir(parent); len(entries) != 1 {
+		t.Errorf("expected the staging directory to be removed; got %d entries", len(entries))
+	}
+}
+
+func TestExtractTarGzStreamWithoutSingleRoot(t *testing.T) {
+	// The first entries all live in repo/, so the root is only known to be
+	// wrong once README.md is read
+	archive := buildTarGz(t, []testArchiveEntry{
+		{name: "repo/"},
+		{name: "repo/a.txt", body: "a"},
+		{name: "repo/bin/current", body: "../a.txt", mode: os.ModeSymlink | 0777},
+		{name: "README.md", body: "readme"},
+	})
+
+	dest := filepath.Join(t.TempDir(), "workspace")
+	if err := extractTarGzStream(bytes.NewReader(archive), dest, ExtractOptions{}); err != nil {
+		t.Fatalf("error extracting stream. Err: %v", err)
+	}
+	for name, expected := range map[string]string{"repo/a.txt": "a", "README.md": "readme"} {
+		if data, err := os.ReadFile(filepath.Join(dest, name)); err != nil || string(data) != expected {
+			t.Errorf("expected %s to contain %q; got %q (%v)", name, expected, data, err)
+		}
+	}
+	if target, err := os.Readlink(filepath.Join(dest, "repo", "bin", "current")); err != nil || target != "../a.txt" {
+		t.Errorf("expected symlink to ../a.txt; got %q (%v)", target, err)
+	}
+
+	err := extractTarGzStream(bytes.NewReader(archive), filepath.Join(t.TempDir(), "workspace"), ExtractOptions{Subdir: "bin"})
+	if err == nil {
+		t.Errorf("expected an error selecting a subdirectory of an archive without a single root")
+	}
+}
+
+func TestExtractZipInParallel(t *testing.T) {
+	var files []testArchiveEntry
+	for i := 0; i < 50; i++ {
+		files = append(files, testArchiveEntry{
+			name: fmt.Sprintf("repo/pkg%d/src/file%d.ts", i%7, i),
+			body: strings.Repeat(strconv.Itoa(i), 100),
+		})
+	}
+	zipPath := buildZip(t, files)
+
+	dest := t.TempDir()
+	if err := extractZipFile(zipPath, dest, ExtractOptions{Workers: 8}); err != nil {
+		t.Fatalf("error extracting archive. Err: %v", err)
+	}
+	for i, file := range files {
+		data, err := os.ReadFile(filepath.Join(dest, strings.TrimPrefix(file.name, "repo/")))
+		if err != nil || string(data) != file.body {
+			t.Fatalf("file %d: expected its content to be extracted; got %v", i, err)
+		}
+	}
+
+	// Every worker shares the size budget, and exceeding it stops them all
+	total := ExtractPolicy{MaxTotalBytes: 1000}
+	entries := make([]archiveEntry, 20)
+	for i := range entries {
+		entries[i] = archiveEntry{
+			Name: fmt.Sprintf("file%d.txt", i),
+			Mode: 0644,
+			Open: func() (io.ReadCloser, error) {
+				return io.NopCloser(strings.NewReader(strings.Repeat("x", 200))), nil
+			},
+		}
+	}
+	err := extractEntries(entries, "", t.TempDir(), ExtractOptions{Policy: &total, Workers: 4})
+	var extractErr *ExtractError
+	if !errors.As(err, &extractErr) {
+		t.Errorf("expected the shared budget to be enforced; got %v", err)
+	}
+}
+
+// benchmarkArchiveEntries returns a template-sized tree of small files.
+func benchmarkArchiveEntries() []testArchiveEntry {
+	body := strings.Repeat("export const value = 42;\n", 400)
+	entries := []testArchiveEntry{{name: "nx-master/"}}
+	for i := 0; i < 2000; i++ {
+		entries = append(entries, testArchiveEntry{
+			name: fmt.Sprintf("nx-master/packages/pkg%d/src/file%d.ts", i%40, i),
+			body: body,
+		})
+	}
+	return entries
+}
+
+// BenchmarkExtractZip compares sequential extraction, as done before
+// workers were introduced, with the parallel writer.
+func BenchmarkExtractZip(b *testing.B) {
+	zipPath := buildZip(b, benchmarkArchiveEntries())
+
+	for _, workers := range []int{1, 4, 16} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if err := extractZipFile(zipPath, b.TempDir(), ExtractOptions{Workers: workers}); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkExtractTarGz compares saving the archive and extracting it in
+// two passes with extracting it while it is read.
+func BenchmarkExtractTarGz(b *testing.B) {
+	archive := buildTarGz(b, benchmarkArchiveEntries())
+
+	b.Run("download-then-extract", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			archivePath := filepath.Join(b.TempDir(), "template.tar.gz")
+			if err := os.WriteFile(archivePath, archive, 0644); err != nil {
+				b.Fatal(err)
+			}
+			if err := extractTarGzFile(archivePath, b.TempDir(), ExtractOptions{}); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("stream", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			dest := filepath.Join(b.TempDir(), "workspace")
+			if err := extractTarGzStream(bytes.NewReader(archive), dest, ExtractOptions{}); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
@@ -1,7 +1,6 @@
 package utils
 
 import (
-	"archive/zip"
 	"context"
 	"encoding/json"
 	"fmt"
@@ -10,146 +9,53 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
-
-	"github.com/google/go-github/v53/github"
-	"golang.org/x/oauth2"
 )
 
-// FetchGitHubRepo fetches the contents of a GitHub repository and writes it to a file.
-func FetchGitHubRepo(ctx context.Context, owner, repo, filePath string) error {
-	// Create a new GitHub client
-	ts := oauth2.StaticTokenSource(
-		&oauth2.Token{AccessToken: os.Getenv("GITHUB_TOKEN")},
-	)
-	tc := oauth2.NewClient(ctx, ts)
-	client := github.NewClient(tc)
-
-	// Get the file content from the repository
-	fileContent, _, _, err := client.Repositories.GetContents(ctx, owner, repo, filePath, nil)
-	if err != nil {
-		return fmt.Errorf("error fetching file from GitHub: %w", err)
-	}
-
-	// Decode the content
-	content, err := fileContent.GetContent()
-	if err != nil {
-		return fmt.Errorf("error decoding file content: %w", err)
-	}
-
-	// Write the content to a local file
-	err = os.WriteFile(filePath, []byte(content), 0644)
-	if err != nil {
-		return fmt.Errorf("error writing file to disk: %w", err)
-	}
-
-	return nil
+// GitHubProvider downloads templates from github.com through the REST API.
+type GitHubProvider struct {
+	session *githubSession
 }
 
-// FetchNxTemplate downloads an entire Nx workspace template
-func FetchNxTemplate(ctx context.Context, owner, repo, branch string, destPath string) error {
-	// Download repository as ZIP archive
-	url := fmt.Sprintf("https://github.com/%s/%s/archive/refs/heads/%s.zip", owner, repo, branch)
-
-	resp, err := http.Get(url)
-	if err != nil {
-		return fmt.Errorf("failed to download repository: %w", err)
+// NewGitHubProvider creates a GitHub provider. An empty token falls back to
+// the sources checked by ResolveGitHubCredential.
+func NewGitHubProvider(token string) *GitHubProvider {
+	if token != "" {
+		return &GitHubProvider{session: newGitHubSession(Credential{Token: token, Source: "provider configuration"})}
 	}
-	defer resp.Body.Close()
-
-	// Save and extract the ZIP file
-	return extractZipArchive(resp.Body, destPath)
+	return &GitHubProvider{session: defaultGitHubSession()}
 }
 
-// extractZipArchive saves and extracts a ZIP archive from the response body to the destination path.
-func extractZipArchive(reader io.Reader, destPath string) error {
-	// Create a temporary file
-	tmpFile, err := os.CreateTemp("", "*.zip")
-	if err != nil {
-		return fmt.Errorf("failed to create temporary file: %w", err)
-	}
-	defer os.Remove(tmpFile.Name()) // Clean up
-
-	// Write the ZIP file to the temporary location
-	_, err = io.Copy(tmpFile, reader)
-	if err != nil {
-		return fmt.Errorf("failed to save ZIP file: %w", err)
-	}
-
-	// Close the temporary file
-	err = tmpFile.Close()
-	if err != nil {
-		return fmt.Errorf("failed to close temporary file: %w", err)
-	}
+func (p *GitHubProvider) Name() string             { return "github" }
+func (p *GitHubProvider) Host() string             { return githubHost }
+func (p *GitHubProvider) HTTPClient() *http.Client { return p.session.http }
+func (p *GitHubProvider) Credential() Credential   { return p.session.cred }
 
-	// Open the ZIP file
-	zipReader, err := zip.OpenReader(tmpFile.Name())
+// ResolveRef returns the commit SHA a branch, tag or (abbreviated) commit
+// SHA points to.
+func (p *GitHubProvider) ResolveRef(ctx context.Context, owner, repo, ref string) (string, error) {
+	commit, _, err := p.session.api.Repositories.GetCommitSHA1(ctx, owner, repo, ref, "")
 	if err != nil {
-		return fmt.Errorf("failed to open ZIP file: %w", err)
+		return "", fmt.Errorf("failed to resolve ref %s of %s/%s: %w", ref, owner, repo, explainGitHubError(err, p.session.cred))
 	}
-	defer zipReader.Close()
-
-	// Extract each file in the ZIP archive
-	for _, file := range zipReader.File {
-		err := extractFile(file, destPath)
-		if err != nil {
-			return err
-		}
-	}
-
-	return nil
+	return commit, nil
 }
 
-// extractFile extracts a single file from the ZIP archive.
-func extractFile(file *zip.File, destPath string) error {
-	// Open the file inside the ZIP archive
-	rc, err := file.Open()
-	if err != nil {
-		return fmt.Errorf("failed to open file in ZIP archive: %w", err)
-	}
-	defer rc.Close()
-
-	// Create the destination file path
-	destFilePath := filepath.Join(destPath, file.Name)
-
-	// Skip if this is a directory entry
-	if file.FileInfo().IsDir() {
-		return os.MkdirAll(destFilePath, 0755)
-	}
-
-	// Get the directory for the file
-	destDir := filepath.Dir(destFilePath)
-
-	// Check if there's a file blocking the directory creation
-	if info, err := os.Stat(destDir); err == nil && !info.IsDir() {
-		// Remove the blocking file
-		err = os.Remove(destDir)
-		if err != nil {
-			return fmt.Errorf("failed to remove blocking file %s: %w", destDir, err)
-		}
-	}
-
-	// Ensure the directory exists
-	err = os.MkdirAll(destDir, 0755)
-	if err != nil {
-		return fmt.Errorf("failed to create directory %s: %w", destDir, err)
-	}
-
-	// Create the destination file
-	destFile, err := os.Create(destFilePath)
-	if err != nil {
-		return fmt.Errorf("failed to create file: %w", err)
-	}
-	defer destFile.Close()
+// ArchiveURL uses the API zipball endpoint so private repositories work
+// with the same credentials as the API.
+func (p *GitHubProvider) ArchiveURL(owner, repo, commit string) string {
+	return fmt.Sprintf("%srepos/%s/%s/zipball/%s", p.session.api.BaseURL, owner, repo, commit)
+}
 
-	// Copy the content to the destination file
-	_, err = io.Copy(destFile, rc)
-	if err != nil {
-		return fmt.Errorf("failed to extract file: %w", err)
-	}
+func (p *GitHubProvider) TarballURL(owner, repo, commit string) string {
+	return fmt.Sprintf("%srepos/%s/%s/tarball/%s", p.session.api.BaseURL, owner, repo, commit)
+}
 
-	return nil
+func (p *GitHubProvider) ParseRepoURL(raw string) (*RepoLocation, bool) {
+	return parseHostedRepoURL(raw, p.Name(), githubHost, false)
 }
 
+const githubHost = "github.com"
+
 // ConfigureReactApp customizes the downloaded Nx workspace for React
 func ConfigureReactApp(workspacePath, appName string) error {
 	// Update package.json with new app name
@@ -335,9 +241,8 @@ func updateSingleProjectJson(projectJsonPath, appName, projectDir string) error
 	// Update sourceRoot if it exists
 	if sourceRoot, exists := projectConfig["sourceRoot"]; exists {
 		if sourceRootStr, ok := sourceRoot.(string); ok {
-			// Replace any template placeholders with actual app name
-			updatedSourceRoot := strings.ReplaceAll(sourceRootStr, "my-app", appName)
-			projectConfig["sourceRoot"] = updatedSourceRoot
+			// Render any template placeholders with the actual app name
+			projectConfig["sourceRoot"] = replaceTemplateName(sourceRootStr, appName)
 		}
 	}
 
@@ -388,7 +293,7 @@ func updateOptionsMap(options map[string]interface{}, appName string) {
 	for _, field := range pathFields {
 		if value, exists := options[field]; exists {
 			if valueStr, ok := value.(string); ok {
-				// Replace template app names with actual app name
+				// Render template placeholders with the actual app name
 				updated := replaceTemplateName(valueStr, appName)
 				options[field] = updated
 			}
@@ -396,25 +301,20 @@ func updateOptionsMap(options map[string]interface{}, appName string) {
 	}
 }
 
+// replaceTemplateName renders the appName placeholders of a template path,
+// {{ .appName }} or __appName__ with an optional case helper, the same way
+// template files and names are rendered.
 func replaceTemplateName(path, appName string) string {
-	// Common template names to replace
-	templateNames := []string{"my-app", "myapp", "template-app", "nx-app"}
-
-	result := path
-	for _, templateName := range templateNames {
-		result = strings.ReplaceAll(result, templateName, appName)
-	}
-
-	return result
+	return renderString(path, map[string]string{"appName": appName})
 }
 
 // ConfigureMonorepo configures the base Nx workspace for monorepo usage
-func ConfigureMonorepo(workspacePath, workspaceName string) error {
+func ConfigureMonorepo(out io.Writer, workspacePath, workspaceName string) error {
 	// Check if package.json exists, if not create it with npm init
 	packageJSONPath := filepath.Join(workspacePath, "package.json")
 	if _, err := os.Stat(packageJSONPath); os.IsNotExist(err) {
-		fmt.Printf("No package.json found, initializing new Node.js project...\n")
-		err = initializeNodeProject(workspacePath, workspaceName)
+		fmt.Fprintf(out, "No package.json found, initializing new Node.js project...\n")
+		err = initializeNodeProject(out, workspacePath, workspaceName)
 		if err != nil {
 			return fmt.Errorf("failed to initialize Node.js project: %w", err)
 		}
@@ -507,8 +407,11 @@ func updateNxJSONForMonorepo(nxJSONPath string, instructions []InjectionInstruct
 	}
 
 	// Set default project to the first app if we have instructions
-	if len(instructions) > 0 {
-		nxConfig["defaultProject"] = instructions[0].AppName
+	for _, instruction := range instructions {
+		if !instruction.IsLibrary() {
+			nxConfig["defaultProject"] = instruction.AppName
+			break
+		}
 	}
 
 	// Configure generators for React with modern defaults
@@ -540,10 +443,10 @@ func updateNxJSONForMonorepo(nxJSONPath string, instructions []InjectionInstruct
 }
 
 // createEslintConfigForImportedApp creates modern ESLint config for imported apps
-func createEslintConfigForImportedApp(appPath, appName string) error {
+func createEslintConfigForImportedApp(out io.Writer, appPath, appName string) error {
 	// Print the app name for debugging
 
-	fmt.Printf("Creating ESLint config for imported app: %s\n", appName)
+	fmt.Fprintf(out, "Creating ESLint config for imported app: %s\n", appName)
 	eslintConfig := `import nx from '@nx/eslint-plugin';
 
 export default [
@@ -665,7 +568,7 @@ func updateImportedPackageJSON(packageJSONPath, appName string) error {
 }
 
 // initializeNodeProject creates a basic package.json file for the workspace
-func initializeNodeProject(workspacePath, workspaceName string) error {
+func initializeNodeProject(out io.Writer, workspacePath, workspaceName string) error {
 	// Create a basic package.json structure with modern Nx dependencies
 	packageJSON := map[string]interface{}{
 		"name":    workspaceName,
@@ -717,7 +620,7 @@ func initializeNodeProject(workspacePath, workspaceName string) error {
 	// Create modern eslint.config.mjs at workspace root
 	eslintConfigPath := filepath.Join(workspacePath, "eslint.config.mjs")
 	if _, err := os.Stat(eslintConfigPath); os.IsNotExist(err) {
-		err = createEslintConfigForImportedApp(workspacePath, workspaceName)
+		err = createEslintConfigForImportedApp(out, workspacePath, workspaceName)
 		if err != nil {
 			return fmt.Errorf("failed to create eslint.config.mjs: %w", err)
 		}
@@ -740,6 +643,6 @@ func initializeNodeProject(workspacePath, workspaceName string) error {
 		}
 	}
 
-	fmt.Printf("✅ Initialized new Nx workspace structure with modern plugin configuration\n")
+	fmt.Fprintf(out, "✅ Initialized new Nx workspace structure with modern plugin configuration\n")
 	return nil
 }
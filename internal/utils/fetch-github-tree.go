@@ -0,0 +1,244 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/google/go-github/v53/github"
+)
+
+// FetchOptions controls what FetchGitHubPaths downloads and where it goes.
+type FetchOptions struct {
+	Ref    string    // Branch, tag or commit SHA (default: the repository's default branch)
+	Dest   string    // Directory the files are written below (default: current directory)
+	Stdout io.Writer // Write the single matched file here instead of to disk
+}
+
+// RemoteFile is a file listed in a repository tree.
+type RemoteFile struct {
+	Path string // Slash-separated path in the repository
+	SHA  string // Git blob SHA
+	Mode string // Git file mode, e.g. 100644, 100755 or 120000
+	Size int
+}
+
+// FetchedFile is a file written by FetchGitHubPaths.
+type FetchedFile struct {
+	RemoteFile
+	LocalPath string
+}
+
+// FetchGitHubPaths downloads a file, a directory or every file matching a
+// glob from a GitHub repository. Files keep their repository paths below
+// opts.Dest. It returns the commit the ref resolved to and the files written.
+func FetchGitHubPaths(ctx context.Context, owner, repo, pattern string, opts FetchOptions) (string, []FetchedFile, error) {
+	session := defaultGitHubSession()
+	commit, files, err := fetchGitHubPaths(ctx, session.api, owner, repo, pattern, opts)
+	if err != nil {
+		return "", nil, explainGitHubError(err, session.cred)
+	}
+	return commit, files, nil
+}
+
+func fetchGitHubPaths(ctx context.Context, client *github.Client, owner, repo, pattern string, opts FetchOptions) (string, []FetchedFile, error) {
+	commit, files, err := listGitHubFiles(ctx, client, owner, repo, opts.Ref, pattern)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if opts.Stdout != nil {
+		if len(files) != 1 {
+			return "", nil, fmt.Errorf("--stdout needs exactly one file, but %s matched %d", pattern, len(files))
+		}
+		content, err := downloadGitHubBlob(ctx, client, owner, repo, files[0].SHA)
+		if err != nil {
+			return "", nil, err
+		}
+		_, err = opts.Stdout.Write(content)
+		return commit, []FetchedFile{{RemoteFile: files[0]}}, err
+	}
+
+	dest := opts.Dest
+	if dest == "" {
+		dest = "."
+	}
+
+	fetched := make([]FetchedFile, 0, len(files))
+	for _, file := range files {
+		localPath, err := writeRemoteFile(ctx, client, owner, repo, file, dest, file.Path)
+		if err != nil {
+			return "", nil, err
+		}
+		fetched = append(fetched, FetchedFile{RemoteFile: file, LocalPath: localPath})
+	}
+	return commit, fetched, nil
+}
+
+// listGitHubFiles resolves ref and lists the files matching pattern at that
+// commit. A pattern is a file path, a directory path or a glob.
+func listGitHubFiles(ctx context.Context, client *github.Client, owner, repo, ref, pattern string) (string, []RemoteFile, error) {
+	if ref == "" {
+		repository, _, err := client.Repositories.Get(ctx, owner, repo)
+		if err != nil {
+			return "", nil, fmt.Errorf("failed to look up %s/%s: %w", owner, repo, err)
+		}
+		ref = repository.GetDefaultBranch()
+	}
+
+	commit, _, err := client.Repositories.GetCommitSHA1(ctx, owner, repo, ref, "")
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to resolve ref %s of %s/%s: %w", ref, owner, repo, err)
+	}
+
+	pattern = strings.Trim(filepath.ToSlash(pattern), "/")
+	entries, err := treeEntries(ctx, client, owner, repo, commit, literalPrefix(pattern))
+	if err != nil {
+		return "", nil, err
+	}
+
+	isGlob := strings.ContainsAny(pattern, "*?[")
+	var files []RemoteFile
+	for _, entry := range entries {
+		name := entry.GetPath()
+		if entry.GetType() != "blob" {
+			continue // Subtrees are listed separately and submodules cannot be fetched
+		}
+		if pattern != "" {
+			if isGlob && !matchGlob(pattern, name) {
+				continue
+			}
+			if !isGlob && name != pattern && !strings.HasPrefix(name, pattern+"/") {
+				continue
+			}
+		}
+		files = append(files, RemoteFile{Path: name, SHA: entry.GetSHA(), Mode: entry.GetMode(), Size: entry.GetSize()})
+	}
+
+	if len(files) == 0 {
+		return "", nil, fmt.Errorf("%s matched no files in %s/%s at %s", pattern, owner, repo, ref)
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+	return commit, files, nil
+}
+
+// treeEntries lists the tree of commit recursively. GitHub truncates very
+// large trees, in which case only the subtree at prefix is listed.
+func treeEntries(ctx context.Context, client *github.Client, owner, repo, commit, prefix string) ([]*github.TreeEntry, error) {
+	tree, _, err := client.Git.GetTree(ctx, owner, repo, commit, true)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list files of %s/%s: %w", owner, repo, err)
+	}
+	if !tree.GetTruncated() {
+		return tree.Entries, nil
+	}
+	if prefix == "" {
+		return nil, fmt.Errorf("the tree of %s/%s is too large to list; fetch a subdirectory instead", owner, repo)
+	}
+
+	// Walk down to the subtree one level at a time
+	sha := commit
+	for _, segment := range strings.Split(prefix, "/") {
+		level, _, err := client.Git.GetTree(ctx, owner, repo, sha, false)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list files of %s/%s: %w", owner, repo, err)
+		}
+		sha = ""
+		for _, entry := range level.Entries {
+			if entry.GetPath() == segment && entry.GetType() == "tree" {
+				sha = entry.GetSHA()
+				break
+			}
+		}
+		if sha == "" {
+			return nil, fmt.Errorf("directory %s not found in %s/%s", prefix, owner, repo)
+		}
+	}
+
+	subtree, _, err := client.Git.GetTree(ctx, owner, repo, sha, true)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list files of %s/%s: %w", owner, repo, err)
+	}
+	if subtree.GetTruncated() {
+		return nil, fmt.Errorf("the tree of %s in %s/%s is too large to list", prefix, owner, repo)
+	}
+	for _, entry := range subtree.Entries {
+		entry.Path = github.String(prefix + "/" + entry.GetPath())
+	}
+	return subtree.Entries, nil
+}
+
+// literalPrefix returns the leading directories of a pattern that contain
+// no glob characters. For a plain path the whole path is returned.
+func literalPrefix(pattern string) string {
+	var literal []string
+	segments := strings.Split(pattern, "/")
+	for i, segment := range segments {
+		if strings.ContainsAny(segment, "*?[") {
+			break
+		}
+		// The last segment of a glob-free path may be a file
+		if i == len(segments)-1 && !strings.ContainsAny(pattern, "*?[") {
+			break
+		}
+		literal = append(literal, segment)
+	}
+	return strings.Join(literal, "/")
+}
+
+// downloadGitHubBlob returns the raw contents of a blob.
+func downloadGitHubBlob(ctx context.Context, client *github.Client, owner, repo, sha string) ([]byte, error) {
+	content, _, err := client.Git.GetBlobRaw(ctx, owner, repo, sha)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download blob %s: %w", sha, err)
+	}
+	return content, nil
+}
+
+// writeRemoteFile downloads a file and writes it to relPath below dest,
+// creating parent directories. Symlinks are recreated when their target
+// stays inside dest.
+func writeRemoteFile(ctx context.Context, client *github.Client, owner, repo string, file RemoteFile, dest, relPath string) (string, error) {
+	if reason := unsafeEntryName(relPath); reason != "" {
+		return "", fmt.Errorf("refusing to write %s: %s", relPath, reason)
+	}
+	if err := checkNoSymlinks(dest, relPath); err != nil {
+		return "", err
+	}
+
+	localPath := filepath.Join(dest, filepath.FromSlash(relPath))
+	if err := mkdirNoClobber(filepath.Dir(localPath)); err != nil {
+		return "", err
+	}
+
+	content, err := downloadGitHubBlob(ctx, client, owner, repo, file.SHA)
+	if err != nil {
+		return "", err
+	}
+
+	switch file.Mode {
+	case "120000":
+		target := string(content)
+		if reason := unsafeSymlinkTarget(relPath, target); reason != "" {
+			return "", fmt.Errorf("refusing to create %s: %s", relPath, reason)
+		}
+		os.Remove(localPath)
+		if err := os.Symlink(target, localPath); err != nil {
+			return "", fmt.Errorf("failed to create symlink %s: %w", relPath, err)
+		}
+		return localPath, nil
+	case "100755":
+		err = os.WriteFile(localPath, content, 0755)
+	default:
+		err = os.WriteFile(localPath, content, 0644)
+	}
+	if err != nil {
+		return "", fmt.Errorf("error writing %s to disk: %w", path.Clean(relPath), err)
+	}
+	return localPath, nil
+}
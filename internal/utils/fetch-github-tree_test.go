@@ -0,0 +1,107 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-github/v53/github"
+)
+
+// newFakeGitHub serves a repository tree and its blobs through the subset
+// of the GitHub REST API used by fetch and sync. The tree is built from files
+// on every request, so tests can change upstream between calls.
+func newFakeGitHub(t *testing.T, files map[string]string) *github.Client {
+	t.Helper()
+	commit := strings.Repeat("a", 40)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/o/r", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"default_branch":"main"}`))
+	})
+	mux.HandleFunc("/repos/o/r/commits/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(commit))
+	})
+	mux.HandleFunc("/repos/o/r/git/trees/"+commit, func(w http.ResponseWriter, r *http.Request) {
+		tree := []map[string]interface{}{{"path": ".github", "mode": "040000", "type": "tree", "sha": "dir"}}
+		for name, body := range files {
+			tree = append(tree, map[string]interface{}{"path": name, "mode": "100644", "type": "blob", "sha": gitBlobSHA([]byte(body)), "size": len(body)})
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"sha": commit, "tree": tree})
+	})
+	mux.HandleFunc("/repos/o/r/git/blobs/", func(w http.ResponseWriter, r *http.Request) {
+		sha := strings.TrimPrefix(r.URL.Path, "/repos/o/r/git/blobs/")
+		for _, body := range files {
+			if gitBlobSHA([]byte(body)) == sha {
+				w.Write([]byte(body))
+				return
+			}
+		}
+		http.NotFound(w, r)
+	})
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	client := github.NewClient(nil)
+	client.BaseURL, _ = url.Parse(server.URL + "/")
+	return client
+}
+
+func TestFetchGitHubPaths(t *testing.T) {
+	client := newFakeGitHub(t, map[string]string{
+		".github/workflows/ci.yml":      "ci",
+		".github/workflows/release.yml": "release",
+		".github/CODEOWNERS":            "* @team",
+		"tools/eslint/base.json":        "{}",
+		"tools/README.md":               "tools",
+		"package.json":                  `{"name":"nx"}`,
+	})
+	ctx := context.Background()
+
+	tests := []struct {
+		pattern string
+		want    []string
+	}{
+		{".github", []string{".github/CODEOWNERS", ".github/workflows/ci.yml", ".github/workflows/release.yml"}},
+		{".github/workflows/*.yml", []string{".github/workflows/ci.yml", ".github/workflows/release.yml"}},
+		{"tools/**/*.json", []string{"tools/eslint/base.json"}},
+		{"package.json", []string{"package.json"}},
+	}
+	for _, tt := range tests {
+		dest := t.TempDir()
+		_, files, err := fetchGitHubPaths(ctx, client, "o", "r", tt.pattern, FetchOptions{Dest: dest})
+		if err != nil {
+			t.Fatalf("%s: error fetching. Err: %v", tt.pattern, err)
+		}
+		if len(files) != len(tt.want) {
+			t.Fatalf("%s: expected %d files; got %d", tt.pattern, len(tt.want), len(files))
+		}
+		for i, file := range files {
+			if file.Path != tt.want[i] {
+				t.Errorf("%s: expected %s; got %s", tt.pattern, tt.want[i], file.Path)
+			}
+			if _, err := os.Stat(filepath.Join(dest, filepath.FromSlash(tt.want[i]))); err != nil {
+				t.Errorf("%s: expected %s on disk; got %v", tt.pattern, tt.want[i], err)
+			}
+		}
+	}
+
+	var stdout bytes.Buffer
+	if _, _, err := fetchGitHubPaths(ctx, client, "o", "r", "package.json", FetchOptions{Stdout: &stdout}); err != nil || stdout.String() != `{"name":"nx"}` {
+		t.Errorf("expected package.json on stdout; got %q (%v)", stdout.String(), err)
+	}
+	if _, _, err := fetchGitHubPaths(ctx, client, "o", "r", ".github", FetchOptions{Stdout: &stdout}); err == nil {
+		t.Errorf("expected --stdout to reject a directory")
+	}
+	if _, _, err := fetchGitHubPaths(ctx, client, "o", "r", "missing", FetchOptions{Dest: t.TempDir()}); err == nil {
+		t.Errorf("expected an error when nothing matches")
+	}
+}
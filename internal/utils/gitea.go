@@ -0,0 +1,67 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// GiteaProvider talks to a Gitea (or Forgejo) instance through the REST API (v1).
+type GiteaProvider struct {
+	baseURL *url.URL
+	client  *http.Client
+	cred    Credential
+}
+
+// NewGiteaProvider creates a provider for the Gitea instance at baseURL.
+// The token defaults to GITEA_TOKEN or a ~/.netrc entry for the host.
+func NewGiteaProvider(baseURL, token string) (*GiteaProvider, error) {
+	u, err := parseBaseURL(baseURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Gitea URL: %w", err)
+	}
+
+	cred := tokenCredential(token, "GITEA_TOKEN", u.Hostname())
+	return &GiteaProvider{
+		baseURL: u,
+		client:  newAuthenticatedClient(cred, u.Hostname()),
+		cred:    cred,
+	}, nil
+}
+
+func (p *GiteaProvider) Name() string             { return "gitea" }
+func (p *GiteaProvider) Host() string             { return p.baseURL.Host }
+func (p *GiteaProvider) HTTPClient() *http.Client { return p.client }
+func (p *GiteaProvider) Credential() Credential   { return p.cred }
+
+func (p *GiteaProvider) repoURL(owner, repo string) string {
+	return fmt.Sprintf("%s/api/v1/repos/%s/%s", p.baseURL, url.PathEscape(owner), url.PathEscape(repo))
+}
+
+func (p *GiteaProvider) ResolveRef(ctx context.Context, owner, repo, ref string) (string, error) {
+	var commits []struct {
+		SHA string `json:"sha"`
+	}
+	apiURL := fmt.Sprintf("%s/commits?sha=%s&limit=1&stat=false&files=false", p.repoURL(owner, repo), url.QueryEscape(ref))
+	err := getJSON(ctx, p, apiURL, &commits)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve ref %s of %s/%s: %w", ref, owner, repo, err)
+	}
+	if len(commits) == 0 || commits[0].SHA == "" {
+		return "", fmt.Errorf("failed to resolve ref %s of %s/%s: no commits found", ref, owner, repo)
+	}
+	return commits[0].SHA, nil
+}
+
+func (p *GiteaProvider) ArchiveURL(owner, repo, commit string) string {
+	return fmt.Sprintf("%s/archive/%s.zip", p.repoURL(owner, repo), url.PathEscape(commit))
+}
+
+func (p *GiteaProvider) TarballURL(owner, repo, commit string) string {
+	return fmt.Sprintf("%s/archive/%s.tar.gz", p.repoURL(owner, repo), url.PathEscape(commit))
+}
+
+func (p *GiteaProvider) ParseRepoURL(raw string) (*RepoLocation, bool) {
+	return parseHostedRepoURL(raw, p.Name(), p.Host(), false)
+}
@@ -0,0 +1,343 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultRateLimitWait is how long a request waits for the GitHub API quota
+// to reset before failing, unless NX_SCAFFOLDER_RATE_LIMIT_WAIT says otherwise.
+const defaultRateLimitWait = 2 * time.Minute
+
+// maxCachedResponse is the largest response body kept in the ETag cache.
+const maxCachedResponse = 8 << 20
+
+// RateLimitError reports that the GitHub API quota is used up and did not
+// reset within the allowed wait.
+type RateLimitError struct {
+	Limit      int
+	Resource   string    // Quota that ran out, e.g. core or search
+	Reset      time.Time // When the quota is restored
+	Credential Credential
+}
+
+func (e *RateLimitError) Error() string {
+	limit := "GitHub API rate limit"
+	if e.Limit > 0 {
+		limit = fmt.Sprintf("GitHub API rate limit of %d requests per hour", e.Limit)
+	}
+	msg := fmt.Sprintf("%s exceeded (%s quota); it resets at %s (in %s)",
+		limit, e.Resource, e.Reset.Local().Format(time.Kitchen), time.Until(e.Reset).Round(time.Second))
+	if e.Credential.Token == "" {
+		return msg + "; authenticate for a higher limit: " + e.Credential.Hint
+	}
+	return fmt.Sprintf("%s using %s; set NX_SCAFFOLDER_RATE_LIMIT_WAIT to wait longer for the reset", msg, e.Credential)
+}
+
+// newGitHubHTTPClient returns the client used for all GitHub requests of a
+// run: authenticated for the GitHub hosts, aware of the API rate limit and
+// sending conditional requests for responses in the ETag cache.
+func newGitHubHTTPClient(cred Credential) *http.Client {
+	client := newAuthenticatedClient(cred, githubHost, "api."+githubHost)
+	base := client.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	if dir, err := DefaultCacheDir(); err == nil {
+		base = &etagTransport{base: base, host: "api." + githubHost, dir: filepath.Join(dir, "http"), scope: credentialScope(cred)}
+	}
+	client.Transport = newRateLimitTransport(base, cred, rateLimitWait())
+	return client
+}
+
+// rateLimitWait reads NX_SCAFFOLDER_RATE_LIMIT_WAIT, a duration such as 10m.
+// 0 fails as soon as the quota runs out.
+func rateLimitWait() time.Duration {
+	value := os.Getenv("NX_SCAFFOLDER_RATE_LIMIT_WAIT")
+	if value == "" {
+		return defaultRateLimitWait
+	}
+	wait, err := time.ParseDuration(value)
+	if err != nil || wait < 0 {
+		fmt.Fprintf(os.Stderr, "Warning: ignoring invalid NX_SCAFFOLDER_RATE_LIMIT_WAIT %q\n", value)
+		return defaultRateLimitWait
+	}
+	return wait
+}
+
+// rateLimitTransport reads the X-RateLimit-* headers of GitHub API
+// responses. Once a quota of a host is used up, requests wait for the reset
+// when it is at most maxWait away and fail with a RateLimitError otherwise.
+//
+// go-github refuses to send requests by itself once it has seen a quota run
+// out, so the reset time is removed from successful responses and this
+// transport alone decides whether to wait.
+type rateLimitTransport struct {
+	base    http.RoundTripper
+	cred    Credential
+	maxWait time.Duration
+	sleep   func(ctx context.Context, d time.Duration) error
+
+	mu     sync.Mutex
+	limits map[string]rateLimit // Exhausted quotas, keyed by host and resource
+}
+
+type rateLimit struct {
+	limit int
+	reset time.Time
+}
+
+func newRateLimitTransport(base http.RoundTripper, cred Credential, maxWait time.Duration) *rateLimitTransport {
+	return &rateLimitTransport{
+		base:    base,
+		cred:    cred,
+		maxWait: maxWait,
+		sleep:   sleepContext,
+		limits:  make(map[string]rateLimit),
+	}
+}
+
+func (t *rateLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resource := "core"
+	if strings.HasPrefix(req.URL.Path, "/search/") {
+		resource = "search"
+	}
+	key := req.URL.Host + " " + resource
+
+	for {
+		// Wait for a quota already known to be used up
+		t.mu.Lock()
+		known, exhausted := t.limits[key]
+		t.mu.Unlock()
+		if exhausted && time.Now().Before(known.reset) {
+			if err := t.wait(req, resource, known); err != nil {
+				return nil, err
+			}
+		}
+
+		resp, err := t.base.RoundTrip(req)
+		if err != nil {
+			return nil, err
+		}
+
+		remaining := resp.Header.Get("X-RateLimit-Remaining")
+		reset := parseRateLimitReset(resp.Header.Get("X-RateLimit-Reset"))
+		limit, _ := strconv.Atoi(resp.Header.Get("X-RateLimit-Limit"))
+
+		t.mu.Lock()
+		if remaining == "0" && !reset.IsZero() {
+			t.limits[key] = rateLimit{limit: limit, reset: reset}
+		} else if remaining != "" {
+			delete(t.limits, key)
+		}
+		t.mu.Unlock()
+
+		limited := resp.StatusCode == http.StatusForbidden || resp.StatusCode == http.StatusTooManyRequests
+		retryAfter := parseRetryAfter(resp.Header.Get("Retry-After"))
+		switch {
+		case limited && remaining == "0" && !reset.IsZero():
+			// Primary rate limit: loop to wait for the reset
+		case limited && retryAfter > 0:
+			// Secondary rate limit
+			reset = time.Now().Add(retryAfter)
+		default:
+			if remaining == "0" {
+				resp.Header.Del("X-RateLimit-Reset")
+			}
+			return resp, nil
+		}
+
+		resp.Body.Close()
+		if req.Body != nil && req.GetBody == nil {
+			return nil, &RateLimitError{Limit: limit, Resource: resource, Reset: reset, Credential: t.cred}
+		}
+		if err := t.wait(req, resource, rateLimit{limit: limit, reset: reset}); err != nil {
+			return nil, err
+		}
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req.Body = body
+		}
+	}
+}
+
+// wait sleeps until a quota resets, or returns a RateLimitError when the
+// reset is further away than maxWait.
+func (t *rateLimitTransport) wait(req *http.Request, resource string, limit rateLimit) error {
+	delay := time.Until(limit.reset) + time.Second // The reset time has a resolution of one second
+	if delay > t.maxWait {
+		return &RateLimitError{Limit: limit.limit, Resource: resource, Reset: limit.reset, Credential: t.cred}
+	}
+	// The transport is shared by every command, so its notices go to stderr
+	// rather than into the output of the command
+	fmt.Fprintf(os.Stderr, "GitHub API rate limit reached; waiting %s for it to reset at %s\n",
+		delay.Round(time.Second), limit.reset.Local().Format(time.Kitchen))
+	return t.sleep(req.Context(), delay)
+}
+
+func parseRateLimitReset(value string) time.Time {
+	seconds, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || seconds <= 0 {
+		return time.Time{}
+	}
+	return time.Unix(seconds, 0)
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// etagTransport keeps successful GitHub API responses on disk and sends
+// later requests for the same URL with If-None-Match. GitHub answers with
+// 304 Not Modified when nothing changed, which does not count against the
+// rate limit, and the cached response is returned instead.
+type etagTransport struct {
+	base  http.RoundTripper
+	host  string // Only requests to this host are cached
+	dir   string
+	scope string // Identifies the credential, so private responses are not shared
+}
+
+// cachedResponse is a response stored by etagTransport.
+type cachedResponse struct {
+	URL    string      `json:"url"`
+	ETag   string      `json:"etag"`
+	Header http.Header `json:"header"`
+	Body   []byte      `json:"body"`
+}
+
+func (t *etagTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodGet || req.Header.Get("Range") != "" ||
+		req.Header.Get("If-None-Match") != "" || req.URL.Host != t.host {
+		return t.base.RoundTrip(req)
+	}
+
+	path := filepath.Join(t.dir, t.key(req)+".json")
+	cached := t.load(path)
+	if cached != nil {
+		req = req.Clone(req.Context())
+		req.Header.Set("If-None-Match", cached.ETag)
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusNotModified && cached != nil {
+		resp.Body.Close()
+		header := cached.Header.Clone()
+		for name, values := range resp.Header {
+			header[name] = values // Fresh rate limit and date headers
+		}
+		return &http.Response{
+			Status:        "200 OK",
+			StatusCode:    http.StatusOK,
+			Proto:         resp.Proto,
+			ProtoMajor:    resp.ProtoMajor,
+			ProtoMinor:    resp.ProtoMinor,
+			Header:        header,
+			Body:          io.NopCloser(bytes.NewReader(cached.Body)),
+			ContentLength: int64(len(cached.Body)),
+			Request:       resp.Request,
+		}, nil
+	}
+
+	etag := resp.Header.Get("ETag")
+	if resp.StatusCode != http.StatusOK || etag == "" || resp.ContentLength > maxCachedResponse {
+		return resp, nil
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxCachedResponse+1))
+	if err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	if len(body) > maxCachedResponse {
+		// Too large to cache; hand out the rest of the body unread
+		resp.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(body), resp.Body), resp.Body}
+		return resp, nil
+	}
+	resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	t.store(path, &cachedResponse{URL: req.URL.String(), ETag: etag, Header: resp.Header, Body: body})
+	return resp, nil
+}
+
+// key identifies a request by credential, URL and the headers that select
+// the representation.
+func (t *etagTransport) key(req *http.Request) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n%s\n%s\n", t.scope, req.URL.String(), req.Header.Get("Accept"))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func (t *etagTransport) load(path string) *cachedResponse {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	var cached cachedResponse
+	if json.Unmarshal(data, &cached) != nil || cached.ETag == "" {
+		return nil
+	}
+	return &cached
+}
+
+// store writes a response to the cache. The cache is an optimization, so
+// failures are ignored.
+func (t *etagTransport) store(path string, cached *cachedResponse) {
+	data, err := json.Marshal(cached)
+	if err != nil {
+		return
+	}
+	if os.MkdirAll(t.dir, 0755) != nil {
+		return
+	}
+	tmp, err := os.CreateTemp(t.dir, ".response-*")
+	if err != nil {
+		return
+	}
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil || os.Rename(tmp.Name(), path) != nil {
+		os.Remove(tmp.Name())
+	}
+}
+
+// credentialScope returns a short digest of the token, or "anonymous".
+func credentialScope(cred Credential) string {
+	if cred.Token == "" {
+		return "anonymous"
+	}
+	sum := sha256.Sum256([]byte(cred.Token))
+	return hex.EncodeToString(sum[:8])
+}
@@ -0,0 +1,122 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRateLimitTransport(t *testing.T) {
+	var requests atomic.Int32
+	reset := time.Now().Add(30 * time.Second).Unix()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-RateLimit-Limit", "60")
+		w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(reset, 10))
+		if requests.Add(1) == 1 {
+			w.Header().Set("X-RateLimit-Remaining", "0")
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.Header().Set("X-RateLimit-Remaining", "59")
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	// Waits for the reset when it is close enough
+	var slept time.Duration
+	transport := newRateLimitTransport(http.DefaultTransport, Credential{}, time.Minute)
+	transport.sleep = func(_ context.Context, d time.Duration) error {
+		slept += d
+		return nil
+	}
+	client := &http.Client{Transport: transport}
+
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("error sending request. Err: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "ok" || requests.Load() != 2 {
+		t.Errorf("expected the request to be retried after the reset; got %q after %d requests", body, requests.Load())
+	}
+	if slept < 25*time.Second {
+		t.Errorf("expected to wait for the reset; waited %s", slept)
+	}
+
+	// Fails with the reset time when it is too far away
+	requests.Store(0)
+	transport = newRateLimitTransport(http.DefaultTransport, Credential{Hint: "set GITHUB_TOKEN"}, time.Second)
+	client = &http.Client{Transport: transport}
+	_, err = client.Get(server.URL)
+	var rateErr *RateLimitError
+	if !errors.As(err, &rateErr) {
+		t.Fatalf("expected a RateLimitError; got %v", err)
+	}
+	if rateErr.Limit != 60 || rateErr.Reset.Unix() != reset {
+		t.Errorf("expected limit 60 resetting at %d; got %d at %d", reset, rateErr.Limit, rateErr.Reset.Unix())
+	}
+
+	// Later requests fail without reaching the server
+	_, err = client.Get(server.URL)
+	if !errors.As(err, &rateErr) || requests.Load() != 1 {
+		t.Errorf("expected a RateLimitError without a request; got %v after %d requests", err, requests.Load())
+	}
+}
+
+func TestETagTransport(t *testing.T) {
+	var full, conditional atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			conditional.Add(1)
+			w.Header().Set("X-RateLimit-Remaining", "42")
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		full.Add(1)
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("X-RateLimit-Remaining", "43")
+		w.Write([]byte(`{"sha":"abc"}`))
+	}))
+	defer server.Close()
+
+	serverURL, _ := url.Parse(server.URL)
+	transport := &etagTransport{base: http.DefaultTransport, host: serverURL.Host, dir: t.TempDir(), scope: "anonymous"}
+	client := &http.Client{Transport: transport}
+
+	for i := 0; i < 3; i++ {
+		resp, err := client.Get(server.URL + "/repos/o/r/commits/main")
+		if err != nil {
+			t.Fatalf("error sending request. Err: %v", err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK || string(body) != `{"sha":"abc"}` {
+			t.Errorf("request %d: expected the cached body; got %d %q", i+1, resp.StatusCode, body)
+		}
+		if i > 0 && resp.Header.Get("X-RateLimit-Remaining") != "42" {
+			t.Errorf("request %d: expected the rate limit of the 304 response; got %s", i+1, resp.Header.Get("X-RateLimit-Remaining"))
+		}
+	}
+	if full.Load() != 1 || conditional.Load() != 2 {
+		t.Errorf("expected 1 full and 2 conditional requests; got %d and %d", full.Load(), conditional.Load())
+	}
+
+	// Responses are not shared between credentials
+	other := &http.Client{Transport: &etagTransport{base: http.DefaultTransport, host: serverURL.Host, dir: transport.dir, scope: "token"}}
+	resp, err := other.Get(server.URL + "/repos/o/r/commits/main")
+	if err != nil {
+		t.Fatalf("error sending request. Err: %v", err)
+	}
+	resp.Body.Close()
+	if full.Load() != 2 {
+		t.Errorf("expected a full request for another credential; got %d", full.Load())
+	}
+}
@@ -0,0 +1,85 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// GitLabProvider talks to gitlab.com or a self-managed GitLab instance
+// through the REST API (v4).
+type GitLabProvider struct {
+	baseURL *url.URL
+	client  *http.Client
+	cred    Credential
+}
+
+// NewGitLabProvider creates a provider for the GitLab instance at baseURL.
+// The token defaults to GITLAB_TOKEN or a ~/.netrc entry for the host.
+func NewGitLabProvider(baseURL, token string) (*GitLabProvider, error) {
+	u, err := parseBaseURL(baseURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid GitLab URL: %w", err)
+	}
+
+	cred := tokenCredential(token, "GITLAB_TOKEN", u.Hostname())
+	return &GitLabProvider{
+		baseURL: u,
+		client:  newAuthenticatedClient(cred, u.Hostname()),
+		cred:    cred,
+	}, nil
+}
+
+func (p *GitLabProvider) Name() string             { return "gitlab" }
+func (p *GitLabProvider) Host() string             { return p.baseURL.Host }
+func (p *GitLabProvider) HTTPClient() *http.Client { return p.client }
+func (p *GitLabProvider) Credential() Credential   { return p.cred }
+
+// projectURL returns the API URL of a project; GitLab identifies projects by
+// their URL-encoded full path.
+func (p *GitLabProvider) projectURL(owner, repo string) string {
+	return fmt.Sprintf("%s/api/v4/projects/%s", p.baseURL, url.PathEscape(owner+"/"+repo))
+}
+
+func (p *GitLabProvider) ResolveRef(ctx context.Context, owner, repo, ref string) (string, error) {
+	var commit struct {
+		ID string `json:"id"`
+	}
+	apiURL := fmt.Sprintf("%s/repository/commits/%s", p.projectURL(owner, repo), url.PathEscape(ref))
+	err := getJSON(ctx, p, apiURL, &commit)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve ref %s of %s/%s: %w", ref, owner, repo, err)
+	}
+	if commit.ID == "" {
+		return "", fmt.Errorf("failed to resolve ref %s of %s/%s: empty commit in response", ref, owner, repo)
+	}
+	return commit.ID, nil
+}
+
+func (p *GitLabProvider) ArchiveURL(owner, repo, commit string) string {
+	return fmt.Sprintf("%s/repository/archive.zip?sha=%s", p.projectURL(owner, repo), url.QueryEscape(commit))
+}
+
+func (p *GitLabProvider) TarballURL(owner, repo, commit string) string {
+	return fmt.Sprintf("%s/repository/archive.tar.gz?sha=%s", p.projectURL(owner, repo), url.QueryEscape(commit))
+}
+
+// ParseRepoURL understands project URLs including subgroups, e.g.
+// https://gitlab.example.com/group/subgroup/app or .../app/-/tree/main.
+func (p *GitLabProvider) ParseRepoURL(raw string) (*RepoLocation, bool) {
+	return parseHostedRepoURL(raw, p.Name(), p.Host(), true)
+}
+
+// parseBaseURL validates an instance URL and strips any trailing slash.
+func parseBaseURL(raw string) (*url.URL, error) {
+	u, err := url.Parse(strings.TrimRight(raw, "/"))
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" || u.Host == "" {
+		return nil, fmt.Errorf("%q must be an http(s) URL", raw)
+	}
+	return u, nil
+}
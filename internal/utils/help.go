@@ -13,16 +13,48 @@ Usage:
   nx-scaffolder [command] [options]
 Commands:
   create [app-name]   Create a new Nx React workspace
-  fetch [owner] [repo] [file-path]  Fetch a specific file from a GitHub repository
+  fetch [owner] [repo] [path]  Fetch a file, directory or glob from a GitHub repository
+                      (--ref, --dest, --stdout)
+  sync                Update files listed in nx-scaffolder.sync.yaml from their
+                      source repositories (--check, --force)
+  cache [list|prune|verify]  Manage the local template cache
+  inject explain <expr>  Show the apps and libraries an --inject expression creates (--json)
 Options:
   --output, -o        Output directory for the scaffolded project (default: current directory)
   --owner, -o        GitHub repository owner (default: nrwl)
   --repo, -r         GitHub repository name (default: nx)
-  --branch, -b       Git branch to download (default: master)
+  --ref              Branch, tag or commit SHA to download (default: master)
   --template, -t     Template type (default: react)
+  --template-path    Local template directory or .zip/.tar.gz archive
+  --provider         Template host: github, gitlab or gitea (default: github)
+  --provider-url     Base URL of a self-hosted GitLab or Gitea instance
+  --template-sha256  Expected SHA-256 checksum of the template archive
+  --set key=value    Set a template variable used to render the template files (repeatable)
+  --spec             YAML or JSON workspace spec listing the template, apps and imports
+  --on-conflict      fail (default) or suffix to rename clashing app and library names
+  --jobs, -j         Injection instructions to process at the same time (default: 4)
+  --keep-partial     Keep the partial workspace of a failed create for debugging
+  --dry-run          Print the files a create would write, with diffs of JSON edits, without writing them
+                     (uses cached templates; new apps and git imports are listed but not built)
+  --json             Print the --dry-run plan as JSON
+  --dry-run-download Let --dry-run download an uncached template (it is not cached)
+  --preserve-history Make the workspace a git repository with the full history of imported repositories
+  --run-post-steps   Run the shell commands listed in the template manifest's postSteps
+  --offline          Build only from templates already in the cache
+  --refresh          Download the template again even if it is cached
   --help, -h         Show this help message
 Examples:
-  nx-scaffolder create my-app --owner nrwl --repo nx --branch master --template react
+  nx-scaffolder create my-app --owner nrwl --repo nx --ref master --template react
+  nx-scaffolder create --spec workspace.yaml
+  nx-scaffolder create --spec workspace.yaml --dry-run --json > plan.json
+  nx-scaffolder create my-app --inject '{create-new:admin,shop}|{create-new*3:tenant}'
+  nx-scaffolder create my-app --inject 'https://github.com/org/repo@release/2.x#packages/web'
+  nx-scaffolder create my-app --inject 'git@gitlab.example.com:org/shop.git@v2|../prototype|./exports/blog.zip'
+  nx-scaffolder create my-app --inject '{create-new:web}|{create-lib:ui}|{create-lib/ts/buildable:utils}|lib:../design-system'
+  nx-scaffolder create my-app --provider gitlab --owner platform/templates --repo nx-react
   nx-scaffolder fetch nrwl nx .github/workflows/ci.yml
+  nx-scaffolder fetch nrwl nx .github --ref master --dest ./reference
+  nx-scaffolder sync --check
+  nx-scaffolder inject explain '{create-new*3:site}|https://github.com/org/repo@v2'
   nx-scaffolder --help`)
 }
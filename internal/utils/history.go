@@ -0,0 +1,502 @@
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// importRefPrefix holds the history of imports until it is merged.
+const importRefPrefix = "refs/nx-import/"
+
+// importFetchMu serializes fetches into the workspace repository, as
+// concurrent fetches into one repository race on its locks and FETCH_HEAD.
+var importFetchMu sync.Mutex
+
+// gitRepo runs git commands in the workspace repository.
+type gitRepo struct {
+	dir string
+	env []string // Fallback identity when git has no user configured
+}
+
+// openGitRepo initialises the workspace as a git repository, unless it
+// already is one.
+func openGitRepo(ctx context.Context, workspacePath string) (*gitRepo, error) {
+	repo := &gitRepo{dir: workspacePath}
+	if _, err := os.Stat(filepath.Join(workspacePath, ".git")); os.IsNotExist(err) {
+		if _, err := repo.run(ctx, "", "init", "--quiet"); err != nil {
+			return nil, err
+		}
+	}
+
+	// Commits need an identity, which CI machines often lack
+	for _, setting := range []struct{ key, env, fallback string }{
+		{"user.name", "NAME", "nx-scaffolder"},
+		{"user.email", "EMAIL", "nx-scaffolder@localhost"},
+	} {
+		if value, _ := repo.run(ctx, "", "config", setting.key); strings.TrimSpace(value) != "" {
+			continue
+		}
+		for _, role := range []string{"GIT_AUTHOR_", "GIT_COMMITTER_"} {
+			if os.Getenv(role+setting.env) == "" {
+				repo.env = append(repo.env, role+setting.env+"="+setting.fallback)
+			}
+		}
+	}
+	return repo, nil
+}
+
+// run runs a git command with stdin as its input and returns its output.
+// git's error output is included in the error.
+func (r *gitRepo) run(ctx context.Context, stdin string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = r.dir
+	cmd.Env = append(os.Environ(), r.env...)
+	cmd.Stdin = strings.NewReader(stdin)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if ctx.Err() != nil {
+		return "", ctx.Err()
+	}
+	if err != nil {
+		message := strings.TrimSpace(stderr.String())
+		if message == "" {
+			return "", fmt.Errorf("git %s: %w", args[0], err)
+		}
+		return "", fmt.Errorf("git %s: %w: %s", args[0], err, message)
+	}
+	return string(output), nil
+}
+
+// fetchImportHistory copies the full history of the repository checked out
+// at repoPath into the workspace repository, to be merged once every
+// instruction has run. A shallow clone is deepened first. Imports running at
+// the same time fetch one after the other.
+func fetchImportHistory(ctx context.Context, out io.Writer, workspacePath, repoPath string, instruction InjectionInstruction) error {
+	fmt.Fprintf(out, "Fetching history of %s\n", instruction.RepoURL)
+	source := &gitRepo{dir: repoPath}
+	shallow, err := source.run(ctx, "", "rev-parse", "--is-shallow-repository")
+	if err != nil {
+		return fmt.Errorf("failed to read repository history: %w", err)
+	}
+	if strings.TrimSpace(shallow) == "true" {
+		if _, err := source.run(ctx, "", "fetch", "--quiet", "--unshallow", "origin"); err != nil {
+			return fmt.Errorf("failed to fetch repository history: %w", err)
+		}
+	}
+
+	importFetchMu.Lock()
+	defer importFetchMu.Unlock()
+	workspace := &gitRepo{dir: workspacePath}
+	_, err = workspace.run(ctx, "", "fetch", "--quiet", "--no-tags", repoPath, "+HEAD:"+importRefPrefix+instruction.AppName)
+	if err != nil {
+		return fmt.Errorf("failed to copy repository history: %w", err)
+	}
+	return nil
+}
+
+// mergeImportHistory commits the workspace and merges the fetched history of
+// every import into it, rewritten to live under the project's directory,
+// like a subtree merge. The changes made while converting the imports to Nx
+// projects are committed last, so the history reads:
+//
+//	Create Nx workspace
+//	Import <source> into apps/<name>   (one merge per import)
+//	Convert imported projects to Nx
+func mergeImportHistory(ctx context.Context, out io.Writer, workspacePath string, instructions []InjectionInstruction) error {
+	repo, err := openGitRepo(ctx, workspacePath)
+	if err != nil {
+		return err
+	}
+
+	// Rewrite each history under its project directory
+	type importedHistory struct {
+		instruction InjectionInstruction
+		head        string
+	}
+	var imports []importedHistory
+	for _, instruction := range instructions {
+		ref := importRefPrefix + instruction.AppName
+		head, err := repo.run(ctx, "", "rev-parse", "--verify", "--quiet", ref)
+		if err != nil {
+			continue // Not imported from git
+		}
+		fmt.Fprintf(out, "Rewriting history of %s under %s\n", instruction.RepoURL, instruction.ProjectRoot())
+		rewritten, err := rewriteHistory(ctx, repo, strings.TrimSpace(head), instruction.Subdir, instruction.ProjectRoot())
+		if err != nil {
+			return fmt.Errorf("failed to rewrite history of %s: %w", instruction.RepoURL, err)
+		}
+		if _, err := repo.run(ctx, "", "update-ref", "-d", ref); err != nil {
+			return err
+		}
+		imports = append(imports, importedHistory{instruction, rewritten})
+	}
+
+	// The converted projects are set aside while the workspace is committed
+	// without them, so the merges bring in their original files
+	aside, err := os.MkdirTemp(filepath.Join(workspacePath, ".git"), "nx-import-")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	defer os.RemoveAll(aside)
+	for i, imported := range imports {
+		projectPath := filepath.Join(workspacePath, filepath.FromSlash(imported.instruction.ProjectRoot()))
+		if err := os.Rename(projectPath, filepath.Join(aside, fmt.Sprint(i))); err != nil {
+			return fmt.Errorf("failed to set %s aside: %w", imported.instruction.ProjectRoot(), err)
+		}
+	}
+
+	if _, err := repo.run(ctx, "", "add", "--all"); err != nil {
+		return err
+	}
+	if _, err := repo.run(ctx, "", "commit", "--quiet", "--no-verify", "--message", "Create Nx workspace"); err != nil {
+		return fmt.Errorf("failed to commit workspace: %w", err)
+	}
+
+	for _, imported := range imports {
+		message := fmt.Sprintf("Import %s into %s", imported.instruction.RepoURL, imported.instruction.ProjectRoot())
+		_, err := repo.run(ctx, "", "merge", "--quiet", "--no-verify", "--no-edit", "--allow-unrelated-histories", "--message", message, imported.head)
+		if err != nil {
+			return fmt.Errorf("failed to merge history of %s: %w", imported.instruction.RepoURL, err)
+		}
+		fmt.Fprintf(out, "✅ Merged history of %s into %s\n", imported.instruction.RepoURL, imported.instruction.ProjectRoot())
+	}
+
+	// Put the converted projects back and commit the conversion
+	for i, imported := range imports {
+		projectPath := filepath.Join(workspacePath, filepath.FromSlash(imported.instruction.ProjectRoot()))
+		if err := os.RemoveAll(projectPath); err != nil {
+			return err
+		}
+		if err := os.Rename(filepath.Join(aside, fmt.Sprint(i)), projectPath); err != nil {
+			return fmt.Errorf("failed to restore %s: %w", imported.instruction.ProjectRoot(), err)
+		}
+	}
+	if _, err := repo.run(ctx, "", "add", "--all"); err != nil {
+		return err
+	}
+	if status, err := repo.run(ctx, "", "status", "--porcelain"); err != nil || status == "" {
+		return err
+	}
+	if _, err := repo.run(ctx, "", "commit", "--quiet", "--no-verify", "--message", "Convert imported projects to Nx"); err != nil {
+		return fmt.Errorf("failed to commit converted projects: %w", err)
+	}
+	return nil
+}
+
+// rewriteHistory rewrites every commit reachable from head so its files
+// live under root, keeping only subdir of the original tree when it is set.
+// Authors, committers, dates and messages are kept; signatures are dropped
+// as they would no longer verify. With a subdir, commits that do not change
+// it are left out. It returns the rewritten head.
+//
+// Objects are read and trees written through one cat-file and one mktree
+// process, and the rewritten commits written by a single hash-object at
+// the end, so long histories do not start a process per commit.
+func rewriteHistory(ctx context.Context, repo *gitRepo, head, subdir, root string) (string, error) {
+	revList, err := repo.run(ctx, "", "rev-list", "--reverse", "--topo-order", head)
+	if err != nil {
+		return "", err
+	}
+
+	objects, err := repo.startBatch(ctx, "cat-file", "--batch")
+	if err != nil {
+		return "", err
+	}
+	defer objects.Close()
+	trees, err := repo.startBatch(ctx, "mktree", "--batch")
+	if err != nil {
+		return "", err
+	}
+	defer trees.Close()
+
+	rewritten := make(map[string]string) // Original commit to rewritten, "" when left out
+	newTrees := make(map[string]string)  // Rewritten commit to its tree
+	wrapped := make(map[string]string)   // Original tree to the tree under root
+	var commits [][]byte                 // Rewritten commits, written at the end
+	for _, commit := range strings.Fields(revList) {
+		raw, err := objects.readObject(commit, "commit")
+		if err != nil {
+			return "", err
+		}
+		headers, message, _ := strings.Cut(string(raw), "\n\n")
+
+		var tree string
+		var parents, kept []string
+		for _, header := range splitCommitHeaders(headers) {
+			key, value, _ := strings.Cut(header, " ")
+			switch key {
+			case "tree":
+				tree = value
+			case "parent":
+				if parent := rewritten[value]; parent != "" && !slices.Contains(parents, parent) {
+					parents = append(parents, parent)
+				}
+			case "gpgsig", "gpgsig-sha256", "mergetag":
+			default:
+				kept = append(kept, header)
+			}
+		}
+
+		if subdir != "" {
+			tree, err = subtree(objects, tree, subdir)
+			if err != nil {
+				return "", err
+			}
+		}
+		if tree == "" {
+			// subdir does not exist in this commit
+			rewritten[commit] = ""
+			if len(parents) > 0 {
+				rewritten[commit] = parents[0]
+			}
+			continue
+		}
+
+		newTree, ok := wrapped[tree]
+		if !ok {
+			newTree, err = wrapTree(trees, tree, root)
+			if err != nil {
+				return "", err
+			}
+			wrapped[tree] = newTree
+		}
+		if subdir != "" && len(parents) == 1 && newTrees[parents[0]] == newTree {
+			rewritten[commit] = parents[0]
+			continue
+		}
+
+		var object bytes.Buffer
+		fmt.Fprintf(&object, "tree %s\n", newTree)
+		for _, parent := range parents {
+			fmt.Fprintf(&object, "parent %s\n", parent)
+		}
+		for _, header := range kept {
+			fmt.Fprintf(&object, "%s\n", header)
+		}
+		fmt.Fprintf(&object, "\n%s", message)
+
+		newCommit := objectID("commit", object.Bytes(), len(commit))
+		commits = append(commits, object.Bytes())
+		rewritten[commit] = newCommit
+		newTrees[newCommit] = newTree
+	}
+
+	if rewritten[head] == "" {
+		return "", fmt.Errorf("%s not found in any commit", subdir)
+	}
+	err = writeCommits(ctx, repo, commits, rewritten[head])
+	if err != nil {
+		return "", err
+	}
+	return rewritten[head], nil
+}
+
+// writeCommits stores commits in the repository with one hash-object, which
+// reads them from temporary files. head must be among the written ids, as a
+// check that objectID hashes commits the way git does.
+func writeCommits(ctx context.Context, repo *gitRepo, commits [][]byte, head string) error {
+	dir, err := os.MkdirTemp(filepath.Join(repo.dir, ".git"), "nx-rewrite-")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	var paths strings.Builder
+	for i, commit := range commits {
+		commitPath := filepath.Join(dir, fmt.Sprint(i))
+		if err := os.WriteFile(commitPath, commit, 0644); err != nil {
+			return err
+		}
+		fmt.Fprintf(&paths, "%s\n", commitPath)
+	}
+
+	written, err := repo.run(ctx, paths.String(), "hash-object", "-t", "commit", "-w", "--stdin-paths")
+	if err != nil {
+		return err
+	}
+	if !slices.Contains(strings.Fields(written), head) {
+		return fmt.Errorf("git stored the rewritten history under unexpected commit ids")
+	}
+	return nil
+}
+
+// objectID returns the id of a git object of kind with data. The hash
+// function, SHA-1 or SHA-256, follows the length of an existing id.
+func objectID(kind string, data []byte, idLength int) string {
+	var h hash.Hash = sha1.New()
+	if idLength == hex.EncodedLen(sha256.Size) {
+		h = sha256.New()
+	}
+	fmt.Fprintf(h, "%s %d\x00", kind, len(data))
+	h.Write(data)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// splitCommitHeaders splits the headers of a raw commit, keeping the
+// continuation lines of multi-line headers such as gpgsig with their header.
+func splitCommitHeaders(headers string) []string {
+	var split []string
+	for _, line := range strings.Split(headers, "\n") {
+		if strings.HasPrefix(line, " ") && len(split) > 0 {
+			split[len(split)-1] += "\n" + line
+			continue
+		}
+		split = append(split, line)
+	}
+	return split
+}
+
+// subtree returns the tree at dir in tree, or "" when there is none.
+func subtree(objects *gitBatch, tree, dir string) (string, error) {
+	for _, name := range strings.Split(dir, "/") {
+		raw, err := objects.readObject(tree, "tree")
+		if err != nil {
+			return "", err
+		}
+		idSize := len(tree) / 2
+		tree = ""
+		for len(raw) > 0 {
+			// <mode> SP <name> NUL <binary object id>
+			header, rest, found := bytes.Cut(raw, []byte{0})
+			if !found || len(rest) < idSize {
+				return "", fmt.Errorf("malformed tree object")
+			}
+			mode, entryName, _ := strings.Cut(string(header), " ")
+			if entryName == name && mode == "40000" {
+				tree = hex.EncodeToString(rest[:idSize])
+				break
+			}
+			raw = rest[idSize:]
+		}
+		if tree == "" {
+			return "", nil
+		}
+	}
+	return tree, nil
+}
+
+// wrapTree returns a tree holding tree at the slash-separated path dir.
+func wrapTree(trees *gitBatch, tree, dir string) (string, error) {
+	for dir != "." && dir != "/" && dir != "" {
+		entry := fmt.Sprintf("040000 tree %s\t%s\n", tree, path.Base(dir))
+		var err error
+		tree, err = trees.writeTree(entry)
+		if err != nil {
+			return "", err
+		}
+		dir = path.Dir(dir)
+	}
+	return tree, nil
+}
+
+// gitBatch is a git command that keeps running and answers one request
+// after the other, like cat-file --batch or mktree --batch.
+type gitBatch struct {
+	ctx    context.Context
+	name   string
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout *bufio.Reader
+	stderr bytes.Buffer
+	done   bool
+}
+
+// startBatch starts a batch git command in the repository.
+func (r *gitRepo) startBatch(ctx context.Context, args ...string) (*gitBatch, error) {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = r.dir
+	cmd.Env = append(os.Environ(), r.env...)
+	b := &gitBatch{ctx: ctx, name: args[0], cmd: cmd}
+	cmd.Stderr = &b.stderr
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	b.stdin, b.stdout = stdin, bufio.NewReader(stdout)
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("git %s: %w", b.name, err)
+	}
+	return b, nil
+}
+
+// readObject reads an object of kind through cat-file --batch.
+func (b *gitBatch) readObject(object, kind string) ([]byte, error) {
+	if _, err := fmt.Fprintf(b.stdin, "%s\n", object); err != nil {
+		return nil, b.fail(err)
+	}
+	// <id> SP <kind> SP <size> LF <content> LF, or <object> SP missing LF
+	header, err := b.stdout.ReadString('\n')
+	if err != nil {
+		return nil, b.fail(err)
+	}
+	fields := strings.Fields(header)
+	if len(fields) != 3 || fields[1] != kind {
+		return nil, fmt.Errorf("git cat-file: %s is not a %s: %s", object, kind, strings.TrimSpace(header))
+	}
+	size, err := strconv.Atoi(fields[2])
+	if err != nil {
+		return nil, fmt.Errorf("git cat-file: unexpected output %q", strings.TrimSpace(header))
+	}
+	data := make([]byte, size+1)
+	if _, err := io.ReadFull(b.stdout, data); err != nil {
+		return nil, b.fail(err)
+	}
+	return data[:size], nil
+}
+
+// writeTree writes a tree from ls-tree style entries through mktree --batch.
+func (b *gitBatch) writeTree(entries string) (string, error) {
+	// A blank line ends the tree
+	if _, err := io.WriteString(b.stdin, entries+"\n"); err != nil {
+		return "", b.fail(err)
+	}
+	id, err := b.stdout.ReadString('\n')
+	if err != nil {
+		return "", b.fail(err)
+	}
+	return strings.TrimSpace(id), nil
+}
+
+// fail stops the command after a broken pipe and returns an error that
+// includes what git reported.
+func (b *gitBatch) fail(err error) error {
+	b.Close()
+	if b.ctx.Err() != nil {
+		return b.ctx.Err()
+	}
+	if message := strings.TrimSpace(b.stderr.String()); message != "" {
+		return fmt.Errorf("git %s: %w: %s", b.name, err, message)
+	}
+	return fmt.Errorf("git %s: %w", b.name, err)
+}
+
+// Close ends the command and waits for it to exit.
+func (b *gitBatch) Close() error {
+	if b.done {
+		return nil
+	}
+	b.done = true
+	b.stdin.Close()
+	return b.cmd.Wait()
+}
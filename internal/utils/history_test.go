@@ -0,0 +1,103 @@
+package utils
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// newHistoryRepo creates a bare repository whose history touches
+// packages/web twice and the root once.
+func newHistoryRepo(t *testing.T) string {
+	t.Helper()
+	work := t.TempDir()
+	runTestGit(t, work, "init", "--quiet")
+	os.MkdirAll(filepath.Join(work, "packages", "web", "src"), 0755)
+	commit := func(message, date string) {
+		runTestGit(t, work, "add", ".")
+		runTestGit(t, work, "-c", "user.name=Ada", "-c", "user.email=ada@example.com", "commit", "--quiet", "--date", date, "-m", message)
+	}
+
+	os.WriteFile(filepath.Join(work, "packages", "web", "src", "main.tsx"), []byte("v1\n"), 0644)
+	commit("Add web app", "2021-03-04T05:06:07Z")
+	os.WriteFile(filepath.Join(work, "README.md"), []byte("# shop\n"), 0644)
+	commit("Add readme", "2021-03-05T05:06:07Z")
+	os.WriteFile(filepath.Join(work, "packages", "web", "src", "main.tsx"), []byte("v2\n"), 0644)
+	commit("Update web app", "2021-03-06T05:06:07Z")
+
+	bare := filepath.Join(t.TempDir(), "shop.git")
+	runTestGit(t, filepath.Dir(bare), "clone", "--quiet", "--bare", work, bare)
+	return bare
+}
+
+func TestPreserveHistory(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	bare := newHistoryRepo(t)
+
+	workspace := t.TempDir()
+	os.WriteFile(filepath.Join(workspace, "package.json"), []byte(`{"name": "store"}`), 0644)
+	os.WriteFile(filepath.Join(workspace, "nx.json"), []byte(`{}`), 0644)
+
+	instructions := []InjectionInstruction{
+		{Type: "import-repo", RepoURL: "file://" + bare, AppName: "shop"},
+		{Type: "import-repo", RepoURL: "file://" + bare, AppName: "web", Subdir: "packages/web"},
+		{Type: "create-lib", AppName: "ui"},
+	}
+	err := ProcessInjectionInstructions(context.Background(), workspace, instructions, InjectionOptions{Jobs: 2, PreserveHistory: true})
+	if err != nil {
+		t.Fatalf("error processing instructions. Err: %v", err)
+	}
+
+	// The workspace, each import and the conversion are committed in order
+	subjects := strings.Split(runTestGit(t, workspace, "log", "--first-parent", "--format=%s"), "\n")
+	want := []string{
+		"Convert imported projects to Nx",
+		"Import file://" + bare + " into apps/web",
+		"Import file://" + bare + " into apps/shop",
+		"Create Nx workspace",
+	}
+	if !reflect.DeepEqual(subjects, want) {
+		t.Errorf("expected commits %v; got %v", want, subjects)
+	}
+	if status := runTestGit(t, workspace, "status", "--porcelain"); status != "" {
+		t.Errorf("expected a clean working tree; got %q", status)
+	}
+	if refs := runTestGit(t, workspace, "for-each-ref", importRefPrefix); refs != "" {
+		t.Errorf("expected the import refs to be removed; got %q", refs)
+	}
+
+	// Imported files keep their authors, dates and messages
+	log := runTestGit(t, workspace, "log", "--format=%an %ad %s", "--date=short", "--", "apps/shop/packages/web/src/main.tsx")
+	wantLog := "Ada 2021-03-06 Update web app\nAda 2021-03-04 Add web app"
+	if log != wantLog {
+		t.Errorf("expected history\n%s\ngot\n%s", wantLog, log)
+	}
+	if blame := runTestGit(t, workspace, "blame", "--porcelain", "apps/shop/README.md"); !strings.Contains(blame, "author Ada") {
+		t.Errorf("expected README.md to be blamed on Ada; got %s", blame)
+	}
+
+	// A subdirectory import only keeps the commits that change it
+	log = runTestGit(t, workspace, "log", "--format=%s", "--no-merges", "--", "apps/web")
+	if log != "Convert imported projects to Nx\nUpdate web app\nAdd web app" {
+		t.Errorf("expected the web history to skip the readme commit; got\n%s", log)
+	}
+	if count := runTestGit(t, workspace, "rev-list", "--count", "HEAD~1^2"); count != "2" {
+		t.Errorf("expected 2 rewritten web commits; got %s", count)
+	}
+	files := runTestGit(t, workspace, "ls-tree", "-r", "--name-only", "HEAD~1^2")
+	if files != "apps/web/src/main.tsx" {
+		t.Errorf("expected the rewritten web history to hold apps/web/src/main.tsx; got %q", files)
+	}
+	if _, err := os.Stat(filepath.Join(workspace, "apps", "web", "project.json")); err != nil {
+		t.Errorf("expected the converted web app in the working tree. Err: %v", err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(workspace, "apps", "web", "src", "main.tsx")); string(data) != "v2\n" {
+		t.Errorf("expected the latest web app files; got %q", data)
+	}
+}
@@ -0,0 +1,132 @@
+package utils
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Kinds of import sources.
+const (
+	ImportGit     = "git"     // A repository cloned with git
+	ImportDir     = "dir"     // A local directory, copied without its .git
+	ImportArchive = "archive" // A local .zip, .tar.gz or .tgz file
+)
+
+// ImportSource is a repository or local path to import as an app. A git
+// URL may be followed by @ref, and any source by #subdirectory:
+//
+//	https://github.com/org/repo@release/2.x#packages/web
+//	git@gitlab.example.com:org/repo.git@v2
+//	../prototype
+//	./exports/shop.zip#shop-main
+type ImportSource struct {
+	Kind   string
+	URL    string // Repository URL or local path
+	Ref    string // Branch, tag or commit SHA (default: main, then master)
+	Subdir string // Only this directory becomes the app
+}
+
+var (
+	// abbreviatedSHARegex matches refs that may be a (shortened) commit SHA.
+	abbreviatedSHARegex = regexp.MustCompile(`^[0-9a-f]{7,40}$`)
+	// scpURLRegex matches scp-like SSH URLs such as git@github.com:org/repo.git.
+	scpURLRegex = regexp.MustCompile(`^[A-Za-z0-9._~-]+@[A-Za-z0-9.-]+:`)
+	// invalidNameRegex matches runs of characters not allowed in app names.
+	invalidNameRegex = regexp.MustCompile(`[^a-z0-9._~-]+`)
+)
+
+// ParseImportSource splits an import expression into source, ref and
+// subdirectory. For git URLs the ref starts at the first @ after the host,
+// so user names in the URL are left alone. Local paths take no ref.
+func ParseImportSource(raw string) (*ImportSource, error) {
+	source := &ImportSource{Kind: importKind(raw), URL: raw}
+
+	if base, fragment, found := strings.Cut(raw, "#"); found {
+		source.URL = base
+		subdir := strings.Trim(fragment, "/")
+		if subdir == "" {
+			return nil, fmt.Errorf("invalid import %s: the subdirectory after # is empty", raw)
+		}
+		subdir = path.Clean(subdir)
+		if reason := unsafeEntryName(subdir); reason != "" {
+			return nil, fmt.Errorf("invalid import %s: subdirectory %s", raw, reason)
+		}
+		source.Subdir = subdir
+	}
+	if source.Kind != ImportGit {
+		return source, nil
+	}
+
+	var pathStart int
+	if i := strings.Index(source.URL, "://"); i >= 0 {
+		slash := strings.Index(source.URL[i+3:], "/")
+		if slash < 0 {
+			return nil, fmt.Errorf("invalid import %s: the URL has no repository path", raw)
+		}
+		pathStart = i + 3 + slash
+	} else {
+		pathStart = len(scpURLRegex.FindString(source.URL))
+	}
+	if at := strings.Index(source.URL[pathStart:], "@"); at >= 0 {
+		at += pathStart
+		source.Ref = source.URL[at+1:]
+		source.URL = source.URL[:at]
+		if source.Ref == "" || strings.HasPrefix(source.Ref, "-") || strings.ContainsAny(source.Ref, " ~^:?*[\\") || strings.Contains(source.Ref, "..") {
+			return nil, fmt.Errorf("invalid import %s: %q is not a valid branch, tag or commit", raw, source.Ref)
+		}
+	}
+	return source, nil
+}
+
+// importKind tells git URLs (including ssh:// and file://) from local
+// directories and archives.
+func importKind(raw string) string {
+	base, _, _ := strings.Cut(raw, "#")
+	switch {
+	case strings.Contains(base, "://") || scpURLRegex.MatchString(base):
+		return ImportGit
+	case isZipArchive(base) || isTarGzArchive(base):
+		return ImportArchive
+	default:
+		return ImportDir
+	}
+}
+
+// AppName derives an app name for the import: the subdirectory name when
+// only a subdirectory is imported, then repoName (the repository name of a
+// recognised host, if any) and otherwise the last element of the URL or
+// path without its .git or archive extension. Characters not allowed in
+// project names are replaced, and "" is returned when nothing is left.
+func (s *ImportSource) AppName(repoName string) string {
+	name := repoName
+	switch {
+	case s.Subdir != "":
+		name = path.Base(s.Subdir)
+	case name != "":
+	case s.Kind != ImportGit:
+		if abs, err := filepath.Abs(s.URL); err == nil {
+			name = filepath.Base(abs)
+		}
+	case strings.Contains(s.URL, "://"):
+		if u, err := url.Parse(s.URL); err == nil {
+			name = path.Base(strings.TrimRight(u.Path, "/"))
+		}
+	default:
+		name = path.Base(strings.TrimRight(s.URL[len(scpURLRegex.FindString(s.URL)):], "/"))
+	}
+
+	lower := strings.ToLower(name)
+	for _, ext := range []string{".git", ".zip", ".tar.gz", ".tgz"} {
+		if strings.HasSuffix(lower, ext) {
+			name = name[:len(name)-len(ext)]
+			break
+		}
+	}
+	name = invalidNameRegex.ReplaceAllString(strings.ToLower(name), "-")
+	name = strings.TrimLeft(name, "-._~")
+	return strings.TrimRight(name, "-")
+}
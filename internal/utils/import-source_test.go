@@ -0,0 +1,182 @@
+package utils
+
+import (
+	"context"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseImportSource(t *testing.T) {
+	tests := []struct {
+		raw    string
+		want   ImportSource
+		suffix string
+	}{
+		{"https://github.com/org/repo", ImportSource{Kind: ImportGit, URL: "https://github.com/org/repo"}, "repo"},
+		{"https://github.com/org/repo@release/2.x#packages/web", ImportSource{Kind: ImportGit, URL: "https://github.com/org/repo", Ref: "release/2.x", Subdir: "packages/web"}, "web"},
+		{"https://token@github.com/org/repo.git@v1.2.0", ImportSource{Kind: ImportGit, URL: "https://token@github.com/org/repo.git", Ref: "v1.2.0"}, "repo"},
+		{"https://github.com/org/repo#/apps/Admin/", ImportSource{Kind: ImportGit, URL: "https://github.com/org/repo", Subdir: "apps/Admin"}, "admin"},
+	}
+	for _, tt := range tests {
+		source, err := ParseImportSource(tt.raw)
+		if err != nil {
+			t.Fatalf("%s: error parsing. Err: %v", tt.raw, err)
+		}
+		if *source != tt.want {
+			t.Errorf("%s: expected %+v; got %+v", tt.raw, tt.want, *source)
+		}
+		if name := source.AppName("Repo"); name != tt.suffix {
+			t.Errorf("%s: expected app name %s; got %s", tt.raw, tt.suffix, name)
+		}
+	}
+
+	// Sources on other hosts and local paths are named after their last element
+	named := []struct {
+		raw  string
+		want ImportSource
+		name string
+	}{
+		{"git@gitlab.example.com:Org/My_Repo.git@v2", ImportSource{Kind: ImportGit, URL: "git@gitlab.example.com:Org/My_Repo.git", Ref: "v2"}, "my_repo"},
+		{"ssh://git@git.example.com:2222/org/shop.git", ImportSource{Kind: ImportGit, URL: "ssh://git@git.example.com:2222/org/shop.git"}, "shop"},
+		{"file:///srv/git/legacy.git@main", ImportSource{Kind: ImportGit, URL: "file:///srv/git/legacy.git", Ref: "main"}, "legacy"},
+		{"../Prototype App", ImportSource{Kind: ImportDir, URL: "../Prototype App"}, "prototype-app"},
+		{"./exports/shop@2.zip#shop-main", ImportSource{Kind: ImportArchive, URL: "./exports/shop@2.zip", Subdir: "shop-main"}, "shop-main"},
+		{"/tmp/exports/Shop.tar.gz", ImportSource{Kind: ImportArchive, URL: "/tmp/exports/Shop.tar.gz"}, "shop"},
+	}
+	for _, tt := range named {
+		source, err := ParseImportSource(tt.raw)
+		if err != nil {
+			t.Fatalf("%s: error parsing. Err: %v", tt.raw, err)
+		}
+		if *source != tt.want {
+			t.Errorf("%s: expected %+v; got %+v", tt.raw, tt.want, *source)
+		}
+		if name := source.AppName(""); name != tt.name {
+			t.Errorf("%s: expected app name %s; got %s", tt.raw, tt.name, name)
+		}
+	}
+
+	for _, raw := range []string{
+		"https://github.com/org/repo@",
+		"https://github.com/org/repo@--upload-pack=x",
+		"https://github.com/org/repo#",
+		"https://github.com/org/repo#../outside",
+	} {
+		if _, err := ParseImportSource(raw); err == nil {
+			t.Errorf("%s: expected an error", raw)
+		}
+	}
+}
+
+// runTestGit runs git in dir with a fixed identity and fails the test on error.
+func runTestGit(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command("git", append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com", "-c", "init.defaultBranch=main"}, args...)...)
+	cmd.Dir = dir
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("error running git %s. Err: %v: %s", strings.Join(args, " "), err, output)
+	}
+	return strings.TrimSpace(string(output))
+}
+
+func TestImportExistingRepoRefAndSubdir(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	repo := t.TempDir()
+	runTestGit(t, repo, "init", "--quiet")
+	os.MkdirAll(filepath.Join(repo, "packages", "web"), 0755)
+	os.WriteFile(filepath.Join(repo, "packages", "web", "index.ts"), []byte("v1"), 0644)
+	os.WriteFile(filepath.Join(repo, "README.md"), []byte("root"), 0644)
+	runTestGit(t, repo, "add", ".")
+	runTestGit(t, repo, "commit", "--quiet", "-m", "v1")
+	first := runTestGit(t, repo, "rev-parse", "HEAD")
+
+	runTestGit(t, repo, "checkout", "--quiet", "-b", "release/2.x")
+	os.WriteFile(filepath.Join(repo, "packages", "web", "index.ts"), []byte("v2"), 0644)
+	runTestGit(t, repo, "commit", "--quiet", "-am", "v2")
+	runTestGit(t, repo, "checkout", "--quiet", "main")
+
+	tests := []struct {
+		ref  string
+		want string
+	}{
+		{"release/2.x", "v2"},
+		{"", "v1"},
+		{first, "v1"},
+		{first[:10], "v1"},
+	}
+	for _, tt := range tests {
+		workspace := t.TempDir()
+		instruction := InjectionInstruction{Type: "import-repo", RepoURL: "file://" + repo, AppName: "web", Branch: tt.ref, Subdir: "packages/web"}
+		err := importExistingRepo(context.Background(), io.Discard, workspace, instruction, InjectionOptions{})
+		if err != nil {
+			t.Fatalf("%q: error importing. Err: %v", tt.ref, err)
+		}
+
+		appPath := filepath.Join(workspace, "apps", "web")
+		data, _ := os.ReadFile(filepath.Join(appPath, "index.ts"))
+		if string(data) != tt.want {
+			t.Errorf("%q: expected %s; got %q", tt.ref, tt.want, data)
+		}
+		if _, err := os.Stat(filepath.Join(appPath, "README.md")); !os.IsNotExist(err) {
+			t.Errorf("%q: expected only the subdirectory to be imported", tt.ref)
+		}
+		if _, err := os.Stat(filepath.Join(workspace, "apps", "web.clone")); !os.IsNotExist(err) {
+			t.Errorf("%q: expected the clone to be removed", tt.ref)
+		}
+	}
+}
+
+func TestImportLocalSource(t *testing.T) {
+	prototype := t.TempDir()
+	os.MkdirAll(filepath.Join(prototype, "src"), 0755)
+	os.MkdirAll(filepath.Join(prototype, ".git"), 0755)
+	os.MkdirAll(filepath.Join(prototype, "node_modules", "react"), 0755)
+	os.WriteFile(filepath.Join(prototype, "src", "main.tsx"), []byte("dir"), 0644)
+	os.WriteFile(filepath.Join(prototype, ".git", "HEAD"), []byte("ref: refs/heads/main"), 0644)
+	os.WriteFile(filepath.Join(prototype, "node_modules", "react", "index.js"), []byte(""), 0644)
+
+	archive := buildZip(t, []testArchiveEntry{
+		{name: "shop-main/README.md", body: "root"},
+		{name: "shop-main/web/src/main.tsx", body: "zip"},
+		{name: "shop-main/web/node_modules/react/index.js"},
+	})
+
+	tests := []struct {
+		url    string
+		subdir string
+		want   string
+	}{
+		{prototype, "", "dir"},
+		{archive, "web", "zip"},
+	}
+	for _, tt := range tests {
+		workspace := t.TempDir()
+		instruction := InjectionInstruction{Type: "import-repo", RepoURL: tt.url, AppName: "web", Subdir: tt.subdir}
+		err := importExistingRepo(context.Background(), io.Discard, workspace, instruction, InjectionOptions{})
+		if err != nil {
+			t.Fatalf("%s: error importing. Err: %v", tt.url, err)
+		}
+
+		appPath := filepath.Join(workspace, "apps", "web")
+		data, _ := os.ReadFile(filepath.Join(appPath, "src", "main.tsx"))
+		if string(data) != tt.want {
+			t.Errorf("%s: expected %s; got %q", tt.url, tt.want, data)
+		}
+		for _, skipped := range []string{".git", "node_modules"} {
+			if _, err := os.Stat(filepath.Join(appPath, skipped)); !os.IsNotExist(err) {
+				t.Errorf("%s: expected %s not to be copied", tt.url, skipped)
+			}
+		}
+		if _, err := os.Stat(filepath.Join(appPath, "project.json")); err != nil {
+			t.Errorf("%s: expected the import to become an Nx project. Err: %v", tt.url, err)
+		}
+	}
+}
@@ -0,0 +1,493 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// An inject expression lists the apps and libraries to add to a workspace,
+// separated by |:
+//
+//	{create-new}                    one app, named app-N after its position
+//	{create-new:admin,shop}         one app per name
+//	{create-new*N:prefix}           N apps, named prefix-1 to prefix-N
+//	{create-lib/ts/buildable:utils} libraries; options are react, ts and buildable
+//	https://github.com/org/repo@ref#subdir
+//	                                an import (see ImportSource)
+//	lib/ts:../design-system         an import as a library
+
+// InjectSyntaxError is an error in an inject expression, located by column.
+type InjectSyntaxError struct {
+	Expr       string
+	Column     int // From 1
+	Msg        string
+	Suggestion string // How to fix the expression, if known
+}
+
+func (e *InjectSyntaxError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "column %d: %s\n  %s\n  %s^", e.Column, e.Msg, e.Expr, strings.Repeat(" ", e.Column-1))
+	if e.Suggestion != "" {
+		fmt.Fprintf(&b, "\n  %s", e.Suggestion)
+	}
+	return b.String()
+}
+
+// InjectStep is an instruction of an inject expression with the part of
+// the expression it came from.
+type InjectStep struct {
+	Instruction InjectionInstruction
+	Expr        string // The |-separated part of the expression
+	Column      int    // Column of Expr in the expression, from 1
+	Note        string // How the name or count was derived, if not spelled out
+}
+
+// injectDirectives are the expressions written in braces.
+var injectDirectives = []string{"create-new", "create-lib"}
+
+// importLibRegex matches lib:source, which imports a repository, directory
+// or archive as a library and takes the same options as {create-lib}.
+var importLibRegex = regexp.MustCompile(`^lib((?:/[a-z]+)*):(.+)$`)
+
+// ParseInjectInstructions parses an inject expression into instructions.
+func ParseInjectInstructions(expr string) ([]InjectionInstruction, error) {
+	steps, err := ParseInjectExpression(expr)
+	if err != nil {
+		return nil, err
+	}
+	instructions := make([]InjectionInstruction, len(steps))
+	for i, step := range steps {
+		instructions[i] = step.Instruction
+	}
+	return instructions, nil
+}
+
+// ParseInjectExpression parses an inject expression into steps. Local
+// import paths must exist; nothing is written.
+func ParseInjectExpression(expr string) ([]InjectStep, error) {
+	p := &injectParser{expr: expr}
+	if strings.TrimSpace(expr) == "" {
+		return nil, p.errorAt(0, "the expression is empty", "add {create-new} or a repository URL")
+	}
+
+	start := 0
+	for start <= len(expr) {
+		end := strings.IndexByte(expr[start:], '|')
+		if end < 0 {
+			end = len(expr)
+		} else {
+			end += start
+		}
+		err := p.parseItem(start, end)
+		if err != nil {
+			return nil, err
+		}
+		start = end + 1
+	}
+	return p.steps, nil
+}
+
+// injectToken is a token of a braced expression: a word, such as a
+// directive, number, option or name, or a single punctuation character.
+type injectToken struct {
+	text   string
+	offset int  // Byte offset in the expression
+	punct  bool // One of { } + * : / ,
+}
+
+const injectPunctuation = "{}+*:/,"
+
+// lexInjectItem splits expr[start:end] into tokens, skipping spaces.
+func lexInjectItem(expr string, start, end int) []injectToken {
+	var tokens []injectToken
+	for i := start; i < end; {
+		c := expr[i]
+		switch {
+		case c == ' ' || c == '\t':
+			i++
+		case strings.IndexByte(injectPunctuation, c) >= 0:
+			tokens = append(tokens, injectToken{text: string(c), offset: i, punct: true})
+			i++
+		default:
+			j := i
+			for j < end && expr[j] != ' ' && expr[j] != '\t' && strings.IndexByte(injectPunctuation, expr[j]) < 0 {
+				j++
+			}
+			tokens = append(tokens, injectToken{text: expr[i:j], offset: i})
+			i = j
+		}
+	}
+	return tokens
+}
+
+type injectParser struct {
+	expr  string
+	steps []InjectStep
+
+	// State of the braced expression being parsed
+	tokens []injectToken
+	pos    int
+	end    int // Offset just past the expression
+}
+
+func (p *injectParser) errorAt(offset int, msg, suggestion string) error {
+	return &InjectSyntaxError{
+		Expr:       p.expr,
+		Column:     utf8.RuneCountInString(p.expr[:offset]) + 1,
+		Msg:        msg,
+		Suggestion: suggestion,
+	}
+}
+
+// parseItem parses the |-separated part expr[start:end].
+func (p *injectParser) parseItem(start, end int) error {
+	raw := p.expr[start:end]
+	trimmed := strings.TrimSpace(raw)
+	if trimmed == "" {
+		return p.errorAt(start, "empty instruction", "remove the extra |")
+	}
+	start += strings.Index(raw, trimmed)
+	end = start + len(trimmed)
+
+	before := len(p.steps)
+	var err error
+	if trimmed[0] == '{' {
+		err = p.parseBraced(start, end)
+	} else {
+		err = p.parseImport(start, end)
+	}
+	if err != nil {
+		return err
+	}
+	for i := before; i < len(p.steps); i++ {
+		p.steps[i].Expr = trimmed
+		p.steps[i].Column = utf8.RuneCountInString(p.expr[:start]) + 1
+	}
+	return nil
+}
+
+func (p *injectParser) peek() *injectToken {
+	if p.pos < len(p.tokens) {
+		return &p.tokens[p.pos]
+	}
+	return nil
+}
+
+// accept consumes the next token if it is the punctuation punct.
+func (p *injectParser) accept(punct string) bool {
+	if t := p.peek(); t != nil && t.punct && t.text == punct {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+// offset returns where the next token starts, or the end of the expression.
+func (p *injectParser) offset() int {
+	if t := p.peek(); t != nil {
+		return t.offset
+	}
+	return p.end
+}
+
+// parseBraced parses {create-new...} and {create-lib...} expressions.
+func (p *injectParser) parseBraced(start, end int) error {
+	p.tokens = lexInjectItem(p.expr, start, end)
+	p.pos = 0
+	p.end = end
+	p.accept("{")
+
+	directive := p.peek()
+	if directive == nil || directive.punct {
+		return p.errorAt(p.offset(), "expected create-new or create-lib after {", "")
+	}
+	p.pos++
+	if directive.text != "create-new" && directive.text != "create-lib" {
+		suggestion := ""
+		if closest := closestWord(directive.text, injectDirectives); closest != "" {
+			suggestion = fmt.Sprintf("did you mean {%s}?", closest)
+		}
+		return p.errorAt(directive.offset, fmt.Sprintf("unknown expression %q", directive.text), suggestion)
+	}
+
+	// {create-new*N}, or {create-lib/option...}
+	operator, count := "", 0
+	var framework string
+	var buildable bool
+	if directive.text == "create-new" {
+		if t := p.peek(); t != nil && t.punct && t.text == "+" {
+			// +N could mean N apps or N more, so it is not accepted
+			suggestion := "use {create-new*N} for N apps"
+			if p.pos+1 < len(p.tokens) && !p.tokens[p.pos+1].punct {
+				if n, err := strconv.Atoi(p.tokens[p.pos+1].text); err == nil && n >= 0 {
+					suggestion = fmt.Sprintf("use {create-new*%d} for %d apps", n+1, n+1)
+				}
+			}
+			return p.errorAt(t.offset, "+ is ambiguous in {create-new+N}", suggestion)
+		}
+		if p.accept("*") {
+			operator = "*"
+			number := p.peek()
+			if number == nil || number.punct {
+				return p.errorAt(p.offset(), "expected a number after *", "e.g. {create-new*2}")
+			}
+			p.pos++
+			var err error
+			count, err = strconv.Atoi(number.text)
+			if err != nil || count < 0 {
+				return p.errorAt(number.offset, fmt.Sprintf("%q is not a number", number.text), "e.g. {create-new*2}")
+			}
+			if count == 0 {
+				return p.errorAt(number.offset, "*0 creates no apps", "use {create-new} for a single app")
+			}
+		}
+	} else {
+		for p.accept("/") {
+			option := p.peek()
+			if option == nil || option.punct {
+				return p.errorAt(p.offset(), "expected a library option after /", "use react, ts or buildable")
+			}
+			p.pos++
+			switch option.text {
+			case LibReact, LibTS:
+				if framework != "" {
+					return p.errorAt(option.offset, "the library framework is set twice", "use either react or ts")
+				}
+				framework = option.text
+			case "buildable":
+				buildable = true
+			default:
+				suggestion := "use react, ts or buildable"
+				if closest := closestWord(option.text, []string{LibReact, LibTS, "buildable"}); closest != "" {
+					suggestion = fmt.Sprintf("did you mean /%s?", closest)
+				}
+				return p.errorAt(option.offset, fmt.Sprintf("unknown library option %q", option.text), suggestion)
+			}
+		}
+	}
+
+	// :name,name...
+	var names []injectToken
+	if p.accept(":") {
+		for {
+			name := p.peek()
+			if name == nil || name.punct {
+				if len(names) == 0 {
+					return p.errorAt(p.offset(), "expected a name after :", "add a name or remove the :")
+				}
+				return p.errorAt(p.offset(), "expected a name after ,", "remove the extra ,")
+			}
+			p.pos++
+			names = append(names, *name)
+			if !p.accept(",") {
+				break
+			}
+		}
+	}
+
+	if !p.accept("}") {
+		t := p.peek()
+		switch {
+		case t == nil:
+			return p.errorAt(p.end, "missing } at the end of the expression", "close the expression with }")
+		case t.text == ":" && len(names) > 0:
+			return p.errorAt(t.offset, "names cannot contain :", "")
+		case len(names) == 0 && !t.punct:
+			return p.errorAt(t.offset, fmt.Sprintf("unexpected %q", t.text), "names go after a :, e.g. {"+directive.text+":name}")
+		default:
+			return p.errorAt(t.offset, fmt.Sprintf("unexpected %q", t.text), "")
+		}
+	}
+	if t := p.peek(); t != nil {
+		return p.errorAt(t.offset, "unexpected text after }", "separate instructions with |")
+	}
+
+	if operator != "" && len(names) > 1 {
+		return p.errorAt(names[1].offset-1, fmt.Sprintf("{create-new%s%d} takes a single name prefix, not a list", operator, count),
+			fmt.Sprintf("use {create-new:%s,...} to name each app", names[0].text))
+	}
+
+	instructionType := "create-new"
+	if directive.text == "create-lib" {
+		instructionType = "create-lib"
+	}
+	add := func(name, note string) {
+		p.steps = append(p.steps, InjectStep{
+			Instruction: InjectionInstruction{Type: instructionType, AppName: name, Framework: framework, Buildable: buildable},
+			Note:        note,
+		})
+	}
+
+	next := len(p.steps) + 1
+	switch {
+	case operator != "":
+		note := fmt.Sprintf("*%d creates %d apps", count, count)
+		for j := 0; j < count; j++ {
+			name := fmt.Sprintf("app-%d", next+j)
+			if len(names) == 1 {
+				name = fmt.Sprintf("%s-%d", names[0].text, j+1)
+				if err := ValidateProjectName(name); err != nil {
+					return p.nameError(names[0], err, fmt.Sprintf("-%d", j+1))
+				}
+			}
+			add(name, note)
+		}
+	case len(names) == 0:
+		prefix := "app"
+		if instructionType == "create-lib" {
+			prefix = "lib"
+		}
+		add(fmt.Sprintf("%s-%d", prefix, next), "named after its position")
+	default:
+		for _, name := range names {
+			if err := ValidateProjectName(name.text); err != nil {
+				return p.nameError(name, err, "")
+			}
+			add(name.text, "")
+		}
+	}
+	return nil
+}
+
+// nameError reports an invalid name, suggesting a valid spelling.
+func (p *injectParser) nameError(name injectToken, err error, suffix string) error {
+	suggestion := ""
+	if fixed := (&ImportSource{Kind: ImportDir, URL: name.text}).AppName(""); fixed != "" && fixed != name.text &&
+		ValidateProjectName(fixed+suffix) == nil {
+		suggestion = fmt.Sprintf("did you mean %s?", fixed)
+	}
+	return p.errorAt(name.offset, err.Error(), suggestion)
+}
+
+// parseImport parses an import of a repository, directory or archive,
+// optionally prefixed with lib: and library options.
+func (p *injectParser) parseImport(start, end int) error {
+	instruction := InjectionInstruction{Type: "import-repo"}
+	fallbackName := fmt.Sprintf("imported-app-%d", len(p.steps)+1)
+
+	if matches := importLibRegex.FindStringSubmatchIndex(p.expr[start:end]); matches != nil {
+		instruction.Type = "import-lib"
+		fallbackName = fmt.Sprintf("imported-lib-%d", len(p.steps)+1)
+
+		optionStart := start + matches[2]
+		for _, option := range strings.Split(p.expr[optionStart:start+matches[3]], "/")[1:] {
+			optionStart += 1
+			switch option {
+			case LibReact, LibTS:
+				if instruction.Framework != "" {
+					return p.errorAt(optionStart, "the library framework is set twice", "use either react or ts")
+				}
+				instruction.Framework = option
+			case "buildable":
+				instruction.Buildable = true
+			default:
+				suggestion := "use react, ts or buildable"
+				if closest := closestWord(option, []string{LibReact, LibTS, "buildable"}); closest != "" {
+					suggestion = fmt.Sprintf("did you mean /%s?", closest)
+				}
+				return p.errorAt(optionStart, fmt.Sprintf("unknown library option %q", option), suggestion)
+			}
+			optionStart += len(option)
+		}
+		start += matches[4]
+	}
+
+	// url@ref#subdir selects a branch, tag or commit and a directory;
+	// anything else is a local directory or archive
+	raw := p.expr[start:end]
+	source, err := ParseImportSource(raw)
+	if err != nil {
+		return p.errorAt(start, err.Error(), "")
+	}
+	if source.Kind != ImportGit {
+		if _, err := os.Stat(source.URL); err != nil {
+			return p.errorAt(start, fmt.Sprintf("%s is not a repository URL, directory or archive", source.URL), importSuggestion(source.URL))
+		}
+	}
+
+	repoName := repoNameFromURL(source.URL)
+	instruction.RepoURL = source.URL
+	instruction.AppName = source.AppName(repoName)
+	instruction.Branch = source.Ref
+	instruction.Subdir = source.Subdir
+
+	note := ""
+	switch {
+	case instruction.AppName == "":
+		instruction.AppName = fallbackName
+		note = "no name could be derived from the source"
+	case source.Subdir != "":
+		note = "named after the subdirectory"
+	case repoName != "":
+		note = "named after the repository"
+	case source.Kind == ImportGit:
+		note = "named after the URL"
+	default:
+		note = "named after the " + map[string]string{ImportDir: "directory", ImportArchive: "archive"}[source.Kind]
+	}
+	p.steps = append(p.steps, InjectStep{Instruction: instruction, Note: note})
+	return nil
+}
+
+// importSuggestion guesses what a source that is neither a URL nor an
+// existing path was meant to be.
+func importSuggestion(raw string) string {
+	word := strings.Trim(raw, "{} ")
+	if closest := closestWord(word, injectDirectives); closest != "" {
+		return fmt.Sprintf("did you mean {%s}?", closest)
+	}
+	for _, host := range []string{"github.com/", "gitlab.com/", "bitbucket.org/"} {
+		if strings.HasPrefix(raw, host) || strings.HasPrefix(raw, "www."+host) {
+			return fmt.Sprintf("did you mean https://%s?", raw)
+		}
+	}
+	return "use a URL such as https://github.com/org/repo, or the path of an existing directory or archive"
+}
+
+// repoNameFromURL returns the repository name of a GitHub, GitLab or Gitea
+// URL, or "" for other URLs and paths.
+func repoNameFromURL(url string) string {
+	location, ok := ParseRepoURL(url)
+	if !ok {
+		return ""
+	}
+	return location.Repo
+}
+
+// closestWord returns the candidate within a small edit distance of word,
+// or "".
+func closestWord(word string, candidates []string) string {
+	best, bestDistance := "", 0
+	for _, candidate := range candidates {
+		d := editDistance(strings.ToLower(word), candidate)
+		if d <= max(2, len(candidate)/3) && (best == "" || d < bestDistance) {
+			best, bestDistance = candidate, d
+		}
+	}
+	return best
+}
+
+// editDistance returns the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	previous := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current := make([]int, len(b)+1)
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous = current
+	}
+	return previous[len(b)]
+}
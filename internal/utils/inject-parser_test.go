@@ -0,0 +1,145 @@
+package utils
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseInjectInstructions(t *testing.T) {
+	tests := []struct {
+		inject string
+		want   []string
+	}{
+		{"{create-new}|{create-new*2}", []string{"app-1", "app-2", "app-3"}},
+		{"{create-new:dashboard}", []string{"dashboard"}},
+		{"{create-new:admin, shop,checkout}|{create-new}", []string{"admin", "shop", "checkout", "app-4"}},
+		{"{create-new*3:tenant}", []string{"tenant-1", "tenant-2", "tenant-3"}},
+		{"{create-new*2:site}", []string{"site-1", "site-2"}},
+	}
+	for _, tt := range tests {
+		instructions, err := ParseInjectInstructions(tt.inject)
+		if err != nil {
+			t.Fatalf("%s: error parsing. Err: %v", tt.inject, err)
+		}
+		var names []string
+		for _, instruction := range instructions {
+			names = append(names, instruction.AppName)
+		}
+		if !reflect.DeepEqual(names, tt.want) {
+			t.Errorf("%s: expected %v; got %v", tt.inject, tt.want, names)
+		}
+	}
+
+	// Imports from other hosts and local paths
+	prototype := filepath.Join(t.TempDir(), "My Prototype")
+	os.Mkdir(prototype, 0755)
+	inject := "git@gitlab.example.com:org/shop.git@v2|ssh://git@example.com/org/blog.git|" + prototype
+	instructions, err := ParseInjectInstructions(inject)
+	if err != nil {
+		t.Fatalf("error parsing imports. Err: %v", err)
+	}
+	want := []string{"shop", "blog", "my-prototype"}
+	if len(instructions) != len(want) {
+		t.Fatalf("expected %d imports; got %d", len(want), len(instructions))
+	}
+	for i, instruction := range instructions {
+		if instruction.Type != "import-repo" || instruction.AppName != want[i] {
+			t.Errorf("import %d: expected import-repo %s; got %s %s", i+1, want[i], instruction.Type, instruction.AppName)
+		}
+	}
+
+	// Libraries
+	instructions, err = ParseInjectInstructions("{create-lib:ui}|{create-lib/ts/buildable:utils, dates}|lib/ts:git@github.com:org/schema.git")
+	if err != nil {
+		t.Fatalf("error parsing libraries. Err: %v", err)
+	}
+	wantLibs := []InjectionInstruction{
+		{Type: "create-lib", AppName: "ui"},
+		{Type: "create-lib", AppName: "utils", Framework: "ts", Buildable: true},
+		{Type: "create-lib", AppName: "dates", Framework: "ts", Buildable: true},
+		{Type: "import-lib", RepoURL: "git@github.com:org/schema.git", AppName: "schema", Framework: "ts"},
+	}
+	if !reflect.DeepEqual(instructions, wantLibs) {
+		t.Errorf("expected %+v; got %+v", wantLibs, instructions)
+	}
+
+	for _, inject := range []string{
+		"{create-lib/vue:ui}",
+		"{create-lib/ts/react:ui}",
+		"{create-lib:UI}",
+		"{create-nw}",
+		"{create-new:Dashboard}",
+		"{create-new:a,,b}",
+		"{create-new:app:web}",
+		"{create-new*2:a,b}",
+		"{create-new*0}",
+		"{create-new:_private}",
+	} {
+		if _, err := ParseInjectInstructions(inject); err == nil {
+			t.Errorf("%s: expected an error", inject)
+		}
+	}
+}
+
+func TestInjectSyntaxErrors(t *testing.T) {
+	tests := []struct {
+		inject     string
+		column     int
+		suggestion string
+	}{
+		{"{create-new}|{create-nw}", 15, "did you mean {create-new}?"},
+		{"{create-new:shop", 17, "close the expression with }"},
+		{"{create-new*x}", 13, "e.g. {create-new*2}"},
+		{"{create-new+2:site}", 12, "use {create-new*3} for 3 apps"},
+		{"{create-new+}", 12, "use {create-new*N} for N apps"},
+		{"{create-new*0}", 13, "use {create-new}"},
+		{"{create-new:Admin}", 13, "did you mean admin?"},
+		{"{create-new:a,,b}", 15, "remove the extra ,"},
+		{"{create-new*2:a,b}", 16, "use {create-new:a,...}"},
+		{"{create-new}||{create-new}", 14, "remove the extra |"},
+		{"{create-new} x", 14, ""},
+		{"{create-new}x", 13, "separate instructions with |"},
+		{"{create-lib/tsx:ui}", 13, "did you mean /ts?"},
+		{"lib/buildabel:https://github.com/o/r", 5, "did you mean /buildable?"},
+		{"create-new", 1, "did you mean {create-new}?"},
+		{"github.com/org/repo", 1, "did you mean https://github.com/org/repo?"},
+	}
+	for _, tt := range tests {
+		_, err := ParseInjectExpression(tt.inject)
+		var syntaxErr *InjectSyntaxError
+		if !errors.As(err, &syntaxErr) {
+			t.Errorf("%s: expected an InjectSyntaxError; got %v", tt.inject, err)
+			continue
+		}
+		if syntaxErr.Column != tt.column || !strings.Contains(syntaxErr.Suggestion, tt.suggestion) {
+			t.Errorf("%s: expected column %d suggesting %q; got %d %q (%s)", tt.inject, tt.column, tt.suggestion, syntaxErr.Column, syntaxErr.Suggestion, syntaxErr.Msg)
+		}
+	}
+
+	// The caret points at the column
+	_, err := ParseInjectExpression("{create-new}|{create-nw}")
+	want := "  {create-new}|{create-nw}\n                ^\n"
+	if err == nil || !strings.Contains(err.Error(), want) {
+		t.Errorf("expected the error to point at the column; got %v", err)
+	}
+}
+
+func TestParseInjectExpressionNotes(t *testing.T) {
+	steps, err := ParseInjectExpression("{create-new*3:site} | https://github.com/acme/shop#apps/web")
+	if err != nil {
+		t.Fatalf("error parsing. Err: %v", err)
+	}
+	if len(steps) != 4 {
+		t.Fatalf("expected 4 steps; got %d", len(steps))
+	}
+	if steps[2].Note != "*3 creates 3 apps" || steps[2].Column != 1 {
+		t.Errorf("expected the *3 rule to be explained; got %+v", steps[2])
+	}
+	if steps[3].Expr != "https://github.com/acme/shop#apps/web" || steps[3].Column != 23 || steps[3].Note != "named after the subdirectory" {
+		t.Errorf("expected the import to be located and explained; got %+v", steps[3])
+	}
+}
@@ -1,14 +1,18 @@
 package utils
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
-	"log"
+	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
 	"strings"
+	"sync"
+	"time"
 
 	"golang.org/x/text/cases"
 	"golang.org/x/text/language"
@@ -16,47 +20,248 @@ import (
 
 // InjectionInstruction represents a single injection operation
 type InjectionInstruction struct {
-	Type    string // "create-new" or "import-repo"
-	RepoURL string // For import-repo type
-	AppName string // Name for the app
-	Branch  string // Branch to use (optional, defaults to main/master)
+	Type      string   // "create-new", "import-repo", "create-lib" or "import-lib"
+	RepoURL   string   // For import-repo and import-lib types
+	AppName   string   // Name for the app or library
+	Branch    string   // Branch, tag or commit SHA to use (optional, defaults to main/master)
+	Subdir    string   // Only import this directory of the repository (optional)
+	Tags      []string // Nx project tags (optional)
+	Framework string   // Library framework: "react" (default) or "ts"
+	Buildable bool     // Give the library a build target (libraries only)
 }
 
-// ProcessInjectionInstructions processes all injection instructions for the monorepo
-func ProcessInjectionInstructions(ctx context.Context, workspacePath string, instructions []InjectionInstruction) error {
-	fmt.Printf("Processing %d injection instructions...\n", len(instructions))
+// projectNameRegex matches names that are valid both as an unscoped npm
+// package name and as an Nx project name: lower case, URL-safe and free of
+// the ':' Nx uses to separate a project from its target.
+var projectNameRegex = regexp.MustCompile(`^[a-z0-9][a-z0-9._~-]*$`)
+
+// ValidateProjectName checks that name can be used as an app directory,
+// npm package name and Nx project name.
+func ValidateProjectName(name string) error {
+	switch {
+	case name == "":
+		return fmt.Errorf("app name is empty")
+	case len(name) > 214:
+		return fmt.Errorf("app name %q is longer than 214 characters", name)
+	case strings.ToLower(name) != name:
+		return fmt.Errorf("app name %q must be lower case", name)
+	case !projectNameRegex.MatchString(name):
+		return fmt.Errorf("app name %q must start with a letter or digit and contain only letters, digits, '-', '.', '_' and '~'", name)
+	case name == "node_modules" || name == "favicon.ico":
+		return fmt.Errorf("app name %q is reserved", name)
+	}
+	return nil
+}
+
+// InjectionOptions controls how injection instructions are processed.
+type InjectionOptions struct {
+	Jobs            int       // Instructions processed at the same time (default: 1)
+	PreserveHistory bool      // Make the workspace a git repository and merge in the history of imports
+	Output          io.Writer // Receives progress output (default: os.Stdout)
+	SkipExternal    bool      // Leave out instructions that are IsExternal, as a dry run does
+}
 
+// IsExternal reports whether the instruction needs the network and writes
+// outside the workspace: create-new runs create-nx-workspace through npx,
+// which fills the npm cache, and git imports clone their repository.
+func (i InjectionInstruction) IsExternal() bool {
+	switch i.Type {
+	case "create-new":
+		return true
+	case "import-repo", "import-lib":
+		return importKind(i.RepoURL) == ImportGit
+	}
+	return false
+}
+
+// ProcessInjectionInstructions processes all injection instructions for the monorepo.
+// Up to opts.Jobs instructions run at the same time, each with its output
+// prefixed by its project name. The first failure cancels the others.
+func ProcessInjectionInstructions(ctx context.Context, workspacePath string, instructions []InjectionInstruction, opts InjectionOptions) error {
+	// Instructions run in any order, so no two may write to the same project
+	roots := make(map[string]int)
 	for i, instruction := range instructions {
-		fmt.Printf("[%d/%d] Processing %s: %s\n", i+1, len(instructions), instruction.Type, instruction.AppName)
+		if other, ok := roots[instruction.ProjectRoot()]; ok {
+			return fmt.Errorf("instructions %d and %d both write to %s", other+1, i+1, instruction.ProjectRoot())
+		}
+		roots[instruction.ProjectRoot()] = i
+	}
 
-		switch instruction.Type {
-		case "create-new":
-			err := createNewReactApp(workspacePath, instruction.AppName)
-			if err != nil {
-				return fmt.Errorf("failed to create new React app %s: %w", instruction.AppName, err)
+	output := opts.Output
+	if output == nil {
+		output = os.Stdout
+	}
+	if opts.SkipExternal {
+		var kept []InjectionInstruction
+		for _, instruction := range instructions {
+			if instruction.IsExternal() {
+				fmt.Fprintf(output, "Skipping %s: %s (needs the network)\n", instruction.Type, instruction.AppName)
+				continue
 			}
-		case "import-repo":
-			err := importExistingRepo(ctx, workspacePath, instruction)
-			if err != nil {
-				return fmt.Errorf("failed to import repo %s: %w", instruction.RepoURL, err)
+			kept = append(kept, instruction)
+		}
+		instructions = kept
+	}
+	jobs := min(max(opts.Jobs, 1), max(len(instructions), 1))
+	if jobs > 1 {
+		fmt.Fprintf(output, "Processing %d injection instructions, %d at a time...\n", len(instructions), jobs)
+	} else {
+		fmt.Fprintf(output, "Processing %d injection instructions...\n", len(instructions))
+	}
+
+	if opts.PreserveHistory {
+		// Imports fetch their history into the workspace repository
+		if _, err := openGitRepo(ctx, workspacePath); err != nil {
+			return fmt.Errorf("failed to initialise workspace repository: %w", err)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		mu       sync.Mutex // Guards firstErr and serializes prefixed output
+		firstErr error
+		wg       sync.WaitGroup
+	)
+	next := make(chan int)
+	for w := 0; w < jobs; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				if ctx.Err() != nil {
+					continue // Canceled while waiting for a worker
+				}
+				instruction := instructions[i]
+				out := output
+				var prefixed *prefixWriter
+				if jobs > 1 {
+					prefixed = &prefixWriter{mu: &mu, w: output, prefix: fmt.Sprintf("[%s] ", instruction.AppName)}
+					out = prefixed
+				}
+
+				fmt.Fprintf(out, "[%d/%d] Processing %s: %s\n", i+1, len(instructions), instruction.Type, instruction.AppName)
+				err := processInstruction(ctx, out, workspacePath, instruction, opts)
+				if prefixed != nil {
+					prefixed.Flush()
+				}
+				if err != nil {
+					mu.Lock()
+					if firstErr == nil {
+						firstErr = err
+						cancel()
+					}
+					mu.Unlock()
+				}
 			}
-		default:
-			return fmt.Errorf("unknown instruction type: %s", instruction.Type)
+		}()
+	}
+
+feed:
+	for i := range instructions {
+		select {
+		case next <- i:
+		case <-ctx.Done():
+			break feed
 		}
 	}
+	close(next)
+	wg.Wait()
+
+	if firstErr != nil {
+		return firstErr
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 
-	// Update workspace configuration after all apps are added
-	err := updateMonorepoConfig(workspacePath, instructions)
+	// Update workspace configuration after all apps are added, in the
+	// order the instructions were given
+	err := updateMonorepoConfig(output, workspacePath, instructions)
 	if err != nil {
 		return fmt.Errorf("failed to update monorepo configuration: %w", err)
 	}
 
+	if opts.PreserveHistory {
+		err = mergeImportHistory(ctx, output, workspacePath, instructions)
+		if err != nil {
+			return fmt.Errorf("failed to merge imported history: %w", err)
+		}
+	}
+
 	return nil
 }
 
+// processInstruction creates or imports the project of one instruction.
+func processInstruction(ctx context.Context, out io.Writer, workspacePath string, instruction InjectionInstruction, opts InjectionOptions) error {
+	switch instruction.Type {
+	case "create-new":
+		err := createNewReactApp(ctx, out, workspacePath, instruction.AppName)
+		if err != nil {
+			return fmt.Errorf("failed to create new React app %s: %w", instruction.AppName, err)
+		}
+	case "import-repo", "import-lib":
+		err := importExistingRepo(ctx, out, workspacePath, instruction, opts)
+		if err != nil {
+			return fmt.Errorf("failed to import repo %s: %w", instruction.RepoURL, err)
+		}
+	case "create-lib":
+		err := createLibrary(out, workspacePath, instruction)
+		if err != nil {
+			return fmt.Errorf("failed to create library %s: %w", instruction.AppName, err)
+		}
+	default:
+		return fmt.Errorf("unknown instruction type: %s", instruction.Type)
+	}
+
+	if len(instruction.Tags) > 0 {
+		err := setProjectTags(filepath.Join(workspacePath, filepath.FromSlash(instruction.ProjectRoot())), instruction.Tags)
+		if err != nil {
+			return fmt.Errorf("failed to tag project %s: %w", instruction.AppName, err)
+		}
+	}
+	return nil
+}
+
+// prefixWriter writes complete lines to w, each starting with prefix.
+// Writers sharing mu do not interleave their lines.
+type prefixWriter struct {
+	mu     *sync.Mutex
+	w      io.Writer
+	prefix string
+	buf    []byte // Incomplete last line
+}
+
+func (p *prefixWriter) Write(b []byte) (int, error) {
+	p.buf = append(p.buf, b...)
+	for {
+		i := bytes.IndexByte(p.buf, '\n')
+		if i < 0 {
+			return len(b), nil
+		}
+		p.writeLine(p.buf[:i+1])
+		p.buf = p.buf[i+1:]
+	}
+}
+
+// Flush writes an incomplete last line.
+func (p *prefixWriter) Flush() {
+	if len(p.buf) > 0 {
+		p.writeLine(append(p.buf, '\n'))
+		p.buf = nil
+	}
+}
+
+func (p *prefixWriter) writeLine(line []byte) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	fmt.Fprintf(p.w, "%s%s", p.prefix, line)
+}
+
 // createNewReactApp creates a new React application in the monorepo
-func createNewReactApp(workspacePath, appName string) error {
-	fmt.Printf("Creating new React app with Vite: %s\n", appName)
+func createNewReactApp(ctx context.Context, out io.Writer, workspacePath, appName string) error {
+	fmt.Fprintf(out, "Creating new React app with Vite: %s\n", appName)
 
 	// Create the app directory path
 	// appPath := filepath.Join(workspacePath, "apps", appName)
@@ -69,30 +274,35 @@ func createNewReactApp(workspacePath, appName string) error {
 	}
 
 	// Use create-nx-workspace to generate a standalone React app with Vite
-	cmd := exec.Command("npx", "create-nx-workspace@latest", appName,
+	cmd := exec.CommandContext(ctx, "npx", "create-nx-workspace@latest", appName,
 		"--preset=react-standalone",
 		"--bundler=vite",
+		"--skipGit", // The app belongs to the workspace repository, not its own
 		"--interactive=false")
 	cmd.Dir = appsDir
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+	cmd.Stdout = out
+	cmd.Stderr = out
+	cmd.WaitDelay = 5 * time.Second // npm's child processes may keep the output open
 
 	err = cmd.Run()
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
 	if err != nil {
-		fmt.Printf("Nx workspace creation failed, falling back to manual creation: %v\n", err)
-		return createReactAppManually(workspacePath, appName)
+		fmt.Fprintf(out, "Nx workspace creation failed, falling back to manual creation: %v\n", err)
+		return createReactAppManually(out, workspacePath, appName)
 	}
 
 	// Move the generated workspace into the apps directory structure
 	generatedPath := filepath.Join(appsDir, appName)
 	if _, err := os.Stat(generatedPath); err == nil {
 		// The workspace was created successfully
-		fmt.Printf("✅ Successfully created React app with Vite: %s\n", appName)
+		fmt.Fprintf(out, "✅ Successfully created React app with Vite: %s\n", appName)
 		return nil
 	}
 
 	// If something went wrong, fall back to manual creation
-	return createReactAppManually(workspacePath, appName)
+	return createReactAppManually(out, workspacePath, appName)
 }
 
 // createTsConfigBase creates the base TypeScript configuration file
@@ -123,7 +333,8 @@ func createNewReactApp(workspacePath, appName string) error {
 // }
 
 // createReactAppManually creates a basic React app structure when Nx CLI is not available
-func createReactAppManually(workspacePath, appName string) error {
+func createReactAppManually(out io.Writer, workspacePath, appName string) error {
+	fmt.Fprintf(out, "Generating React app files: %s\n", appName)
 	appPath := filepath.Join(workspacePath, "apps", appName)
 
 	// Create directory structure
@@ -164,24 +375,59 @@ func createReactAppManually(workspacePath, appName string) error {
 	return nil
 }
 
-// importExistingRepo imports an existing React repository into the monorepo
-func importExistingRepo(_ context.Context, workspacePath string, instruction InjectionInstruction) error {
-	fmt.Printf("Importing existing repo: %s as %s\n", instruction.RepoURL, instruction.AppName)
-
-	appPath := filepath.Join(workspacePath, "apps", instruction.AppName)
+// importExistingRepo imports an existing React repository into the monorepo,
+// as an app or, for import-lib, as a library
+func importExistingRepo(ctx context.Context, out io.Writer, workspacePath string, instruction InjectionInstruction, opts InjectionOptions) error {
+	if importKind(instruction.RepoURL) != ImportGit {
+		return importLocalSource(ctx, out, workspacePath, instruction, opts)
+	}
+	fmt.Fprintf(out, "Importing existing repo: %s as %s\n", instruction.RepoURL, instruction.AppName)
+	if instruction.Branch != "" {
+		fmt.Fprintf(out, "Using ref: %s\n", instruction.Branch)
+	}
+	if instruction.Subdir != "" {
+		fmt.Fprintf(out, "Using repository subdirectory: %s\n", instruction.Subdir)
+	}
 
-	// Clone the repository
-	branch := instruction.Branch
-	if branch == "" {
-		branch = "main" // Default branch
+	appPath := filepath.Join(workspacePath, filepath.FromSlash(instruction.ProjectRoot()))
+	clonePath := appPath
+	if instruction.Subdir != "" {
+		if reason := unsafeEntryName(instruction.Subdir); reason != "" {
+			return fmt.Errorf("invalid subdirectory %s: %s", instruction.Subdir, reason)
+		}
+		clonePath = appPath + ".clone"
+		defer os.RemoveAll(clonePath)
 	}
 
-	// Try main first, then master
-	err := cloneRepo(instruction.RepoURL, appPath, "main")
+	// Clone the requested branch, tag or commit, or try main first, then master
+	var err error
+	if instruction.Branch != "" {
+		err = cloneRepo(ctx, instruction.RepoURL, clonePath, instruction.Branch)
+	} else {
+		err = cloneRepo(ctx, instruction.RepoURL, clonePath, "main")
+		if err != nil && ctx.Err() == nil {
+			err = cloneRepo(ctx, instruction.RepoURL, clonePath, "master")
+		}
+	}
 	if err != nil {
-		err = cloneRepo(instruction.RepoURL, appPath, "master")
+		return fmt.Errorf("failed to clone repository: %w", err)
+	}
+	if opts.PreserveHistory {
+		err = fetchImportHistory(ctx, out, workspacePath, clonePath, instruction)
 		if err != nil {
-			return fmt.Errorf("failed to clone repository: %w", err)
+			return err
+		}
+	}
+
+	// Keep only the requested directory
+	if instruction.Subdir != "" {
+		subdirPath := filepath.Join(clonePath, filepath.FromSlash(instruction.Subdir))
+		if info, err := os.Stat(subdirPath); err != nil || !info.IsDir() {
+			return fmt.Errorf("directory %s not found in %s", instruction.Subdir, instruction.RepoURL)
+		}
+		err = os.Rename(subdirPath, appPath)
+		if err != nil {
+			return fmt.Errorf("failed to move %s into place: %w", instruction.Subdir, err)
 		}
 	}
 
@@ -189,26 +435,119 @@ func importExistingRepo(_ context.Context, workspacePath string, instruction Inj
 	gitDir := filepath.Join(appPath, ".git")
 	err = os.RemoveAll(gitDir)
 	if err != nil {
-		fmt.Printf("Warning: failed to remove .git directory: %v\n", err)
+		fmt.Fprintf(out, "Warning: failed to remove .git directory: %v\n", err)
 	}
 
-	// Convert to Nx project structure
-	err = convertToNxProject(appPath, instruction.AppName)
+	return convertImport(out, workspacePath, appPath, instruction)
+}
+
+// importLocalSource copies a local directory, without .git and
+// node_modules, or extracts a local archive into the monorepo.
+func importLocalSource(ctx context.Context, out io.Writer, workspacePath string, instruction InjectionInstruction, opts InjectionOptions) error {
+	fmt.Fprintf(out, "Importing local path: %s as %s\n", instruction.RepoURL, instruction.AppName)
+
+	if _, err := os.Stat(instruction.RepoURL); err != nil {
+		return fmt.Errorf("import path %s: %w", instruction.RepoURL, err)
+	}
+	if opts.PreserveHistory {
+		// The history of a local checkout is kept; its uncommitted changes
+		// end up in the conversion commit
+		if _, err := os.Stat(filepath.Join(instruction.RepoURL, ".git")); err == nil {
+			err = fetchImportHistory(ctx, out, workspacePath, instruction.RepoURL, instruction)
+			if err != nil {
+				return err
+			}
+		} else {
+			fmt.Fprintf(out, "Warning: %s is not a git checkout, so it has no history to preserve\n", instruction.RepoURL)
+		}
+	}
+	source, err := NewLocalTemplateSource(instruction.RepoURL)
+	if err != nil {
+		return err
+	}
+
+	appPath := filepath.Join(workspacePath, filepath.FromSlash(instruction.ProjectRoot()))
+	_, err = source.Fetch(ctx, appPath, ExtractOptions{Subdir: instruction.Subdir, Exclude: []string{"node_modules"}})
+	if err != nil {
+		return fmt.Errorf("failed to copy %s: %w", instruction.RepoURL, err)
+	}
+
+	return convertImport(out, workspacePath, appPath, instruction)
+}
+
+// convertImport converts an imported app or library to Nx project structure
+func convertImport(out io.Writer, workspacePath, projectPath string, instruction InjectionInstruction) error {
+	var err error
+	if instruction.IsLibrary() {
+		err = convertToNxLibrary(out, workspacePath, projectPath, instruction)
+	} else {
+		err = convertToNxProject(out, projectPath, instruction.AppName)
+	}
 	if err != nil {
 		return fmt.Errorf("failed to convert to Nx project: %w", err)
 	}
+	return nil
+}
+
+// cloneRepo clones a Git repository at a branch or tag. Refs that look
+// like a commit SHA are fetched by commit when no branch or tag matches.
+func cloneRepo(ctx context.Context, repoURL, destPath, branch string) error {
+	err := runGit(ctx, "", "clone", "--branch", branch, "--depth", "1", "--", repoURL, destPath)
+	if err == nil || ctx.Err() != nil || !abbreviatedSHARegex.MatchString(branch) {
+		return err
+	}
+	os.RemoveAll(destPath)
+	return cloneCommit(ctx, repoURL, destPath, branch)
+}
+
+// cloneCommit checks out a single commit. Servers that allow it send only
+// that commit; otherwise, and for abbreviated SHAs, the full history is
+// fetched.
+func cloneCommit(ctx context.Context, repoURL, destPath, commit string) error {
+	err := runGit(ctx, "", "init", "--quiet", "--", destPath)
+	if err != nil {
+		return err
+	}
+	err = runGit(ctx, destPath, "remote", "add", "origin", repoURL)
+	if err != nil {
+		return err
+	}
 
+	if len(commit) == 40 && runGit(ctx, destPath, "fetch", "--quiet", "--depth", "1", "origin", commit) == nil {
+		return runGit(ctx, destPath, "checkout", "--quiet", "--detach", "FETCH_HEAD")
+	}
+	err = runGit(ctx, destPath, "fetch", "--quiet", "origin")
+	if err != nil {
+		return err
+	}
+	err = runGit(ctx, destPath, "checkout", "--quiet", "--detach", commit)
+	if err != nil {
+		return fmt.Errorf("%s is not a branch, tag or commit of %s: %w", commit, repoURL, err)
+	}
 	return nil
 }
 
-// cloneRepo clones a Git repository
-func cloneRepo(repoURL, destPath, branch string) error {
-	cmd := exec.Command("git", "clone", "--branch", branch, "--depth", "1", repoURL, destPath)
-	return cmd.Run()
+// runGit runs a git command in dir and includes git's output in the error.
+// The command is killed when ctx is canceled.
+func runGit(ctx context.Context, dir string, args ...string) error {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	output, err := cmd.CombinedOutput()
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if err != nil {
+		message := strings.TrimSpace(string(output))
+		if message == "" {
+			return fmt.Errorf("git %s: %w", args[0], err)
+		}
+		return fmt.Errorf("git %s: %w: %s", args[0], err, message)
+	}
+	return nil
 }
 
 // convertToNxProject converts an existing React app to Nx project structure
-func convertToNxProject(appPath, appName string) error {
+func convertToNxProject(out io.Writer, appPath, appName string) error {
 	// Create project.json for the imported app
 	err := createProjectJsonForImportedApp(appPath, appName)
 	if err != nil {
@@ -231,7 +570,7 @@ func convertToNxProject(appPath, appName string) error {
 	}
 
 	// Create TypeScript configuration files
-	err = createTsConfigForImportedApp(appPath, appName)
+	err = createTsConfigForImportedApp(out, appPath, appName)
 	if err != nil {
 		return fmt.Errorf("failed to create TypeScript config: %w", err)
 	}
@@ -256,8 +595,8 @@ func convertToNxProject(appPath, appName string) error {
 }
 
 // createTsConfigForImportedApp creates TypeScript configuration for imported apps
-func createTsConfigForImportedApp(appPath, appName string) error {
-	fmt.Printf("Generating TypeScript configuration for app: %s\n", appName)
+func createTsConfigForImportedApp(out io.Writer, appPath, appName string) error {
+	fmt.Fprintf(out, "Generating TypeScript configuration for app: %s\n", appName)
 	// Main tsconfig.json
 	tsConfig := `{
   "extends": "../../tsconfig.base.json",
@@ -468,8 +807,30 @@ func createProjectJsonForImportedApp(appPath, appName string) error {
 	return nil
 }
 
+// setProjectTags sets the Nx tags in an app's project.json.
+func setProjectTags(appPath string, tags []string) error {
+	projectJSONPath := filepath.Join(appPath, "project.json")
+	data, err := os.ReadFile(projectJSONPath)
+	if err != nil {
+		return err
+	}
+
+	var projectJSON map[string]interface{}
+	err = json.Unmarshal(data, &projectJSON)
+	if err != nil {
+		return fmt.Errorf("invalid project.json: %w", err)
+	}
+	projectJSON["tags"] = tags
+
+	updatedData, err := json.MarshalIndent(projectJSON, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(projectJSONPath, updatedData, 0644)
+}
+
 // updateMonorepoConfig updates the workspace configuration after all apps are added
-func updateMonorepoConfig(workspacePath string, instructions []InjectionInstruction) error {
+func updateMonorepoConfig(out io.Writer, workspacePath string, instructions []InjectionInstruction) error {
 	// Update nx.json to include all apps
 	nxJSONPath := filepath.Join(workspacePath, "nx.json")
 	err := updateNxJSONForMonorepo(nxJSONPath, instructions)
@@ -484,6 +845,12 @@ func updateMonorepoConfig(workspacePath string, instructions []InjectionInstruct
 		return fmt.Errorf("failed to update root package.json: %w", err)
 	}
 
+	// Register library aliases so apps can import them
+	err = updateTsConfigBasePaths(out, workspacePath, instructions)
+	if err != nil {
+		return fmt.Errorf("failed to update tsconfig.base.json: %w", err)
+	}
+
 	return nil
 }
 
@@ -529,7 +896,6 @@ func generateProjectJSON(appName string) string {
 }
 
 func generateMainTsx(appName string) string {
-	log.Default().Println("Generating main.tsx for app:", appName)
 	return `import { StrictMode } from 'react';
 import * as ReactDOM from 'react-dom/client';
 
@@ -613,7 +979,6 @@ func generateIndexHTML(appName string) string {
 }
 
 func generateTsConfig(appName string) string {
-	fmt.Fprintf(os.Stdout, "Generating tsconfig.json for app: %s\n", appName)
 	return `{
   "extends": "../../tsconfig.base.json",
   "compilerOptions": {
@@ -748,13 +1113,32 @@ func updateRootPackageJSON(packageJSONPath string, instructions []InjectionInstr
 	scripts["serve"] = "nx serve"
 	scripts["graph"] = "nx graph"
 
-	// Add app-specific scripts for each instruction
+	// Add project-specific scripts for each instruction; libraries are not
+	// served and only built when buildable
+	buildableLibs := false
 	for _, instruction := range instructions {
 		appName := instruction.AppName
-		scripts[fmt.Sprintf("build:%s", appName)] = fmt.Sprintf("nx build %s", appName)
-		scripts[fmt.Sprintf("serve:%s", appName)] = fmt.Sprintf("nx serve %s", appName)
+		if !instruction.IsLibrary() || instruction.Buildable {
+			scripts[fmt.Sprintf("build:%s", appName)] = fmt.Sprintf("nx build %s", appName)
+		}
+		if !instruction.IsLibrary() {
+			scripts[fmt.Sprintf("serve:%s", appName)] = fmt.Sprintf("nx serve %s", appName)
+		}
 		scripts[fmt.Sprintf("test:%s", appName)] = fmt.Sprintf("nx test %s", appName)
 		scripts[fmt.Sprintf("lint:%s", appName)] = fmt.Sprintf("nx lint %s", appName)
+		buildableLibs = buildableLibs || (instruction.IsLibrary() && instruction.Buildable)
+	}
+
+	// Buildable libraries emit their type declarations with vite-plugin-dts
+	if buildableLibs {
+		devDependencies, ok := packageJSON["devDependencies"].(map[string]interface{})
+		if !ok {
+			devDependencies = make(map[string]interface{})
+			packageJSON["devDependencies"] = devDependencies
+		}
+		if _, exists := devDependencies["vite-plugin-dts"]; !exists {
+			devDependencies["vite-plugin-dts"] = "latest"
+		}
 	}
 
 	// Write back to file
@@ -0,0 +1,97 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestPrefixWriter(t *testing.T) {
+	var out bytes.Buffer
+	var mu sync.Mutex
+	shop := &prefixWriter{mu: &mu, w: &out, prefix: "[shop] "}
+	blog := &prefixWriter{mu: &mu, w: &out, prefix: "[blog] "}
+
+	shop.Write([]byte("Cloning"))
+	blog.Write([]byte("Creating\nDone\n"))
+	shop.Write([]byte(" repo\nConverting"))
+	shop.Flush()
+
+	want := "[blog] Creating\n[blog] Done\n[shop] Cloning repo\n[shop] Converting\n"
+	if out.String() != want {
+		t.Errorf("expected output %q; got %q", want, out.String())
+	}
+}
+
+func TestProcessInjectionInstructionsFailure(t *testing.T) {
+	workspace := t.TempDir()
+	os.WriteFile(filepath.Join(workspace, "package.json"), []byte(`{"name": "store"}`), 0644)
+
+	// The first failure is returned and the workspace config left alone
+	instructions := []InjectionInstruction{
+		{Type: "create-lib", AppName: "ui"},
+		{Type: "import-lib", RepoURL: filepath.Join(workspace, "missing"), AppName: "missing"},
+		{Type: "create-lib", AppName: "utils", Framework: LibTS},
+	}
+	err := ProcessInjectionInstructions(context.Background(), workspace, instructions, InjectionOptions{Jobs: 3})
+	if err == nil || !strings.Contains(err.Error(), "missing") {
+		t.Fatalf("expected the failing import to be reported; got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(workspace, "tsconfig.base.json")); err == nil {
+		t.Errorf("expected the workspace config not to be updated after a failure")
+	}
+
+	// A canceled context stops before any instruction runs
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = ProcessInjectionInstructions(ctx, workspace, []InjectionInstruction{{Type: "create-lib", AppName: "forms"}}, InjectionOptions{Jobs: 2})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled; got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(workspace, "libs", "forms")); err == nil {
+		t.Errorf("expected no library to be created after cancellation")
+	}
+
+	// Two instructions may not write to the same project
+	err = ProcessInjectionInstructions(context.Background(), workspace, []InjectionInstruction{
+		{Type: "create-new", AppName: "admin"},
+		{Type: "import-repo", RepoURL: "https://github.com/acme/admin", AppName: "admin"},
+	}, InjectionOptions{})
+	if err == nil || !strings.Contains(err.Error(), "apps/admin") {
+		t.Errorf("expected an error for two instructions writing to apps/admin; got %v", err)
+	}
+}
+
+func TestProcessInjectionInstructionsSkipExternal(t *testing.T) {
+	workspace := t.TempDir()
+	os.WriteFile(filepath.Join(workspace, "package.json"), []byte(`{"name": "store"}`), 0644)
+	os.WriteFile(filepath.Join(workspace, "nx.json"), []byte(`{}`), 0644)
+
+	// Neither npx nor git is run, so the unreachable URL is never cloned
+	instructions := []InjectionInstruction{
+		{Type: "create-new", AppName: "admin"},
+		{Type: "import-repo", RepoURL: "https://invalid.example/acme/shop", AppName: "shop"},
+		{Type: "create-lib", AppName: "ui"},
+	}
+	var out bytes.Buffer
+	err := ProcessInjectionInstructions(context.Background(), workspace, instructions, InjectionOptions{Output: &out, SkipExternal: true})
+	if err != nil {
+		t.Fatalf("error processing instructions. Err: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(workspace, "libs", "ui")); err != nil {
+		t.Errorf("expected libs/ui to be created; got %v", err)
+	}
+	for _, app := range []string{"admin", "shop"} {
+		if _, err := os.Stat(filepath.Join(workspace, "apps", app)); err == nil {
+			t.Errorf("expected apps/%s to be skipped", app)
+		}
+		if !strings.Contains(out.String(), "Skipping") || !strings.Contains(out.String(), ": "+app+" ") {
+			t.Errorf("expected %s to be reported as skipped; got %q", app, out.String())
+		}
+	}
+}
@@ -0,0 +1,254 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// PatchOperation is a single JSON Patch (RFC 6902) operation. The add,
+// remove, replace, move, copy and test operations are supported.
+type PatchOperation struct {
+	Op    string      `yaml:"op"`
+	Path  string      `yaml:"path"`
+	From  string      `yaml:"from"` // Source pointer for move and copy
+	Value interface{} `yaml:"value"`
+}
+
+func (op PatchOperation) validate() error {
+	switch op.Op {
+	case "add", "remove", "replace", "test":
+	case "move", "copy":
+		if _, err := parsePointer(op.From); err != nil {
+			return fmt.Errorf("from: %w", err)
+		}
+	default:
+		return fmt.Errorf("unknown op %q (expected add, remove, replace, move, copy or test)", op.Op)
+	}
+	_, err := parsePointer(op.Path)
+	return err
+}
+
+// patchJSONFile applies operations to a JSON file in place. Either all
+// operations succeed or the file is left unchanged.
+func patchJSONFile(path string, operations []PatchOperation) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var doc interface{}
+	err = json.Unmarshal(data, &doc)
+	if err != nil {
+		return fmt.Errorf("invalid JSON: %w", err)
+	}
+
+	doc, err = applyJSONPatch(doc, operations)
+	if err != nil {
+		return err
+	}
+
+	updatedData, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(updatedData, '\n'), 0644)
+}
+
+// applyJSONPatch applies operations to a decoded JSON document and returns
+// the patched document.
+func applyJSONPatch(doc interface{}, operations []PatchOperation) (interface{}, error) {
+	for i, op := range operations {
+		if err := op.validate(); err != nil {
+			return nil, fmt.Errorf("operation %d: %w", i+1, err)
+		}
+		path, _ := parsePointer(op.Path)
+		value := normalizeJSON(op.Value)
+
+		var err error
+		switch op.Op {
+		case "add":
+			doc, err = pointerAdd(doc, path, value)
+		case "remove":
+			doc, _, err = pointerRemove(doc, path)
+		case "replace":
+			doc, _, err = pointerRemove(doc, path)
+			if err == nil {
+				doc, err = pointerAdd(doc, path, value)
+			}
+		case "move", "copy":
+			from, _ := parsePointer(op.From)
+			var moved interface{}
+			moved, err = pointerGet(doc, from)
+			if err == nil && op.Op == "move" {
+				doc, _, err = pointerRemove(doc, from)
+			}
+			if err == nil {
+				doc, err = pointerAdd(doc, path, normalizeJSON(moved))
+			}
+		case "test":
+			var actual interface{}
+			actual, err = pointerGet(doc, path)
+			if err == nil && !reflect.DeepEqual(actual, value) {
+				err = fmt.Errorf("value at %s does not match", op.Path)
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("operation %d (%s %s): %w", i+1, op.Op, op.Path, err)
+		}
+	}
+	return doc, nil
+}
+
+// parsePointer splits a JSON Pointer (RFC 6901) into unescaped tokens.
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("JSON pointer %q must start with /", pointer)
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+	}
+	return tokens, nil
+}
+
+// normalizeJSON converts values decoded from YAML into the types produced by
+// encoding/json, so they compare and marshal like the rest of the document.
+func normalizeJSON(value interface{}) interface{} {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return value
+	}
+	var normalized interface{}
+	if json.Unmarshal(data, &normalized) != nil {
+		return value
+	}
+	return normalized
+}
+
+func pointerGet(doc interface{}, path []string) (interface{}, error) {
+	current := doc
+	for _, token := range path {
+		switch node := current.(type) {
+		case map[string]interface{}:
+			value, ok := node[token]
+			if !ok {
+				return nil, fmt.Errorf("member %q not found", token)
+			}
+			current = value
+		case []interface{}:
+			index, err := arrayIndex(token, len(node)-1)
+			if err != nil {
+				return nil, err
+			}
+			current = node[index]
+		default:
+			return nil, fmt.Errorf("cannot descend into %q of a scalar value", token)
+		}
+	}
+	return current, nil
+}
+
+// pointerAdd inserts value at path. Arrays accept an index or "-" to append.
+func pointerAdd(doc interface{}, path []string, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	parent, err := pointerGet(doc, path[:len(path)-1])
+	if err != nil {
+		return nil, err
+	}
+	last := path[len(path)-1]
+
+	switch node := parent.(type) {
+	case map[string]interface{}:
+		node[last] = value
+		return doc, nil
+	case []interface{}:
+		index := len(node)
+		if last != "-" {
+			index, err = arrayIndex(last, len(node))
+			if err != nil {
+				return nil, err
+			}
+		}
+		updated := append(node[:index:index], append([]interface{}{value}, node[index:]...)...)
+		return setParent(doc, path[:len(path)-1], updated)
+	default:
+		return nil, fmt.Errorf("cannot add %q to a scalar value", last)
+	}
+}
+
+// pointerRemove deletes the value at path and returns it.
+func pointerRemove(doc interface{}, path []string) (interface{}, interface{}, error) {
+	if len(path) == 0 {
+		return nil, doc, nil
+	}
+	parent, err := pointerGet(doc, path[:len(path)-1])
+	if err != nil {
+		return nil, nil, err
+	}
+	last := path[len(path)-1]
+
+	switch node := parent.(type) {
+	case map[string]interface{}:
+		value, ok := node[last]
+		if !ok {
+			return nil, nil, fmt.Errorf("member %q not found", last)
+		}
+		delete(node, last)
+		return doc, value, nil
+	case []interface{}:
+		index, err := arrayIndex(last, len(node)-1)
+		if err != nil {
+			return nil, nil, err
+		}
+		value := node[index]
+		updated := append(node[:index:index], node[index+1:]...)
+		doc, err = setParent(doc, path[:len(path)-1], updated)
+		return doc, value, err
+	default:
+		return nil, nil, fmt.Errorf("cannot remove %q from a scalar value", last)
+	}
+}
+
+// setParent stores a rebuilt array back into its parent, since slices
+// cannot be grown in place.
+func setParent(doc interface{}, path []string, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	parent, err := pointerGet(doc, path[:len(path)-1])
+	if err != nil {
+		return nil, err
+	}
+	last := path[len(path)-1]
+	switch node := parent.(type) {
+	case map[string]interface{}:
+		node[last] = value
+	case []interface{}:
+		index, err := arrayIndex(last, len(node)-1)
+		if err != nil {
+			return nil, err
+		}
+		node[index] = value
+	}
+	return doc, nil
+}
+
+func arrayIndex(token string, max int) (int, error) {
+	index, err := strconv.Atoi(token)
+	if err != nil || index < 0 || (token != "0" && strings.HasPrefix(token, "0")) {
+		return 0, fmt.Errorf("invalid array index %q", token)
+	}
+	if index > max {
+		return 0, fmt.Errorf("array index %d out of range", index)
+	}
+	return index, nil
+}
@@ -0,0 +1,569 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Library frameworks
+const (
+	LibReact = "react"
+	LibTS    = "ts"
+)
+
+// IsLibrary reports whether the instruction adds a library under libs/
+// rather than an app under apps/.
+func (i InjectionInstruction) IsLibrary() bool {
+	return i.Type == "create-lib" || i.Type == "import-lib"
+}
+
+// ProjectRoot returns the project directory relative to the workspace,
+// e.g. apps/shop or libs/ui.
+func (i InjectionInstruction) ProjectRoot() string {
+	if i.IsLibrary() {
+		return "libs/" + i.AppName
+	}
+	return "apps/" + i.AppName
+}
+
+// libFramework returns the framework of a library instruction, react by default.
+func libFramework(instruction InjectionInstruction) string {
+	if instruction.Framework == "" {
+		return LibReact
+	}
+	return instruction.Framework
+}
+
+// createLibrary creates a React or TypeScript library with an index barrel
+// in libs/. Buildable libraries get a Vite library build, the others only
+// a Vitest configuration.
+func createLibrary(out io.Writer, workspacePath string, instruction InjectionInstruction) error {
+	libName := instruction.AppName
+	framework := libFramework(instruction)
+	fmt.Fprintf(out, "Creating new %s library: %s\n", framework, libName)
+
+	libPath := filepath.Join(workspacePath, "libs", libName)
+	err := os.MkdirAll(filepath.Join(libPath, "src", "lib"), 0755)
+	if err != nil {
+		return fmt.Errorf("failed to create library directory: %w", err)
+	}
+
+	files := map[string]string{
+		"src/index.ts": fmt.Sprintf("export * from './lib/%s';\n", libName),
+	}
+	if framework == LibReact {
+		files[fmt.Sprintf("src/lib/%s.tsx", libName)] = generateLibComponent(libName)
+	} else {
+		files[fmt.Sprintf("src/lib/%s.ts", libName)] = generateLibModule(libName)
+	}
+	for filePath, content := range files {
+		err := os.WriteFile(filepath.Join(libPath, filepath.FromSlash(filePath)), []byte(content), 0644)
+		if err != nil {
+			return fmt.Errorf("failed to create file %s: %w", filePath, err)
+		}
+	}
+
+	err = writeLibraryConfig(workspacePath, libPath, instruction)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(out, "✅ Successfully created library: %s\n", libName)
+	return nil
+}
+
+// convertToNxLibrary turns an imported repository into an Nx library. An
+// index barrel is generated when the library has none.
+func convertToNxLibrary(out io.Writer, workspacePath, libPath string, instruction InjectionInstruction) error {
+	if libEntry(libPath) == "" {
+		err := createIndexBarrel(out, libPath)
+		if err != nil {
+			return fmt.Errorf("failed to create index barrel: %w", err)
+		}
+	}
+
+	packageJSONPath := filepath.Join(libPath, "package.json")
+	if _, err := os.Stat(packageJSONPath); err == nil {
+		err = updateImportedPackageJSON(packageJSONPath, libraryAlias(workspaceScope(workspacePath), instruction.AppName))
+		if err != nil {
+			return fmt.Errorf("failed to update package.json: %w", err)
+		}
+	}
+
+	for _, file := range []string{"webpack.config.js", "craco.config.js", "vite.config.js", "vitest.config.js"} {
+		os.Remove(filepath.Join(libPath, file))
+	}
+
+	return writeLibraryConfig(workspacePath, libPath, instruction)
+}
+
+// writeLibraryConfig writes project.json, the tsconfig files and the Vite
+// or Vitest configuration of a library.
+func writeLibraryConfig(workspacePath, libPath string, instruction InjectionInstruction) error {
+	libName := instruction.AppName
+	framework := libFramework(instruction)
+	entry := libEntry(libPath)
+
+	projectJSON, err := generateLibProjectJSON(libName, instruction.Buildable)
+	if err != nil {
+		return fmt.Errorf("failed to marshal project.json: %w", err)
+	}
+
+	files := map[string]string{
+		"project.json":       projectJSON,
+		"tsconfig.json":      generateLibTsConfig(framework),
+		"tsconfig.lib.json":  generateLibTsConfigLib(framework),
+		"tsconfig.spec.json": generateLibTsConfigSpec(),
+	}
+	if instruction.Buildable {
+		files["vite.config.ts"] = generateLibViteConfig(libName, framework, entry)
+		os.Remove(filepath.Join(libPath, "vitest.config.ts"))
+
+		// A package.json lets npm workspaces link the library by its alias
+		packageJSONPath := filepath.Join(libPath, "package.json")
+		if _, err := os.Stat(packageJSONPath); os.IsNotExist(err) {
+			files["package.json"] = generateLibPackageJSON(libraryAlias(workspaceScope(workspacePath), libName))
+		}
+	} else {
+		files["vitest.config.ts"] = generateLibVitestConfig(libName, framework)
+		os.Remove(filepath.Join(libPath, "vite.config.ts"))
+	}
+
+	for filename, content := range files {
+		err := os.WriteFile(filepath.Join(libPath, filename), []byte(content), 0644)
+		if err != nil {
+			return fmt.Errorf("failed to write %s: %w", filename, err)
+		}
+	}
+	return nil
+}
+
+// libEntry returns the index barrel of a library relative to the library,
+// or "" when it has none.
+func libEntry(libPath string) string {
+	for _, entry := range []string{"src/index.ts", "src/index.tsx"} {
+		if _, err := os.Stat(filepath.Join(libPath, filepath.FromSlash(entry))); err == nil {
+			return entry
+		}
+	}
+	return ""
+}
+
+// createIndexBarrel writes src/index.ts re-exporting every module directly
+// under src/, skipping tests and declaration files.
+func createIndexBarrel(out io.Writer, libPath string) error {
+	srcPath := filepath.Join(libPath, "src")
+	entries, err := os.ReadDir(srcPath)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	var barrel strings.Builder
+	for _, entry := range entries {
+		name := entry.Name()
+		ext := filepath.Ext(name)
+		if entry.IsDir() || (ext != ".ts" && ext != ".tsx") || strings.HasSuffix(name, ".d.ts") ||
+			strings.Contains(name, ".spec.") || strings.Contains(name, ".test.") {
+			continue
+		}
+		fmt.Fprintf(&barrel, "export * from './%s';\n", strings.TrimSuffix(name, ext))
+	}
+	if barrel.Len() == 0 {
+		barrel.WriteString("export {};\n")
+		fmt.Fprintf(out, "Warning: no modules found in %s to export from the index barrel\n", srcPath)
+	}
+
+	err = os.MkdirAll(srcPath, 0755)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(srcPath, "index.ts"), []byte(barrel.String()), 0644)
+}
+
+// workspaceScope returns the npm scope for library aliases: the scope of a
+// scoped root package name, otherwise the root package name itself. When
+// that is not a valid scope, the workspace directory name is tried, as is
+// and in kebab case, before falling back to "workspace".
+func workspaceScope(workspacePath string) string {
+	var packageJSON struct {
+		Name string `json:"name"`
+	}
+	data, err := os.ReadFile(filepath.Join(workspacePath, "package.json"))
+	if err == nil {
+		json.Unmarshal(data, &packageJSON)
+	}
+
+	scope := strings.TrimPrefix(packageJSON.Name, "@")
+	scope, _, _ = strings.Cut(scope, "/")
+	for _, candidate := range []string{scope, workspaceDirName(workspacePath)} {
+		for _, scope := range []string{strings.ToLower(candidate), toKebabCase(candidate)} {
+			if ValidateProjectName(scope) == nil {
+				return scope
+			}
+		}
+	}
+	return "workspace"
+}
+
+// libraryAlias returns the import path of a library, e.g. @acme/ui.
+func libraryAlias(scope, libName string) string {
+	return "@" + scope + "/" + libName
+}
+
+// updateTsConfigBasePaths registers the libraries of instructions in the
+// paths of tsconfig.base.json, creating the file when the template has none.
+func updateTsConfigBasePaths(out io.Writer, workspacePath string, instructions []InjectionInstruction) error {
+	tsconfigPath := filepath.Join(workspacePath, "tsconfig.base.json")
+	tsconfig := map[string]interface{}{
+		"compileOnSave": false,
+		"compilerOptions": map[string]interface{}{
+			"rootDir":                ".",
+			"sourceMap":              true,
+			"declaration":            false,
+			"moduleResolution":       "node",
+			"emitDecoratorMetadata":  true,
+			"experimentalDecorators": true,
+			"importHelpers":          true,
+			"target":                 "es2015",
+			"module":                 "esnext",
+			"lib":                    []string{"es2020", "dom"},
+			"skipLibCheck":           true,
+			"skipDefaultLibCheck":    true,
+			"baseUrl":                ".",
+		},
+		"exclude": []string{"node_modules", "tmp"},
+	}
+
+	data, err := os.ReadFile(tsconfigPath)
+	if err == nil {
+		tsconfig = nil
+		err = json.Unmarshal(data, &tsconfig)
+		if err != nil {
+			return fmt.Errorf("invalid tsconfig.base.json: %w", err)
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	compilerOptions, ok := tsconfig["compilerOptions"].(map[string]interface{})
+	if !ok {
+		compilerOptions = make(map[string]interface{})
+		tsconfig["compilerOptions"] = compilerOptions
+	}
+	if _, ok := compilerOptions["baseUrl"]; !ok {
+		compilerOptions["baseUrl"] = "."
+	}
+	paths, ok := compilerOptions["paths"].(map[string]interface{})
+	if !ok {
+		paths = make(map[string]interface{})
+		compilerOptions["paths"] = paths
+	}
+
+	scope := workspaceScope(workspacePath)
+	var aliases []string
+	for _, instruction := range instructions {
+		if !instruction.IsLibrary() {
+			continue
+		}
+		libRoot := instruction.ProjectRoot()
+		entry := libEntry(filepath.Join(workspacePath, filepath.FromSlash(libRoot)))
+		if entry == "" {
+			entry = "src/index.ts"
+		}
+		alias := libraryAlias(scope, instruction.AppName)
+		paths[alias] = []string{libRoot + "/" + entry}
+		aliases = append(aliases, alias)
+	}
+
+	updatedData, err := json.MarshalIndent(tsconfig, "", "  ")
+	if err != nil {
+		return err
+	}
+	err = os.WriteFile(tsconfigPath, updatedData, 0644)
+	if err != nil {
+		return err
+	}
+
+	sort.Strings(aliases)
+	for _, alias := range aliases {
+		fmt.Fprintf(out, "✅ Registered library alias %s\n", alias)
+	}
+	return nil
+}
+
+// Library file template generators
+func generateLibProjectJSON(libName string, buildable bool) (string, error) {
+	targets := map[string]interface{}{
+		"test": map[string]interface{}{
+			"executor": "@nx/vite:test",
+			"outputs":  []string{"{options.reportsDirectory}"},
+			"options": map[string]interface{}{
+				"passWithNoTests":  true,
+				"reportsDirectory": fmt.Sprintf("../../coverage/libs/%s", libName),
+			},
+		},
+		"lint": map[string]interface{}{
+			"executor": "@nx/eslint:lint",
+			"outputs":  []string{"{options.outputFile}"},
+			"options": map[string]interface{}{
+				"lintFilePatterns": []string{fmt.Sprintf("libs/%s/**/*.{ts,tsx,js,jsx}", libName)},
+			},
+		},
+	}
+	if buildable {
+		targets["build"] = map[string]interface{}{
+			"executor": "@nx/vite:build",
+			"outputs":  []string{"{options.outputPath}"},
+			"options": map[string]interface{}{
+				"outputPath": fmt.Sprintf("dist/libs/%s", libName),
+			},
+		}
+	}
+
+	projectJSON := map[string]interface{}{
+		"name":        libName,
+		"$schema":     "../../node_modules/nx/schemas/project-schema.json",
+		"projectType": "library",
+		"sourceRoot":  fmt.Sprintf("libs/%s/src", libName),
+		"targets":     targets,
+		"tags":        []string{},
+	}
+	data, err := json.MarshalIndent(projectJSON, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+func generateLibPackageJSON(alias string) string {
+	return fmt.Sprintf(`{
+  "name": "%s",
+  "version": "0.0.1",
+  "type": "module",
+  "main": "./index.cjs",
+  "module": "./index.js",
+  "types": "./index.d.ts"
+}`, alias)
+}
+
+func generateLibComponent(libName string) string {
+	componentName := strings.Join(identifierWords(libName), "")
+	return fmt.Sprintf(`export interface %sProps {
+  title?: string;
+}
+
+export function %s({ title = '%s' }: %sProps) {
+  return (
+    <div>
+      <h1>Welcome to {title}!</h1>
+    </div>
+  );
+}
+
+export default %s;
+`, componentName, componentName, libName, componentName, componentName)
+}
+
+func generateLibModule(libName string) string {
+	words := identifierWords(libName)
+	words[0] = strings.ToLower(words[0])
+	return fmt.Sprintf(`export function %s(): string {
+  return '%s';
+}
+`, strings.Join(words, ""), libName)
+}
+
+// identifierWords splits a project name into capitalized words that form a
+// valid identifier when joined.
+func identifierWords(name string) []string {
+	var words []string
+	for _, word := range strings.FieldsFunc(name, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9')
+	}) {
+		words = append(words, strings.ToUpper(word[:1])+word[1:])
+	}
+	if len(words) == 0 || words[0][0] >= '0' && words[0][0] <= '9' {
+		words = append([]string{"Lib"}, words...)
+	}
+	return words
+}
+
+func generateLibTsConfig(framework string) string {
+	jsx := ""
+	if framework == LibReact {
+		jsx = `
+    "jsx": "react-jsx",`
+	}
+	return fmt.Sprintf(`{
+  "extends": "../../tsconfig.base.json",
+  "compilerOptions": {%s
+    "allowJs": false,
+    "esModuleInterop": false,
+    "allowSyntheticDefaultImports": true,
+    "forceConsistentCasingInFileNames": true,
+    "strict": true,
+    "noImplicitOverride": true,
+    "noPropertyAccessFromIndexSignature": true,
+    "noImplicitReturns": true,
+    "noFallthroughCasesInSwitch": true
+  },
+  "files": [],
+  "include": [],
+  "references": [
+    {
+      "path": "./tsconfig.lib.json"
+    },
+    {
+      "path": "./tsconfig.spec.json"
+    }
+  ]
+}`, jsx)
+}
+
+func generateLibTsConfigLib(framework string) string {
+	types := `["node"]`
+	files := ""
+	if framework == LibReact {
+		types = `["node", "vite/client"]`
+		files = `
+  "files": [
+    "../../node_modules/@nx/react/typings/cssmodule.d.ts",
+    "../../node_modules/@nx/react/typings/image.d.ts"
+  ],`
+	}
+	return fmt.Sprintf(`{
+  "extends": "./tsconfig.json",
+  "compilerOptions": {
+    "outDir": "../../dist/out-tsc",
+    "types": %s
+  },%s
+  "exclude": [
+    "**/*.spec.ts",
+    "**/*.test.ts",
+    "**/*.spec.tsx",
+    "**/*.test.tsx",
+    "vite.config.ts",
+    "vitest.config.ts"
+  ],
+  "include": ["src/**/*.js", "src/**/*.jsx", "src/**/*.ts", "src/**/*.tsx"]
+}`, types, files)
+}
+
+func generateLibTsConfigSpec() string {
+	return `{
+  "extends": "./tsconfig.json",
+  "compilerOptions": {
+    "outDir": "../../dist/out-tsc",
+    "types": ["vitest/globals", "vitest/importMeta", "vite/client", "node"]
+  },
+  "include": [
+    "vite.config.ts",
+    "vitest.config.ts",
+    "src/**/*.test.ts",
+    "src/**/*.spec.ts",
+    "src/**/*.test.tsx",
+    "src/**/*.spec.tsx"
+  ]
+}`
+}
+
+// generateLibViteConfig returns the Vite library build of a buildable
+// library. Type declarations are emitted with vite-plugin-dts.
+func generateLibViteConfig(libName, framework, entry string) string {
+	reactImport, plugins, external, environment := "", "nxViteTsPaths()", "[]", "node"
+	if framework == LibReact {
+		reactImport = "import react from '@vitejs/plugin-react';\n"
+		plugins = "react(), nxViteTsPaths()"
+		external = "['react', 'react-dom', 'react/jsx-runtime']"
+		environment = "jsdom"
+	}
+	if entry == "" {
+		entry = "src/index.ts"
+	}
+
+	return fmt.Sprintf(`/// <reference types='vitest' />
+import { defineConfig } from 'vite';
+%simport dts from 'vite-plugin-dts';
+import * as path from 'path';
+import { nxViteTsPaths } from '@nx/vite/plugins/nx-tsconfig-paths.plugin';
+
+export default defineConfig({
+  root: __dirname,
+  cacheDir: '../../node_modules/.vite/libs/%s',
+
+  plugins: [
+    %s,
+    dts({ entryRoot: 'src', tsconfigPath: path.join(__dirname, 'tsconfig.lib.json') }),
+  ],
+
+  // Configuration for building the library.
+  build: {
+    outDir: '../../dist/libs/%s',
+    emptyOutDir: true,
+    reportCompressedSize: true,
+    commonjsOptions: {
+      transformMixedEsModules: true,
+    },
+    lib: {
+      entry: '%s',
+      name: '%s',
+      fileName: 'index',
+      formats: ['es', 'cjs'],
+    },
+    rollupOptions: {
+      // External packages that should not be bundled into the library.
+      external: %s,
+    },
+  },
+
+  test: {
+    watch: false,
+    globals: true,
+    environment: '%s',
+    include: ['src/**/*.{test,spec}.{js,mjs,cjs,ts,mts,cts,jsx,tsx}'],
+    reporters: ['default'],
+    coverage: {
+      reportsDirectory: '../../coverage/libs/%s',
+      provider: 'v8' as const,
+    },
+  },
+});
+`, reactImport, libName, plugins, libName, entry, libName, external, environment, libName)
+}
+
+// generateLibVitestConfig returns the test-only configuration of a library
+// that is consumed from source.
+func generateLibVitestConfig(libName, framework string) string {
+	reactImport, plugins, environment := "", "nxViteTsPaths()", "node"
+	if framework == LibReact {
+		reactImport = "import react from '@vitejs/plugin-react';\n"
+		plugins = "react(), nxViteTsPaths()"
+		environment = "jsdom"
+	}
+
+	return fmt.Sprintf(`import { defineConfig } from 'vitest/config';
+%simport { nxViteTsPaths } from '@nx/vite/plugins/nx-tsconfig-paths.plugin';
+
+export default defineConfig({
+  root: __dirname,
+  cacheDir: '../../node_modules/.vite/libs/%s',
+  plugins: [%s],
+  test: {
+    watch: false,
+    globals: true,
+    environment: '%s',
+    include: ['src/**/*.{test,spec}.{js,mjs,cjs,ts,mts,cts,jsx,tsx}'],
+    reporters: ['default'],
+    coverage: {
+      reportsDirectory: '../../coverage/libs/%s',
+      provider: 'v8' as const,
+    },
+  },
+});
+`, reactImport, libName, plugins, environment, libName)
+}
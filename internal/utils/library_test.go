@@ -0,0 +1,146 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLibraryInstructions(t *testing.T) {
+	workspace := t.TempDir()
+	os.WriteFile(filepath.Join(workspace, "package.json"), []byte(`{"name": "@acme/store"}`), 0644)
+	os.WriteFile(filepath.Join(workspace, "nx.json"), []byte(`{}`), 0644)
+
+	prototype := t.TempDir()
+	os.MkdirAll(filepath.Join(prototype, "src"), 0755)
+	os.WriteFile(filepath.Join(prototype, "src", "button.tsx"), []byte("export const Button = () => null;"), 0644)
+	os.WriteFile(filepath.Join(prototype, "src", "button.spec.tsx"), []byte(""), 0644)
+	os.WriteFile(filepath.Join(prototype, "package.json"), []byte(`{"name": "button", "devDependencies": {"vite": "5"}}`), 0644)
+
+	instructions := []InjectionInstruction{
+		{Type: "create-lib", AppName: "ui", Tags: []string{"type:ui"}},
+		{Type: "create-lib", AppName: "date-utils", Framework: LibTS, Buildable: true},
+		{Type: "import-lib", RepoURL: prototype, AppName: "button"},
+	}
+	var out strings.Builder
+	err := ProcessInjectionInstructions(context.Background(), workspace, instructions, InjectionOptions{Jobs: 2, Output: &out})
+	if err != nil {
+		t.Fatalf("error processing instructions. Err: %v", err)
+	}
+	if !strings.Contains(out.String(), "[ui] ") || !strings.Contains(out.String(), "Registered library alias @acme/ui") {
+		t.Errorf("expected prefixed progress output; got %q", out.String())
+	}
+
+	readJSON := func(path string, v interface{}) {
+		t.Helper()
+		data, err := os.ReadFile(filepath.Join(workspace, filepath.FromSlash(path)))
+		if err != nil {
+			t.Fatalf("error reading %s. Err: %v", path, err)
+		}
+		if err := json.Unmarshal(data, v); err != nil {
+			t.Fatalf("error parsing %s. Err: %v", path, err)
+		}
+	}
+
+	// Every library is registered under the workspace scope
+	var tsconfig struct {
+		CompilerOptions struct {
+			Paths map[string][]string `json:"paths"`
+		} `json:"compilerOptions"`
+	}
+	readJSON("tsconfig.base.json", &tsconfig)
+	wantPaths := map[string][]string{
+		"@acme/ui":         {"libs/ui/src/index.ts"},
+		"@acme/date-utils": {"libs/date-utils/src/index.ts"},
+		"@acme/button":     {"libs/button/src/index.ts"},
+	}
+	if !reflect.DeepEqual(tsconfig.CompilerOptions.Paths, wantPaths) {
+		t.Errorf("expected paths %v; got %v", wantPaths, tsconfig.CompilerOptions.Paths)
+	}
+
+	// Only buildable libraries have a build target and a Vite build
+	var project struct {
+		ProjectType string                 `json:"projectType"`
+		Targets     map[string]interface{} `json:"targets"`
+		Tags        []string               `json:"tags"`
+	}
+	readJSON("libs/ui/project.json", &project)
+	if project.ProjectType != "library" || project.Targets["build"] != nil || !reflect.DeepEqual(project.Tags, []string{"type:ui"}) {
+		t.Errorf("expected a tagged library without a build target; got %+v", project)
+	}
+	project.Targets = nil
+	readJSON("libs/date-utils/project.json", &project)
+	if project.Targets["build"] == nil {
+		t.Errorf("expected a build target for a buildable library")
+	}
+
+	for path, want := range map[string]string{
+		"libs/ui/src/index.ts":                  "export * from './lib/ui';",
+		"libs/ui/src/lib/ui.tsx":                "export function Ui(",
+		"libs/ui/vitest.config.ts":              "environment: 'jsdom'",
+		"libs/date-utils/src/lib/date-utils.ts": "export function dateUtils(): string",
+		"libs/date-utils/vite.config.ts":        "entry: 'src/index.ts'",
+		"libs/button/src/index.ts":              "export * from './button';\n",
+	} {
+		data, err := os.ReadFile(filepath.Join(workspace, filepath.FromSlash(path)))
+		if err != nil || !strings.Contains(string(data), want) {
+			t.Errorf("expected %s to contain %q; got %q (%v)", path, want, data, err)
+		}
+	}
+	if data, _ := os.ReadFile(filepath.Join(workspace, "libs", "button", "src", "index.ts")); strings.Contains(string(data), "spec") {
+		t.Errorf("expected tests to be left out of the index barrel; got %q", data)
+	}
+
+	// Imported and buildable libraries are named after their alias
+	var packageJSON struct {
+		Name string `json:"name"`
+	}
+	readJSON("libs/button/package.json", &packageJSON)
+	if packageJSON.Name != "@acme/button" {
+		t.Errorf("expected the imported package to be renamed to @acme/button; got %s", packageJSON.Name)
+	}
+	readJSON("libs/date-utils/package.json", &packageJSON)
+	if packageJSON.Name != "@acme/date-utils" {
+		t.Errorf("expected the buildable package to be named @acme/date-utils; got %s", packageJSON.Name)
+	}
+
+	var root struct {
+		Scripts         map[string]string `json:"scripts"`
+		DevDependencies map[string]string `json:"devDependencies"`
+	}
+	readJSON("package.json", &root)
+	if _, ok := root.Scripts["build:ui"]; ok {
+		t.Errorf("expected no build script for a library that is not buildable")
+	}
+	if _, ok := root.Scripts["serve:date-utils"]; ok {
+		t.Errorf("expected no serve script for a library")
+	}
+	if root.Scripts["build:date-utils"] == "" || root.DevDependencies["vite-plugin-dts"] == "" {
+		t.Errorf("expected a build script and vite-plugin-dts for a buildable library; got %+v", root)
+	}
+}
+
+func TestWorkspaceScope(t *testing.T) {
+	tests := []struct {
+		packageName, dir, expected string
+	}{
+		{"@Acme/store", "shop", "acme"},
+		{"store", "shop", "store"},
+		{"", "shop", "shop"},
+		{"@acme corp/store", "shop", "acme-corp"},
+		{"@../store", "My Shop", "my-shop"},
+		{"@../store", "__", "workspace"},
+	}
+	for _, tt := range tests {
+		workspace := filepath.Join(t.TempDir(), tt.dir)
+		os.MkdirAll(workspace, 0755)
+		os.WriteFile(filepath.Join(workspace, "package.json"), []byte(`{"name": "`+tt.packageName+`"}`), 0644)
+		if got := workspaceScope(workspace); got != tt.expected {
+			t.Errorf("workspaceScope(%q in %q): expected %q; got %q", tt.packageName, tt.dir, tt.expected, got)
+		}
+	}
+}
@@ -0,0 +1,470 @@
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ManifestFile is the name of the optional manifest at the root of a template.
+const ManifestFile = "nx-scaffolder.yaml"
+
+// Manifest describes how a template is turned into a workspace. It lets
+// template authors customise generation without changing the scaffolder.
+//
+//	name: react-vite
+//	variables:
+//	  - name: npmScope
+//	    prompt: npm scope for workspace packages
+//	    default: acme
+//	    pattern: ^[a-z][a-z0-9-]*$
+//	exclude: [docs, "*.md"]
+//	rename:
+//	  - from: gitignore
+//	    to: .gitignore
+//	render:
+//	  skip: [".github/**"]
+//	patches:
+//	  - file: package.json
+//	    operations:
+//	      - {op: replace, path: /name, value: "@{{ .npmScope }}/source"}
+//	postSteps:
+//	  - name: Install dependencies
+//	    run: npm install
+type Manifest struct {
+	Name              string             `yaml:"name"`
+	Description       string             `yaml:"description"`
+	Variables         []TemplateVariable `yaml:"variables"`
+	Exclude           []string           `yaml:"exclude"`           // Glob patterns removed from the workspace
+	Rename            []RenameRule       `yaml:"rename"`            // Paths moved after extraction
+	Render            RenderSettings     `yaml:"render"`            // How file contents and names are rendered
+	Patches           []FilePatch        `yaml:"patches"`           // JSON patches applied after the default configuration
+	PostSteps         []PostStep         `yaml:"postSteps"`         // Commands run once the workspace is complete
+	SkipDefaultConfig bool               `yaml:"skipDefaultConfig"` // Do not apply the built-in package.json and nx.json changes
+}
+
+// TemplateVariable is an input the template needs from the user.
+type TemplateVariable struct {
+	Name        string   `yaml:"name"`
+	Description string   `yaml:"description"`
+	Prompt      string   `yaml:"prompt"` // Question asked interactively (defaults to the description)
+	Default     string   `yaml:"default"`
+	Required    bool     `yaml:"required"` // An empty value is rejected
+	Pattern     string   `yaml:"pattern"`  // Regular expression the value must match
+	Choices     []string `yaml:"choices"`  // Allowed values (optional)
+}
+
+// RenameRule moves a file or directory of the template.
+type RenameRule struct {
+	From string `yaml:"from"`
+	To   string `yaml:"to"`
+}
+
+// FilePatch applies JSON Patch (RFC 6902) operations to a JSON file.
+type FilePatch struct {
+	File       string           `yaml:"file"`
+	Operations []PatchOperation `yaml:"operations"`
+}
+
+// PostStep is a shell command run in the workspace after generation, when
+// create is given --run-post-steps.
+// Template variables are available as environment variables.
+type PostStep struct {
+	Name            string            `yaml:"name"`
+	Run             string            `yaml:"run"`
+	Dir             string            `yaml:"dir"` // Relative to the workspace root
+	Env             map[string]string `yaml:"env"`
+	ContinueOnError bool              `yaml:"continueOnError"`
+}
+
+var variableNameRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// LoadManifest reads the manifest at the root of a generated workspace and
+// removes it, since it describes the template rather than the workspace.
+// It returns nil without error when the template has no manifest.
+func LoadManifest(workspacePath string) (*Manifest, error) {
+	manifestPath := filepath.Join(workspacePath, ManifestFile)
+	data, err := os.ReadFile(manifestPath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", ManifestFile, err)
+	}
+
+	manifest, err := ParseManifest(data)
+	if err != nil {
+		return nil, err
+	}
+
+	err = os.Remove(manifestPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to remove %s from the workspace: %w", ManifestFile, err)
+	}
+	return manifest, nil
+}
+
+// ParseManifest decodes and validates a manifest. Unknown keys are errors,
+// so typos do not silently change behaviour.
+func ParseManifest(data []byte) (*Manifest, error) {
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+
+	var manifest Manifest
+	err := decoder.Decode(&manifest)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("invalid %s: %w", ManifestFile, err)
+	}
+
+	err = manifest.validate()
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", ManifestFile, err)
+	}
+	return &manifest, nil
+}
+
+func (m *Manifest) validate() error {
+	seen := make(map[string]bool)
+	for _, v := range m.Variables {
+		if !variableNameRegex.MatchString(v.Name) {
+			return fmt.Errorf("variable name %q must be a letter or underscore followed by letters, digits or underscores", v.Name)
+		}
+		if seen[v.Name] {
+			return fmt.Errorf("variable %s is declared twice", v.Name)
+		}
+		seen[v.Name] = true
+
+		if v.Pattern != "" {
+			if _, err := regexp.Compile(v.Pattern); err != nil {
+				return fmt.Errorf("variable %s: invalid pattern: %w", v.Name, err)
+			}
+		}
+		if v.Default != "" {
+			if err := v.Validate(v.Default); err != nil {
+				return fmt.Errorf("default of %w", err)
+			}
+		}
+	}
+
+	if n := len(m.Render.Delims); n != 0 && n != 2 {
+		return fmt.Errorf("render delims must list a left and a right delimiter")
+	}
+
+	for _, rule := range m.Rename {
+		if reason := unsafeManifestPath(rule.From); reason != "" {
+			return fmt.Errorf("rename from %q: %s", rule.From, reason)
+		}
+		if reason := unsafeManifestPath(rule.To); reason != "" {
+			return fmt.Errorf("rename to %q: %s", rule.To, reason)
+		}
+	}
+
+	for _, patch := range m.Patches {
+		if reason := unsafeManifestPath(patch.File); reason != "" {
+			return fmt.Errorf("patch of %q: %s", patch.File, reason)
+		}
+		for i, op := range patch.Operations {
+			if err := op.validate(); err != nil {
+				return fmt.Errorf("patch of %s, operation %d: %w", patch.File, i+1, err)
+			}
+		}
+	}
+
+	for i, step := range m.PostSteps {
+		if strings.TrimSpace(step.Run) == "" {
+			return fmt.Errorf("post step %d has no run command", i+1)
+		}
+		if step.Dir != "" {
+			if reason := unsafeManifestPath(step.Dir); reason != "" {
+				return fmt.Errorf("post step %d dir %q: %s", i+1, step.Dir, reason)
+			}
+		}
+	}
+	return nil
+}
+
+// unsafeManifestPath returns why a workspace-relative path from the
+// manifest may not be used, or "".
+func unsafeManifestPath(p string) string {
+	if p == "" {
+		return "path is empty"
+	}
+	return unsafeEntryName(filepath.ToSlash(p))
+}
+
+// Validate checks a value against the variable's constraints.
+func (v TemplateVariable) Validate(value string) error {
+	if value == "" {
+		if v.Required {
+			return fmt.Errorf("variable %s is required", v.Name)
+		}
+		return nil
+	}
+	if v.Pattern != "" {
+		if ok, _ := regexp.MatchString(v.Pattern, value); !ok {
+			return fmt.Errorf("variable %s: %q does not match %s", v.Name, value, v.Pattern)
+		}
+	}
+	if len(v.Choices) > 0 {
+		for _, choice := range v.Choices {
+			if value == choice {
+				return nil
+			}
+		}
+		return fmt.Errorf("variable %s: %q is not one of %s", v.Name, value, strings.Join(v.Choices, ", "))
+	}
+	return nil
+}
+
+// Prompter asks the user for the value of a variable.
+type Prompter func(v TemplateVariable) (string, error)
+
+// ResolveVariables determines the value of every declared variable. Given
+// values win, then the prompter is asked (when not nil), then the default
+// applies. Given values for undeclared variables are an error. Answers
+// that fail validation are reported on out and asked again.
+func (m *Manifest) ResolveVariables(out io.Writer, given map[string]string, prompt Prompter) (map[string]string, error) {
+	declared := make(map[string]bool, len(m.Variables))
+	for _, v := range m.Variables {
+		declared[v.Name] = true
+	}
+	var unknown []string
+	for name := range given {
+		if !declared[name] {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return nil, fmt.Errorf("unknown template variables: %s (not declared in %s)", strings.Join(unknown, ", "), ManifestFile)
+	}
+
+	values := make(map[string]string, len(m.Variables))
+	for name, value := range given {
+		values[name] = value
+	}
+
+	for _, v := range m.Variables {
+		if value, ok := given[v.Name]; ok {
+			if err := v.Validate(value); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		if prompt == nil {
+			if err := v.Validate(v.Default); err != nil {
+				return nil, fmt.Errorf("%w and has no default", err)
+			}
+			values[v.Name] = v.Default
+			continue
+		}
+
+		for {
+			value, err := prompt(v)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read variable %s: %w", v.Name, err)
+			}
+			if value == "" {
+				value = v.Default
+			}
+			if err := v.Validate(value); err != nil {
+				fmt.Fprintf(out, "  %v\n", err)
+				continue
+			}
+			values[v.Name] = value
+			break
+		}
+	}
+	return values, nil
+}
+
+// NewLinePrompter returns a Prompter that asks on out and reads one line
+// per answer from in.
+func NewLinePrompter(in io.Reader, out io.Writer) Prompter {
+	reader := bufio.NewReader(in)
+	return func(v TemplateVariable) (string, error) {
+		question := firstNonEmpty(v.Prompt, v.Description, v.Name)
+		switch {
+		case len(v.Choices) > 0 && v.Default != "":
+			fmt.Fprintf(out, "%s (%s) [%s]: ", question, strings.Join(v.Choices, "/"), v.Default)
+		case len(v.Choices) > 0:
+			fmt.Fprintf(out, "%s (%s): ", question, strings.Join(v.Choices, "/"))
+		case v.Default != "":
+			fmt.Fprintf(out, "%s [%s]: ", question, v.Default)
+		default:
+			fmt.Fprintf(out, "%s: ", question)
+		}
+
+		line, err := reader.ReadString('\n')
+		if err != nil && (err != io.EOF || line == "") {
+			return "", err
+		}
+		return strings.TrimSpace(line), nil
+	}
+}
+
+// ApplyFileRules removes the excluded paths and performs the renames.
+func (m *Manifest) ApplyFileRules(workspacePath string) error {
+	if len(m.Exclude) > 0 {
+		err := filepath.WalkDir(workspacePath, func(path string, d fs.DirEntry, err error) error {
+			if err != nil || path == workspacePath {
+				return err
+			}
+			relPath, err := filepath.Rel(workspacePath, path)
+			if err != nil {
+				return err
+			}
+			for _, pattern := range m.Exclude {
+				if !matchGlob(pattern, filepath.ToSlash(relPath)) {
+					continue
+				}
+				if err := os.RemoveAll(path); err != nil {
+					return fmt.Errorf("failed to exclude %s: %w", relPath, err)
+				}
+				if d.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, rule := range m.Rename {
+		from := filepath.Join(workspacePath, filepath.FromSlash(rule.From))
+		to := filepath.Join(workspacePath, filepath.FromSlash(rule.To))
+		if _, err := os.Lstat(to); err == nil {
+			return fmt.Errorf("cannot rename %s to %s: the destination already exists", rule.From, rule.To)
+		}
+		if err := os.MkdirAll(filepath.Dir(to), 0755); err != nil {
+			return fmt.Errorf("failed to create directory for %s: %w", rule.To, err)
+		}
+		if err := os.Rename(from, to); err != nil {
+			return fmt.Errorf("failed to rename %s to %s: %w", rule.From, rule.To, err)
+		}
+	}
+	return nil
+}
+
+// RenderFiles renders the workspace files with the variable values.
+func (m *Manifest) RenderFiles(workspacePath string, values map[string]string) error {
+	return RenderTemplate(workspacePath, values, m.Render)
+}
+
+// ApplyPatches applies the JSON patches to files in the workspace. String
+// values in the operations are rendered with the variable values first.
+func (m *Manifest) ApplyPatches(workspacePath string, values map[string]string) error {
+	for _, patch := range m.Patches {
+		operations := make([]PatchOperation, len(patch.Operations))
+		for i, op := range patch.Operations {
+			value, err := m.renderValue(op.Value, values)
+			if err != nil {
+				return fmt.Errorf("failed to patch %s: %w", patch.File, err)
+			}
+			op.Value = value
+			operations[i] = op
+		}
+
+		err := patchJSONFile(filepath.Join(workspacePath, filepath.FromSlash(patch.File)), operations)
+		if err != nil {
+			return fmt.Errorf("failed to patch %s: %w", patch.File, err)
+		}
+	}
+	return nil
+}
+
+// renderValue renders the strings inside a patch value.
+func (m *Manifest) renderValue(value interface{}, values map[string]string) (interface{}, error) {
+	switch v := value.(type) {
+	case string:
+		left, right := "{{", "}}"
+		if len(m.Render.Delims) == 2 {
+			left, right = m.Render.Delims[0], m.Render.Delims[1]
+		}
+		tmpl, err := template.New("value").Delims(left, right).Funcs(renderFuncs).Option("missingkey=error").Parse(v)
+		if err != nil {
+			return nil, err
+		}
+		var b strings.Builder
+		err = tmpl.Execute(&b, values)
+		return b.String(), err
+	case []interface{}:
+		rendered := make([]interface{}, len(v))
+		for i, item := range v {
+			var err error
+			if rendered[i], err = m.renderValue(item, values); err != nil {
+				return nil, err
+			}
+		}
+		return rendered, nil
+	case map[string]interface{}:
+		rendered := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			var err error
+			if rendered[key], err = m.renderValue(item, values); err != nil {
+				return nil, err
+			}
+		}
+		return rendered, nil
+	default:
+		return value, nil
+	}
+}
+
+// RunPostSteps runs the post-generation steps in order. Each step sees the
+// declared template variables and workspaceName as environment variables;
+// other values are not exported so they cannot replace PATH, HOME or the
+// like. Progress and the output of the steps go to out.
+func (m *Manifest) RunPostSteps(ctx context.Context, out io.Writer, workspacePath string, values map[string]string) error {
+	names := []string{"workspaceName"}
+	for _, v := range m.Variables {
+		names = append(names, v.Name)
+	}
+
+	env := os.Environ()
+	for _, name := range names {
+		if value, ok := values[name]; ok {
+			env = append(env, name+"="+value)
+		}
+	}
+
+	for i, step := range m.PostSteps {
+		fmt.Fprintf(out, "[%d/%d] %s\n", i+1, len(m.PostSteps), firstNonEmpty(step.Name, step.Run))
+
+		cmd := exec.CommandContext(ctx, "sh", "-c", step.Run)
+		cmd.Dir = filepath.Join(workspacePath, filepath.FromSlash(step.Dir))
+		cmd.Env = env
+		for name, value := range step.Env {
+			cmd.Env = append(cmd.Env, name+"="+value)
+		}
+		cmd.Stdout = out
+		cmd.Stderr = os.Stderr
+
+		err := cmd.Run()
+		if err != nil {
+			if step.ContinueOnError {
+				fmt.Fprintf(out, "Warning: post step %q failed: %v\n", firstNonEmpty(step.Name, step.Run), err)
+				continue
+			}
+			return fmt.Errorf("post step %q failed: %w", firstNonEmpty(step.Name, step.Run), err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,184 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testManifest = `
+name: react-vite
+variables:
+  - name: npmScope
+    default: acme
+    pattern: ^[a-z][a-z0-9-]*$
+  - name: styling
+    choices: [css, scss]
+    default: css
+  - name: owner
+    required: true
+exclude: [docs, "*.md"]
+rename:
+  - from: gitignore
+    to: .gitignore
+patches:
+  - file: package.json
+    operations:
+      - {op: replace, path: /name, value: "@{{ .npmScope }}/source"}
+      - {op: add, path: /workspaces/-, value: libs/*}
+      - {op: remove, path: /scripts/legacy}
+postSteps:
+  - name: Record scope
+    run: echo "$npmScope/$owner/$extra" > scope.txt
+`
+
+func TestParseManifestValidation(t *testing.T) {
+	if _, err := ParseManifest([]byte(testManifest)); err != nil {
+		t.Fatalf("error parsing manifest. Err: %v", err)
+	}
+
+	tests := map[string]string{
+		"unknown key":       "name: x\npostStep: []\n",
+		"bad variable name": "variables:\n  - name: npm-scope\n",
+		"invalid default":   "variables:\n  - name: scope\n    pattern: ^[a-z]+$\n    default: Acme\n",
+		"escaping rename":   "rename:\n  - from: a\n    to: ../b\n",
+		"unknown patch op":  "patches:\n  - file: a.json\n    operations:\n      - {op: merge, path: /a}\n",
+		"empty post step":   "postSteps:\n  - name: nothing\n",
+	}
+	for name, manifest := range tests {
+		if _, err := ParseManifest([]byte(manifest)); err == nil {
+			t.Errorf("%s: expected the manifest to be rejected", name)
+		}
+	}
+}
+
+func TestManifestResolveVariables(t *testing.T) {
+	manifest, err := ParseManifest([]byte(testManifest))
+	if err != nil {
+		t.Fatalf("error parsing manifest. Err: %v", err)
+	}
+
+	var out strings.Builder
+	if _, err := manifest.ResolveVariables(&out, nil, nil); err == nil || !strings.Contains(err.Error(), "owner") {
+		t.Errorf("expected the required variable to be reported; got %v", err)
+	}
+	if _, err := manifest.ResolveVariables(&out, map[string]string{"owner": "me", "styling": "less"}, nil); err == nil {
+		t.Errorf("expected a value outside the choices to be rejected")
+	}
+	if _, err := manifest.ResolveVariables(&out, map[string]string{"owner": "me", "PATH": "/tmp"}, nil); err == nil || !strings.Contains(err.Error(), "PATH") {
+		t.Errorf("expected an undeclared variable to be rejected; got %v", err)
+	}
+
+	// Invalid answers are asked again; empty answers take the default
+	answers := strings.NewReader("\nless\nscss\nplatform\n")
+	values, err := manifest.ResolveVariables(&out, nil, NewLinePrompter(answers, &strings.Builder{}))
+	if err != nil {
+		t.Fatalf("error resolving variables. Err: %v", err)
+	}
+	if values["npmScope"] != "acme" || values["styling"] != "scss" || values["owner"] != "platform" {
+		t.Errorf("unexpected values: %v", values)
+	}
+	if !strings.Contains(out.String(), `"less" is not one of`) {
+		t.Errorf("expected the invalid answer to be reported on out; got %q", out.String())
+	}
+}
+
+func TestManifestApply(t *testing.T) {
+	workspace := t.TempDir()
+	files := map[string]string{
+		ManifestFile:       testManifest,
+		"package.json":     `{"name":"template","workspaces":["apps/*"],"scripts":{"legacy":"x","build":"nx build"}}`,
+		"gitignore":        "node_modules\n",
+		"README.md":        "readme",
+		"docs/guide.txt":   "guide",
+		"apps/web/main.ts": "main",
+	}
+	for name, body := range files {
+		path := filepath.Join(workspace, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("error creating dir. Err: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(body), 0644); err != nil {
+			t.Fatalf("error writing file. Err: %v", err)
+		}
+	}
+
+	manifest, err := LoadManifest(workspace)
+	if err != nil || manifest == nil {
+		t.Fatalf("error loading manifest. Err: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(workspace, ManifestFile)); !os.IsNotExist(err) {
+		t.Errorf("expected the manifest to be removed from the workspace; got %v", err)
+	}
+
+	if err := manifest.ApplyFileRules(workspace); err != nil {
+		t.Fatalf("error applying file rules. Err: %v", err)
+	}
+	for _, name := range []string{"README.md", "docs", "gitignore"} {
+		if _, err := os.Stat(filepath.Join(workspace, name)); !os.IsNotExist(err) {
+			t.Errorf("expected %s to be gone; got %v", name, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(workspace, ".gitignore")); err != nil {
+		t.Errorf("expected gitignore to be renamed; got %v", err)
+	}
+
+	if err := manifest.ApplyPatches(workspace, map[string]string{"npmScope": "acme"}); err != nil {
+		t.Fatalf("error applying patches. Err: %v", err)
+	}
+	data, _ := os.ReadFile(filepath.Join(workspace, "package.json"))
+	var pkg struct {
+		Name       string            `json:"name"`
+		Workspaces []string          `json:"workspaces"`
+		Scripts    map[string]string `json:"scripts"`
+	}
+	if err := json.Unmarshal(data, &pkg); err != nil {
+		t.Fatalf("error reading patched package.json. Err: %v", err)
+	}
+	if pkg.Name != "@acme/source" || len(pkg.Workspaces) != 2 || pkg.Scripts["legacy"] != "" || pkg.Scripts["build"] == "" {
+		t.Errorf("unexpected patched package.json: %s", data)
+	}
+
+	// Only declared variables are exported
+	values := map[string]string{"npmScope": "acme", "owner": "platform", "extra": "x"}
+	var out strings.Builder
+	if err := manifest.RunPostSteps(context.Background(), &out, workspace, values); err != nil {
+		t.Fatalf("error running post steps. Err: %v", err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(workspace, "scope.txt")); strings.TrimSpace(string(data)) != "acme/platform/" {
+		t.Errorf("expected post steps to see only the declared variables; got %q", data)
+	}
+	if !strings.Contains(out.String(), "Record scope") {
+		t.Errorf("expected the step to be reported on out; got %q", out.String())
+	}
+}
+
+func TestApplyJSONPatch(t *testing.T) {
+	var doc interface{}
+	json.Unmarshal([]byte(`{"a":{"b":[1,2,3]},"c":"x"}`), &doc)
+
+	doc, err := applyJSONPatch(doc, []PatchOperation{
+		{Op: "add", Path: "/a/b/1", Value: 9},
+		{Op: "remove", Path: "/a/b/0"},
+		{Op: "move", From: "/c", Path: "/d~1e"},
+		{Op: "copy", From: "/a/b", Path: "/f"},
+		{Op: "test", Path: "/f/0", Value: 9},
+	})
+	if err != nil {
+		t.Fatalf("error applying patch. Err: %v", err)
+	}
+	data, _ := json.Marshal(doc)
+	if string(data) != `{"a":{"b":[9,2,3]},"d/e":"x","f":[9,2,3]}` {
+		t.Errorf("unexpected document: %s", data)
+	}
+
+	if _, err := applyJSONPatch(doc, []PatchOperation{{Op: "test", Path: "/d~1e", Value: "y"}}); err == nil {
+		t.Errorf("expected a failing test operation to be reported")
+	}
+	if _, err := applyJSONPatch(doc, []PatchOperation{{Op: "remove", Path: "/missing"}}); err == nil {
+		t.Errorf("expected removing a missing member to fail")
+	}
+}
@@ -0,0 +1,208 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pmezard/go-difflib/difflib"
+)
+
+// Actions of a planned file change, relative to the fetched template
+const (
+	FileAdded    = "added"    // Written by a later step, e.g. an app or library
+	FileModified = "modified" // Template file changed by a later step
+	FileDeleted  = "deleted"  // Template file removed by a later step
+	FileTemplate = "template" // Template file written as is
+)
+
+// maxDiffLines caps the size of JSON files that are diffed.
+const maxDiffLines = 5000
+
+// WorkspacePlan describes what a create would write, as found by building
+// the workspace in a throwaway directory.
+type WorkspacePlan struct {
+	Destination string           `json:"destination"`
+	Template    *TemplateInfo    `json:"template"`
+	Projects    []PlannedProject `json:"projects"`
+	Files       []PlannedFile    `json:"files"`
+	PostSteps   []string         `json:"skippedPostSteps,omitempty"` // Post-generation steps a dry run does not run
+	before      map[string]snapshotFile
+}
+
+// PlannedProject is a project an injection instruction would add.
+type PlannedProject struct {
+	Type    string `json:"type"`
+	Path    string `json:"path"`
+	Source  string `json:"source,omitempty"`
+	Skipped bool   `json:"skipped,omitempty"` // Not built by a dry run, so its files are not in the plan
+}
+
+// PlannedFile is a file of the planned workspace.
+type PlannedFile struct {
+	Path     string `json:"path"`
+	Action   string `json:"action"`
+	Replaces bool   `json:"replaces,omitempty"` // A file is already at the destination, which makes create fail
+	Diff     string `json:"diff,omitempty"`     // Unified diff of a modified JSON file
+}
+
+// snapshotFile is a file recorded by SnapshotTemplate.
+type snapshotFile struct {
+	sum  [sha256.Size]byte
+	data []byte // Only kept for JSON files, which are diffed
+}
+
+// SnapshotTemplate records the files of the freshly fetched template in
+// workspacePath, so Compare can tell what later steps change.
+func (p *WorkspacePlan) SnapshotTemplate(workspacePath string) error {
+	p.before = make(map[string]snapshotFile)
+	return walkWorkspaceFiles(workspacePath, func(rel string, data []byte) {
+		file := snapshotFile{sum: sha256.Sum256(data)}
+		if isJSONFile(rel) {
+			file.data = data
+		}
+		p.before[rel] = file
+	})
+}
+
+// AddInstructions records the projects of injection instructions. Those
+// that are IsExternal are marked as skipped.
+func (p *WorkspacePlan) AddInstructions(instructions []InjectionInstruction) {
+	for _, instruction := range instructions {
+		p.Projects = append(p.Projects, PlannedProject{
+			Type:    instruction.Type,
+			Path:    instruction.ProjectRoot(),
+			Source:  instruction.RepoURL,
+			Skipped: instruction.IsExternal(),
+		})
+	}
+}
+
+// Compare fills in the files of the workspace built in workspacePath,
+// relative to the template snapshot and to what is at the destination.
+func (p *WorkspacePlan) Compare(workspacePath string) error {
+	p.Files = nil
+	seen := make(map[string]bool)
+	err := walkWorkspaceFiles(workspacePath, func(rel string, data []byte) {
+		seen[rel] = true
+		file := PlannedFile{Path: rel, Action: FileAdded}
+		if before, ok := p.before[rel]; ok {
+			file.Action = FileTemplate
+			if before.sum != sha256.Sum256(data) {
+				file.Action = FileModified
+				if isJSONFile(rel) {
+					file.Diff = unifiedDiff(rel, before.data, data)
+				}
+			}
+		}
+		if _, err := os.Lstat(filepath.Join(p.Destination, filepath.FromSlash(rel))); err == nil {
+			file.Replaces = true
+		}
+		p.Files = append(p.Files, file)
+	})
+	if err != nil {
+		return err
+	}
+
+	for rel := range p.before {
+		if !seen[rel] {
+			p.Files = append(p.Files, PlannedFile{Path: rel, Action: FileDeleted})
+		}
+	}
+	sort.Slice(p.Files, func(i, j int) bool {
+		return p.Files[i].Path < p.Files[j].Path
+	})
+	return nil
+}
+
+// Count returns the number of planned files with action.
+func (p *WorkspacePlan) Count(action string) int {
+	n := 0
+	for _, file := range p.Files {
+		if file.Action == action {
+			n++
+		}
+	}
+	return n
+}
+
+// walkWorkspaceFiles calls fn with the slash-separated path and content of
+// every file under root, outside .git. Symlinks are reported with their
+// target.
+func walkWorkspaceFiles(root string, fn func(rel string, data []byte)) error {
+	return filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if d.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+
+		var data []byte
+		if d.Type()&fs.ModeSymlink != 0 {
+			target, err := os.Readlink(p)
+			if err != nil {
+				return err
+			}
+			data = []byte("symlink " + target)
+		} else {
+			data, err = os.ReadFile(p)
+			if err != nil {
+				return fmt.Errorf("failed to read %s: %w", rel, err)
+			}
+		}
+		fn(filepath.ToSlash(rel), data)
+		return nil
+	})
+}
+
+func isJSONFile(rel string) bool {
+	return strings.EqualFold(path.Ext(rel), ".json")
+}
+
+// unifiedDiff returns the unified diff of two versions of a file, or a note
+// when the file is too large to diff.
+func unifiedDiff(rel string, before, after []byte) string {
+	a := splitLines(string(before))
+	b := splitLines(string(after))
+	if len(a) > maxDiffLines || len(b) > maxDiffLines {
+		return fmt.Sprintf("(diff of %s omitted: more than %d lines)\n", rel, maxDiffLines)
+	}
+	diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        a,
+		B:        b,
+		FromFile: "a/" + rel,
+		ToFile:   "b/" + rel,
+		Context:  3,
+	})
+	if err != nil {
+		return ""
+	}
+	return diff
+}
+
+// splitLines splits s into lines that keep their line endings, giving a
+// last line without one an ending so it diffs like the others.
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		return lines[:len(lines)-1]
+	}
+	lines[len(lines)-1] += "\n"
+	return lines
+}
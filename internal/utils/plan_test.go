@@ -0,0 +1,68 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWorkspacePlan(t *testing.T) {
+	workspace := t.TempDir()
+	dest := t.TempDir()
+	os.WriteFile(filepath.Join(workspace, "package.json"), []byte("{\n  \"name\": \"tpl\"\n}\n"), 0644)
+	os.WriteFile(filepath.Join(workspace, "README.md"), []byte("# tpl\n"), 0644)
+	os.WriteFile(filepath.Join(workspace, "LICENSE"), []byte("MIT\n"), 0644)
+	os.WriteFile(filepath.Join(dest, "README.md"), []byte("# old\n"), 0644)
+
+	plan := &WorkspacePlan{Destination: dest}
+	if err := plan.SnapshotTemplate(workspace); err != nil {
+		t.Fatalf("error recording template. Err: %v", err)
+	}
+
+	os.WriteFile(filepath.Join(workspace, "package.json"), []byte("{\n  \"name\": \"store\"\n}\n"), 0644)
+	os.Remove(filepath.Join(workspace, "LICENSE"))
+	os.MkdirAll(filepath.Join(workspace, "libs", "ui"), 0755)
+	os.WriteFile(filepath.Join(workspace, "libs", "ui", "project.json"), []byte("{}\n"), 0644)
+
+	if err := plan.Compare(workspace); err != nil {
+		t.Fatalf("error comparing workspace. Err: %v", err)
+	}
+	actions := make(map[string]PlannedFile)
+	for _, file := range plan.Files {
+		actions[file.Path] = file
+	}
+	for path, want := range map[string]string{
+		"package.json":         FileModified,
+		"README.md":            FileTemplate,
+		"LICENSE":              FileDeleted,
+		"libs/ui/project.json": FileAdded,
+	} {
+		if actions[path].Action != want {
+			t.Errorf("expected %s to be %s; got %q", path, want, actions[path].Action)
+		}
+	}
+	if !actions["README.md"].Replaces || actions["package.json"].Replaces {
+		t.Errorf("expected only README.md to replace a file at the destination; got %+v", plan.Files)
+	}
+
+	wantDiff := "--- a/package.json\n+++ b/package.json\n@@ -1,3 +1,3 @@\n {\n-  \"name\": \"tpl\"\n+  \"name\": \"store\"\n }\n"
+	if diff := actions["package.json"].Diff; diff != wantDiff {
+		t.Errorf("expected diff %q; got %q", wantDiff, diff)
+	}
+	if actions["libs/ui/project.json"].Diff != "" {
+		t.Errorf("expected no diff for an added file")
+	}
+	if plan.Count(FileAdded) != 1 || plan.Count(FileTemplate) != 1 {
+		t.Errorf("expected 1 added and 1 template file; got %+v", plan.Files)
+	}
+
+	plan.AddInstructions([]InjectionInstruction{{Type: "create-new", AppName: "admin"}, {Type: "create-lib", AppName: "ui"}})
+	if len(plan.Projects) != 2 || !plan.Projects[0].Skipped || plan.Projects[1].Skipped {
+		t.Errorf("expected only the create-new project to be skipped; got %+v", plan.Projects)
+	}
+
+	if diff := unifiedDiff("big.json", []byte(strings.Repeat("1\n", maxDiffLines+1)), nil); !strings.Contains(diff, "omitted") {
+		t.Errorf("expected the diff of a large file to be omitted; got %q", diff)
+	}
+}
@@ -0,0 +1,179 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// Provider is a git hosting service that templates can be downloaded from
+// and repositories imported from.
+type Provider interface {
+	// Name returns the provider kind: "github", "gitlab" or "gitea".
+	Name() string
+
+	// Host returns the host[:port] of the instance.
+	Host() string
+
+	// ResolveRef returns the commit SHA a branch, tag or SHA points to.
+	ResolveRef(ctx context.Context, owner, repo, ref string) (string, error)
+
+	// ArchiveURL returns the URL of a ZIP archive of the repository at commit.
+	ArchiveURL(owner, repo, commit string) string
+
+	// TarballURL returns the URL of a tar.gz archive of the repository at
+	// commit, which can be extracted while it downloads.
+	TarballURL(owner, repo, commit string) string
+
+	// HTTPClient returns the client that authenticates against the instance.
+	HTTPClient() *http.Client
+
+	// Credential returns the credential used by HTTPClient.
+	Credential() Credential
+
+	// ParseRepoURL extracts owner and repository from a web or clone URL
+	// of this instance. It reports false for URLs of other hosts.
+	ParseRepoURL(raw string) (*RepoLocation, bool)
+}
+
+// RepoLocation identifies a repository on a provider.
+type RepoLocation struct {
+	Provider string
+	Host     string
+	Owner    string // May contain slashes for GitLab subgroups
+	Repo     string
+}
+
+// ProviderConfig selects a provider and the instance it talks to.
+type ProviderConfig struct {
+	Name    string // "github" (default), "gitlab" or "gitea"
+	BaseURL string // Instance URL; defaults to GITLAB_URL/GITEA_URL or the public service
+	Token   string // Overrides the token found in the environment
+}
+
+// NewProvider creates the provider described by cfg.
+func NewProvider(cfg ProviderConfig) (Provider, error) {
+	switch cfg.Name {
+	case "", "github":
+		if cfg.BaseURL != "" {
+			return nil, fmt.Errorf("a custom base URL is not supported for github")
+		}
+		return NewGitHubProvider(cfg.Token), nil
+	case "gitlab":
+		return NewGitLabProvider(firstNonEmpty(cfg.BaseURL, os.Getenv("GITLAB_URL"), "https://gitlab.com"), cfg.Token)
+	case "gitea":
+		return NewGiteaProvider(firstNonEmpty(cfg.BaseURL, os.Getenv("GITEA_URL"), "https://gitea.com"), cfg.Token)
+	default:
+		return nil, fmt.Errorf("unknown provider %q (expected github, gitlab or gitea)", cfg.Name)
+	}
+}
+
+// ParseRepoURL matches a repository URL against GitHub and the GitLab and
+// Gitea instances configured through GITLAB_URL and GITEA_URL.
+func ParseRepoURL(raw string) (*RepoLocation, bool) {
+	for _, name := range []string{"github", "gitlab", "gitea"} {
+		provider, err := NewProvider(ProviderConfig{Name: name})
+		if err != nil {
+			continue
+		}
+		if location, ok := provider.ParseRepoURL(raw); ok {
+			return location, true
+		}
+	}
+	return nil, false
+}
+
+// parseHostedRepoURL splits an http(s) repository URL on host into owner
+// and repository. With nested set, every path segment before the last one
+// (or before GitLab's "/-/" marker) belongs to the owner.
+func parseHostedRepoURL(raw, provider, host string, nested bool) (*RepoLocation, bool) {
+	u, err := url.Parse(raw)
+	if err != nil || !strings.EqualFold(u.Host, host) {
+		return nil, false
+	}
+
+	var segments []string
+	for _, segment := range strings.Split(strings.Trim(u.Path, "/"), "/") {
+		if segment == "-" {
+			break
+		}
+		if segment != "" {
+			segments = append(segments, segment)
+		}
+	}
+	if len(segments) < 2 {
+		return nil, false
+	}
+	if !nested {
+		segments = segments[:2]
+	}
+
+	repo := strings.TrimSuffix(segments[len(segments)-1], ".git")
+	return &RepoLocation{
+		Provider: provider,
+		Host:     host,
+		Owner:    strings.Join(segments[:len(segments)-1], "/"),
+		Repo:     repo,
+	}, true
+}
+
+// providerGet sends an authenticated GET request to the provider and
+// returns the body of a successful response. The caller must close it.
+func providerGet(ctx context.Context, provider Provider, rawURL string) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create download request: %w", err)
+	}
+
+	resp, err := provider.HTTPClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	err = checkResponse(resp, provider.Credential())
+	if err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// getJSON fetches a provider API endpoint and decodes the JSON response.
+func getJSON(ctx context.Context, provider Provider, apiURL string, v interface{}) error {
+	body, err := providerGet(ctx, provider, apiURL)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	return json.NewDecoder(body).Decode(v)
+}
+
+// tokenCredential returns an explicit token, the token in envVar, or a
+// ~/.netrc entry for host, in that order.
+func tokenCredential(token, envVar, host string) Credential {
+	if token != "" {
+		return Credential{Token: token, Source: "provider configuration"}
+	}
+	if value := os.Getenv(envVar); value != "" {
+		return Credential{Token: value, Source: envVar + " environment variable"}
+	}
+	if cred, ok := netrcCredential(host); ok {
+		return cred
+	}
+	return Credential{Hint: fmt.Sprintf("set %s or add %s to ~/.netrc", envVar, host)}
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
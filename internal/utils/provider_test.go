@@ -0,0 +1,161 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newFakeForge serves the subset of the GitLab and Gitea APIs used to
+// resolve refs and download archives.
+func newFakeForge(t *testing.T, token string) *httptest.Server {
+	t.Helper()
+	commit := strings.Repeat("c", 40)
+	files := []testArchiveEntry{
+		{name: "app-" + commit + "/"},
+		{name: "app-" + commit + "/package.json", body: `{"name":"golden"}`},
+		{name: "app-" + commit + "/nx.json", body: "{}"},
+	}
+	archive, err := os.ReadFile(buildZip(t, files))
+	if err != nil {
+		t.Fatalf("error reading archive. Err: %v", err)
+	}
+	tarball := buildTarGz(t, files)
+
+	routes := map[string]func(w http.ResponseWriter, r *http.Request){
+		"/api/v4/projects/group%2Fsub%2Fapp/repository/commits/release%2F2.x": func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintf(w, `{"id":%q}`, commit)
+		},
+		"/api/v4/projects/group%2Fsub%2Fapp/repository/archive.zip": func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Query().Get("sha") != commit {
+				http.NotFound(w, r)
+				return
+			}
+			w.Write(archive)
+		},
+		"/api/v4/projects/group%2Fsub%2Fapp/repository/archive.tar.gz": func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Query().Get("sha") != commit {
+				http.NotFound(w, r)
+				return
+			}
+			w.Write(tarball)
+		},
+		"/api/v1/repos/org/app/commits": func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Query().Get("sha") != "v1.0.0" {
+				w.Write([]byte("[]"))
+				return
+			}
+			fmt.Fprintf(w, `[{"sha":%q}]`, commit)
+		},
+		"/api/v1/repos/org/app/archive/" + commit + ".zip": func(w http.ResponseWriter, r *http.Request) {
+			w.Write(archive)
+		},
+		"/api/v1/repos/org/app/archive/" + commit + ".tar.gz": func(w http.ResponseWriter, r *http.Request) {
+			w.Write(tarball)
+		},
+	}
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer "+token {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		handler, ok := routes[r.URL.EscapedPath()]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		handler(w, r)
+	}))
+}
+
+func TestRemoteSourceWithGitLabAndGitea(t *testing.T) {
+	server := newFakeForge(t, "secret")
+	defer server.Close()
+	ctx := context.Background()
+
+	tests := []struct {
+		provider string
+		owner    string
+		ref      string
+	}{
+		{"gitlab", "group/sub", "release/2.x"},
+		{"gitea", "org", "v1.0.0"},
+	}
+	for _, tt := range tests {
+		provider, err := NewProvider(ProviderConfig{Name: tt.provider, BaseURL: server.URL, Token: "secret"})
+		if err != nil {
+			t.Fatalf("error creating %s provider. Err: %v", tt.provider, err)
+		}
+
+		cache := &TemplateCache{Dir: t.TempDir()}
+		source := &RemoteSource{Provider: provider, Owner: tt.owner, Repo: "app", Ref: tt.ref, Cache: CacheOptions{Cache: cache}}
+		dest := t.TempDir()
+		info, err := source.Fetch(ctx, dest, ExtractOptions{})
+		if err != nil {
+			t.Fatalf("error fetching %s template. Err: %v", tt.provider, err)
+		}
+		if info.Commit != strings.Repeat("c", 40) || info.Source != tt.provider {
+			t.Errorf("expected the resolved %s commit to be recorded; got %+v", tt.provider, info)
+		}
+		if _, err := os.Stat(filepath.Join(dest, "package.json")); err != nil {
+			t.Errorf("expected package.json at the destination root; got %v", err)
+		}
+
+		// The cached archive must be usable without the server
+		source.Cache.Offline = true
+		if _, err := source.Fetch(ctx, t.TempDir(), ExtractOptions{}); err != nil {
+			t.Errorf("expected an offline %s fetch from the cache; got %v", tt.provider, err)
+		}
+
+		// A read-only cache is never written to
+		empty := &TemplateCache{Dir: t.TempDir()}
+		source.Cache = CacheOptions{Cache: empty, ReadOnly: true}
+		if _, err := source.Fetch(ctx, t.TempDir(), ExtractOptions{}); err != nil {
+			t.Errorf("expected a read-only %s fetch; got %v", tt.provider, err)
+		}
+		if entries, _ := os.ReadDir(empty.Dir); len(entries) > 0 {
+			t.Errorf("expected a read-only fetch to leave the cache empty; got %d entries", len(entries))
+		}
+	}
+
+	provider, _ := NewProvider(ProviderConfig{Name: "gitea", BaseURL: server.URL, Token: "wrong"})
+	source := &RemoteSource{Provider: provider, Owner: "org", Repo: "app", Ref: "v1.0.0"}
+	_, err := source.Fetch(ctx, t.TempDir(), ExtractOptions{})
+	if err == nil || !strings.Contains(err.Error(), "401") || !strings.Contains(err.Error(), "provider configuration") {
+		t.Errorf("expected a 401 error naming the credential source; got %v", err)
+	}
+}
+
+func TestProviderParseRepoURL(t *testing.T) {
+	gitlab, _ := NewGitLabProvider("https://gitlab.example.com", "")
+	gitea, _ := NewGiteaProvider("https://git.example.com/", "")
+	github := NewGitHubProvider("")
+
+	tests := []struct {
+		provider Provider
+		url      string
+		owner    string
+		repo     string
+	}{
+		{gitlab, "https://gitlab.example.com/group/sub/web-app.git", "group/sub", "web-app"},
+		{gitlab, "https://gitlab.example.com/group/web/-/tree/main", "group", "web"},
+		{gitea, "https://git.example.com/org/shop/src/branch/main", "org", "shop"},
+		{github, "https://github.com/acme/dashboard.git", "acme", "dashboard"},
+	}
+	for _, tt := range tests {
+		location, ok := tt.provider.ParseRepoURL(tt.url)
+		if !ok || location.Owner != tt.owner || location.Repo != tt.repo {
+			t.Errorf("%s.ParseRepoURL(%q): expected %s/%s; got %+v", tt.provider.Name(), tt.url, tt.owner, tt.repo, location)
+		}
+	}
+
+	if _, ok := gitlab.ParseRepoURL("https://github.com/acme/dashboard"); ok {
+		t.Errorf("expected GitLab to ignore URLs of other hosts")
+	}
+}
@@ -0,0 +1,258 @@
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+	"unicode"
+	"unicode/utf8"
+)
+
+// RenderSettings controls how a template's files are rendered. It is read
+// from the render section of the manifest.
+type RenderSettings struct {
+	Skip   []string `yaml:"skip"`   // Glob patterns of files copied verbatim
+	Delims []string `yaml:"delims"` // Left and right action delimiters (default {{ and }})
+}
+
+// nameTokenRegex matches __name__ and __name.helper__ tokens in file names.
+var nameTokenRegex = regexp.MustCompile(`__([A-Za-z_][A-Za-z0-9_]*?)(?:\.([a-z]+))?__`)
+
+// renderFuncs are the case helpers available in templates and name tokens.
+var renderFuncs = template.FuncMap{
+	"kebab":    toKebabCase,
+	"pascal":   toPascalCase,
+	"camel":    toCamelCase,
+	"snake":    toSnakeCase,
+	"constant": func(s string) string { return strings.ToUpper(toSnakeCase(s)) },
+	"upper":    strings.ToUpper,
+	"lower":    strings.ToLower,
+}
+
+// RenderTemplate renders every text file below root as a text/template with
+// values as data, then replaces __name__ tokens in file and directory names.
+// Binary files and files matching settings.Skip are left untouched, as are
+// files that do not parse as templates, such as JSX with style={{...}}.
+func RenderTemplate(root string, values map[string]string, settings RenderSettings) error {
+	left, right := "{{", "}}"
+	if len(settings.Delims) == 2 {
+		left, right = settings.Delims[0], settings.Delims[1]
+	}
+
+	var paths []string
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || path == root {
+			return err
+		}
+		if d.IsDir() && (d.Name() == ".git" || d.Name() == "node_modules") {
+			return filepath.SkipDir
+		}
+		paths = append(paths, path)
+
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		relPath, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		for _, pattern := range settings.Skip {
+			if matchGlob(pattern, filepath.ToSlash(relPath)) {
+				return nil
+			}
+		}
+		return renderFile(path, filepath.ToSlash(relPath), values, left, right)
+	})
+	if err != nil {
+		return err
+	}
+
+	// Rename the deepest paths first so parent renames do not move them
+	sort.Slice(paths, func(i, j int) bool {
+		return strings.Count(paths[i], string(filepath.Separator)) > strings.Count(paths[j], string(filepath.Separator))
+	})
+	for _, path := range paths {
+		name, err := renderName(filepath.Base(path), values)
+		if err != nil {
+			return fmt.Errorf("failed to render name of %s: %w", path, err)
+		}
+		if name == filepath.Base(path) {
+			continue
+		}
+
+		target := filepath.Join(filepath.Dir(path), name)
+		if _, err := os.Lstat(target); err == nil {
+			return fmt.Errorf("cannot rename %s to %s: the destination already exists", path, name)
+		}
+		if err := os.Rename(path, target); err != nil {
+			return fmt.Errorf("failed to rename %s: %w", path, err)
+		}
+	}
+	return nil
+}
+
+// renderFile executes a single file as a template in place.
+func renderFile(path, name string, values map[string]string, left, right string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if isBinary(data) || !bytes.Contains(data, []byte(left)) {
+		return nil
+	}
+
+	tmpl, err := template.New(name).Delims(left, right).Funcs(renderFuncs).Option("missingkey=error").Parse(string(data))
+	if err != nil {
+		// Not meant as a template
+		return nil
+	}
+
+	var rendered bytes.Buffer
+	err = tmpl.Execute(&rendered, values)
+	if err != nil {
+		return fmt.Errorf("failed to render template: %w", err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, rendered.Bytes(), info.Mode().Perm())
+}
+
+// renderString renders a path or other string from a template's
+// configuration: {{ }} actions first, then __name__ tokens in every path
+// segment. s is returned unchanged when it does not render.
+func renderString(s string, values map[string]string) string {
+	rendered := s
+	if strings.Contains(s, "{{") {
+		tmpl, err := template.New("value").Funcs(renderFuncs).Option("missingkey=error").Parse(s)
+		if err != nil {
+			return s
+		}
+		var b strings.Builder
+		if err := tmpl.Execute(&b, values); err != nil {
+			return s
+		}
+		rendered = b.String()
+	}
+
+	segments := strings.Split(rendered, "/")
+	for i, segment := range segments {
+		if segment == "" || segment == "." || segment == ".." {
+			continue
+		}
+		name, err := renderName(segment, values)
+		if err != nil {
+			return s
+		}
+		segments[i] = name
+	}
+	return strings.Join(segments, "/")
+}
+
+// renderName replaces __name__ and __name.helper__ tokens whose name is a
+// known variable. Other double-underscore names such as __tests__ are kept.
+func renderName(name string, values map[string]string) (string, error) {
+	var renderErr error
+	rendered := nameTokenRegex.ReplaceAllStringFunc(name, func(token string) string {
+		match := nameTokenRegex.FindStringSubmatch(token)
+		value, ok := values[match[1]]
+		if !ok {
+			return token
+		}
+		if match[2] == "" {
+			return value
+		}
+		helper, ok := renderFuncs[match[2]].(func(string) string)
+		if !ok {
+			renderErr = fmt.Errorf("unknown helper %q in %s", match[2], token)
+			return token
+		}
+		return helper(value)
+	})
+	if renderErr != nil {
+		return "", renderErr
+	}
+	if rendered == "" || strings.ContainsAny(rendered, `/\`) || rendered == "." || rendered == ".." {
+		return "", fmt.Errorf("%s renders to the invalid name %q", name, rendered)
+	}
+	return rendered, nil
+}
+
+// isBinary reports whether data looks like a binary file: it contains a NUL
+// byte or is not valid UTF-8 within the first 8000 bytes.
+func isBinary(data []byte) bool {
+	sample := data
+	if len(sample) > 8000 {
+		sample = sample[:8000]
+		// Do not split a multi-byte character at the cut
+		for i := 0; i < utf8.UTFMax && len(sample) > 0 && !utf8.Valid(sample); i++ {
+			sample = sample[:len(sample)-1]
+		}
+	}
+	return bytes.IndexByte(sample, 0) >= 0 || !utf8.Valid(sample)
+}
+
+// splitWords splits an identifier into lower-case words at separators and
+// case changes: "myApp", "my-app", "MY_APP" and "MyApp" all give [my app].
+func splitWords(s string) []string {
+	var words []string
+	var current []rune
+	runes := []rune(s)
+	for i, r := range runes {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			if len(current) > 0 {
+				words = append(words, string(current))
+				current = nil
+			}
+			continue
+		}
+		if len(current) > 0 && unicode.IsUpper(r) {
+			prev := runes[i-1]
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) || (unicode.IsUpper(prev) && nextLower) {
+				words = append(words, string(current))
+				current = nil
+			}
+		}
+		current = append(current, unicode.ToLower(r))
+	}
+	if len(current) > 0 {
+		words = append(words, string(current))
+	}
+	return words
+}
+
+func toKebabCase(s string) string {
+	return strings.Join(splitWords(s), "-")
+}
+
+func toSnakeCase(s string) string {
+	return strings.Join(splitWords(s), "_")
+}
+
+func toPascalCase(s string) string {
+	var b strings.Builder
+	for _, word := range splitWords(s) {
+		r, size := utf8.DecodeRuneInString(word)
+		b.WriteRune(unicode.ToUpper(r))
+		b.WriteString(word[size:])
+	}
+	return b.String()
+}
+
+func toCamelCase(s string) string {
+	pascal := toPascalCase(s)
+	if pascal == "" {
+		return ""
+	}
+	r, size := utf8.DecodeRuneInString(pascal)
+	return string(unicode.ToLower(r)) + pascal[size:]
+}
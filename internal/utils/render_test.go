@@ -0,0 +1,96 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCaseHelpers(t *testing.T) {
+	tests := []struct {
+		input, kebab, pascal, camel, snake string
+	}{
+		{"my app", "my-app", "MyApp", "myApp", "my_app"},
+		{"myApp", "my-app", "MyApp", "myApp", "my_app"},
+		{"MY_APP", "my-app", "MyApp", "myApp", "my_app"},
+		{"HTTPServer2", "http-server2", "HttpServer2", "httpServer2", "http_server2"},
+		{"", "", "", "", ""},
+	}
+	for _, tt := range tests {
+		if got := toKebabCase(tt.input); got != tt.kebab {
+			t.Errorf("toKebabCase(%q): expected %q; got %q", tt.input, tt.kebab, got)
+		}
+		if got := toPascalCase(tt.input); got != tt.pascal {
+			t.Errorf("toPascalCase(%q): expected %q; got %q", tt.input, tt.pascal, got)
+		}
+		if got := toCamelCase(tt.input); got != tt.camel {
+			t.Errorf("toCamelCase(%q): expected %q; got %q", tt.input, tt.camel, got)
+		}
+		if got := toSnakeCase(tt.input); got != tt.snake {
+			t.Errorf("toSnakeCase(%q): expected %q; got %q", tt.input, tt.snake, got)
+		}
+	}
+}
+
+func TestRenderTemplate(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{
+		"apps/__appName.kebab__/src/__appName.pascal__.tsx": "export const {{ pascal .appName }} = () => '{{ .appName }}';\n",
+		"apps/__appName.kebab__/__tests__/app.spec.ts":      "// {{ kebab .appName }}\n",
+		".github/workflows/ci.yml":                          "run: ${{ github.sha }}\n",
+		"logo.png":                                          "\x89PNG\x00{{ .appName }}",
+		"apps/web/src/app.tsx":                              "<div style={{ color: 'red' }} />\n",
+	}
+	for name, body := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("error creating dir. Err: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(body), 0644); err != nil {
+			t.Fatalf("error writing file. Err: %v", err)
+		}
+	}
+
+	values := map[string]string{"appName": "shopFront"}
+	if err := RenderTemplate(root, values, RenderSettings{Skip: []string{".github"}}); err != nil {
+		t.Fatalf("error rendering template. Err: %v", err)
+	}
+
+	expected := map[string]string{
+		"apps/shop-front/src/ShopFront.tsx":     "export const ShopFront = () => 'shopFront';\n",
+		"apps/shop-front/__tests__/app.spec.ts": "// shop-front\n",
+		".github/workflows/ci.yml":              "run: ${{ github.sha }}\n",
+		"logo.png":                              "\x89PNG\x00{{ .appName }}",
+		"apps/web/src/app.tsx":                  "<div style={{ color: 'red' }} />\n",
+	}
+	for name, body := range expected {
+		data, err := os.ReadFile(filepath.Join(root, filepath.FromSlash(name)))
+		if err != nil || string(data) != body {
+			t.Errorf("%s: expected %q; got %q (%v)", name, body, data, err)
+		}
+	}
+
+	// Unknown variables are errors rather than empty strings
+	if err := os.WriteFile(filepath.Join(root, "bad.txt"), []byte("{{ .missing }}"), 0644); err != nil {
+		t.Fatalf("error writing file. Err: %v", err)
+	}
+	if err := RenderTemplate(root, values, RenderSettings{Skip: []string{".github"}}); err == nil {
+		t.Errorf("expected an error for an undefined variable")
+	}
+}
+
+func TestReplaceTemplateName(t *testing.T) {
+	tests := map[string]string{
+		"apps/__appName__/src":              "apps/shopFront/src",
+		"dist/apps/__appName.kebab__":       "dist/apps/shop-front",
+		"apps/{{ .appName }}/src/main.tsx":  "apps/shopFront/src/main.tsx",
+		"apps/{{ kebab .appName }}/project": "apps/shop-front/project",
+		"apps/my-app/src":                   "apps/my-app/src",
+		"apps/{{ .other }}/src":             "apps/{{ .other }}/src",
+	}
+	for path, expected := range tests {
+		if got := replaceTemplateName(path, "shopFront"); got != expected {
+			t.Errorf("replaceTemplateName(%q): expected %q; got %q", path, expected, got)
+		}
+	}
+}
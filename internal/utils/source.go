@@ -0,0 +1,454 @@
+package utils
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// TemplateSource provides the files of a workspace template.
+type TemplateSource interface {
+	// Describe returns a short human-readable description of the source.
+	Describe() string
+
+	// Fetch writes the template into destPath and reports where it came from.
+	Fetch(ctx context.Context, destPath string, opts ExtractOptions) (*TemplateInfo, error)
+}
+
+// CacheOptions controls how remote templates use the template cache.
+type CacheOptions struct {
+	Cache    *TemplateCache // nil disables caching
+	Offline  bool           // Only use archives that are already cached
+	Refresh  bool           // Download again even if the commit is cached
+	ReadOnly bool           // Never store, update or touch cache entries
+}
+
+// TemplateInfo records which template a workspace was generated from.
+type TemplateInfo struct {
+	Source string `json:"source"` // Provider name, "directory" or "archive"
+	Host   string `json:"host,omitempty"`
+	Owner  string `json:"owner,omitempty"`
+	Repo   string `json:"repo,omitempty"`
+	Ref    string `json:"ref,omitempty"`
+	Commit string `json:"commit,omitempty"`
+	Path   string `json:"path,omitempty"`   // Local template sources
+	SHA256 string `json:"sha256,omitempty"` // Local archive checksum
+	Subdir string `json:"subdir,omitempty"`
+
+	Variables map[string]string `json:"variables,omitempty"` // Manifest variable values
+}
+
+// workspaceInfoFile is the file recording how a workspace was generated.
+const workspaceInfoFile = ".nx-scaffolder.json"
+
+// WriteTemplateInfo pins the template a workspace was generated from by
+// writing it to .nx-scaffolder.json in the workspace root.
+func WriteTemplateInfo(workspacePath string, info *TemplateInfo) error {
+	data, err := json.MarshalIndent(map[string]interface{}{"template": info}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(workspacePath, workspaceInfoFile), append(data, '\n'), 0644)
+}
+
+// RemoteSource downloads a template repository from a git hosting provider,
+// going through the template cache when one is configured. The tar.gz
+// archive is extracted while it downloads; when a checksum is given the ZIP
+// archive is downloaded and verified first.
+type RemoteSource struct {
+	Provider Provider
+	Owner    string
+	Repo     string
+	Ref      string // Branch, tag or commit SHA
+	Cache    CacheOptions
+	SHA256   string    // Expected checksum of the ZIP archive, verified before extraction
+	Progress io.Writer // Receives a download progress bar; nil disables it
+	Output   io.Writer // Receives status messages (default: os.Stdout)
+}
+
+func (s *RemoteSource) output() io.Writer {
+	if s.Output == nil {
+		return os.Stdout
+	}
+	return s.Output
+}
+
+func (s *RemoteSource) Describe() string {
+	return fmt.Sprintf("%s %s/%s (ref: %s)", s.Provider.Name(), s.Owner, s.Repo, s.Ref)
+}
+
+func (s *RemoteSource) Fetch(ctx context.Context, destPath string, opts ExtractOptions) (*TemplateInfo, error) {
+	host := s.Provider.Host()
+	info := &TemplateInfo{
+		Source: s.Provider.Name(),
+		Host:   host,
+		Owner:  s.Owner,
+		Repo:   s.Repo,
+		Ref:    s.Ref,
+		Subdir: opts.Subdir,
+	}
+
+	cache := s.Cache.Cache
+	if s.Cache.Offline {
+		if cache == nil {
+			return nil, fmt.Errorf("offline mode requires the template cache")
+		}
+		commit, err := s.extractFromCacheOffline(host, destPath, opts)
+		if err != nil {
+			return nil, err
+		}
+		info.Commit = commit
+		return info, nil
+	}
+
+	// Resolve the ref so the cache is keyed by an immutable commit
+	commit, err := s.Provider.ResolveRef(ctx, s.Owner, s.Repo, s.Ref)
+	if err != nil {
+		return nil, fmt.Errorf("%w (use --offline to build from the cache)", err)
+	}
+	info.Commit = commit
+
+	if cache != nil && !s.Cache.Refresh {
+		// A streamed tar.gz cannot match a checksum of the ZIP archive, so
+		// it is replaced by a download when one is expected
+		if entry, ok := cache.Lookup(host, s.Owner, s.Repo, commit); ok && (s.SHA256 == "" || entry.Format != ArchiveTarGz) {
+			fmt.Fprintf(s.output(), "Using cached template %s/%s@%s\n", s.Owner, s.Repo, shortSHA(commit))
+			return info, s.extractCachedEntry(entry, destPath, opts)
+		}
+	}
+
+	// A checksum has to be verified before extraction, which rules out streaming
+	if s.SHA256 == "" {
+		return info, s.stream(ctx, commit, destPath, opts)
+	}
+
+	archivePath, err := s.download(ctx, commit)
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(archivePath)
+
+	if cache == nil || s.Cache.ReadOnly {
+		return info, extractZipFile(archivePath, destPath, opts)
+	}
+
+	archive, err := os.Open(archivePath)
+	if err != nil {
+		return nil, err
+	}
+	entry, err := cache.Store(host, s.Owner, s.Repo, s.Ref, commit, archive)
+	archive.Close()
+	if err != nil {
+		return nil, err
+	}
+	if s.Ref != commit {
+		err = cache.RecordRef(host, s.Owner, s.Repo, s.Ref, commit)
+		if err != nil {
+			return nil, fmt.Errorf("failed to record cached ref: %w", err)
+		}
+	}
+
+	return info, extractZipFile(entry.ArchivePath(), destPath, opts)
+}
+
+// stream extracts the tar.gz archive of commit while it downloads, keeping a
+// copy in the cache when one is configured and may be written.
+func (s *RemoteSource) stream(ctx context.Context, commit, destPath string, opts ExtractOptions) error {
+	downloader := NewDownloader(s.Provider)
+	downloader.Progress = s.Progress
+	downloader.Output = s.Output
+	body, err := downloader.Open(ctx, s.Provider.TarballURL(s.Owner, s.Repo, commit))
+	if err != nil {
+		return fmt.Errorf("failed to download repository: %w", err)
+	}
+	defer body.Close()
+
+	var archive io.Reader = body
+	cache := s.Cache.Cache
+	var cacheWriter *CacheWriter
+	if cache != nil && !s.Cache.ReadOnly {
+		cacheWriter, err = cache.Create(s.Provider.Host(), s.Owner, s.Repo, s.Ref, commit, ArchiveTarGz)
+		if err != nil {
+			return err
+		}
+		defer cacheWriter.Abort()
+		archive = io.TeeReader(body, cacheWriter)
+	}
+
+	err = extractTarGzStream(archive, destPath, opts)
+	if err != nil {
+		return err
+	}
+	if cacheWriter == nil {
+		return nil
+	}
+
+	// The tar reader stops at the end-of-archive marker; cache the rest too
+	_, err = io.Copy(io.Discard, archive)
+	if err != nil {
+		return fmt.Errorf("failed to download repository: %w", err)
+	}
+	_, err = cacheWriter.Commit()
+	if err != nil {
+		return err
+	}
+	if s.Ref != commit {
+		err = cache.RecordRef(s.Provider.Host(), s.Owner, s.Repo, s.Ref, commit)
+		if err != nil {
+			return fmt.Errorf("failed to record cached ref: %w", err)
+		}
+	}
+	return nil
+}
+
+// download saves the archive of commit to a temporary file and verifies its
+// checksum. The caller must remove the file.
+func (s *RemoteSource) download(ctx context.Context, commit string) (string, error) {
+	tmpFile, err := os.CreateTemp("", "nx-template-*.zip")
+	if err != nil {
+		return "", fmt.Errorf("failed to create temp file: %w", err)
+	}
+
+	downloader := NewDownloader(s.Provider)
+	downloader.Progress = s.Progress
+	downloader.Output = s.Output
+	_, err = downloader.Download(ctx, s.Provider.ArchiveURL(s.Owner, s.Repo, commit), tmpFile)
+	closeErr := tmpFile.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmpFile.Name())
+		return "", fmt.Errorf("failed to download repository: %w", err)
+	}
+
+	if s.SHA256 != "" {
+		checksum, err := fileSHA256(tmpFile.Name())
+		if err == nil {
+			err = verifyChecksum(fmt.Sprintf("%s/%s@%s", s.Owner, s.Repo, shortSHA(commit)), s.SHA256, checksum)
+		}
+		if err != nil {
+			os.Remove(tmpFile.Name())
+			return "", err
+		}
+	}
+
+	return tmpFile.Name(), nil
+}
+
+// extractFromCacheOffline extracts a template without touching the network.
+func (s *RemoteSource) extractFromCacheOffline(host, destPath string, opts ExtractOptions) (string, error) {
+	owner, repo := s.Owner, s.Repo
+	commit, err := s.Cache.Cache.ResolveOffline(host, owner, repo, s.Ref)
+	if err != nil {
+		return "", fmt.Errorf("template not available offline: %w", err)
+	}
+
+	entry, ok := s.Cache.Cache.Lookup(host, owner, repo, commit)
+	if !ok {
+		return "", fmt.Errorf("template not available offline: %s/%s@%s is not cached", owner, repo, shortSHA(commit))
+	}
+
+	if s.SHA256 != "" && entry.Format == ArchiveTarGz {
+		return "", fmt.Errorf("template not available offline: %s/%s@%s is cached as a tar.gz, which cannot be checked against --template-sha256; fetch it online first", owner, repo, shortSHA(commit))
+	}
+
+	fmt.Fprintf(s.output(), "Using cached template %s/%s@%s (offline)\n", owner, repo, shortSHA(commit))
+	return commit, s.extractCachedEntry(entry, destPath, opts)
+}
+
+// extractCachedEntry extracts a cached archive. When a checksum is expected
+// the archive is re-hashed first, so a corrupted entry is never trusted.
+func (s *RemoteSource) extractCachedEntry(entry *CacheEntry, destPath string, opts ExtractOptions) error {
+	if s.SHA256 != "" {
+		err := verifyCacheEntry(entry)
+		if err == nil {
+			err = verifyChecksum(fmt.Sprintf("%s/%s@%s", entry.Owner, entry.Repo, shortSHA(entry.Commit)), s.SHA256, entry.SHA256)
+		}
+		if err != nil {
+			return fmt.Errorf("cached template failed verification: %w", err)
+		}
+	}
+
+	var err error
+	if entry.Format == ArchiveTarGz {
+		err = extractTarGzFile(entry.ArchivePath(), destPath, opts)
+	} else {
+		err = extractZipFile(entry.ArchivePath(), destPath, opts)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to extract cached template (try --refresh or 'cache verify'): %w", err)
+	}
+	if s.Cache.ReadOnly {
+		return nil
+	}
+	if err := s.Cache.Cache.Touch(entry); err != nil {
+		fmt.Fprintf(s.output(), "Warning: failed to update cache entry: %v\n", err)
+	}
+	return nil
+}
+
+// shortSHA abbreviates a commit SHA for display.
+func shortSHA(commit string) string {
+	if len(commit) > 12 {
+		return commit[:12]
+	}
+	return commit
+}
+
+// LocalDirSource copies a template from a directory on disk, which lets
+// template authors try changes before publishing them.
+type LocalDirSource struct {
+	Path string
+}
+
+func (s *LocalDirSource) Describe() string {
+	return "local directory " + s.Path
+}
+
+func (s *LocalDirSource) Fetch(_ context.Context, destPath string, opts ExtractOptions) (*TemplateInfo, error) {
+	entries, err := dirEntries(s.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	// A directory is used as-is, so a single top-level folder is kept
+	err = extractEntries(entries, "", destPath, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TemplateInfo{Source: "directory", Path: s.Path, Subdir: opts.Subdir}, nil
+}
+
+// dirEntries lists a directory tree as archive entries, skipping .git.
+func dirEntries(root string) ([]archiveEntry, error) {
+	var entries []archiveEntry
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == root {
+			return nil
+		}
+		if d.IsDir() && d.Name() == ".git" {
+			return filepath.SkipDir
+		}
+
+		info, err := os.Lstat(path)
+		if err != nil {
+			return err
+		}
+		relPath, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+
+		entry := archiveEntry{
+			Name: filepath.ToSlash(relPath),
+			Mode: info.Mode(),
+			Size: info.Size(),
+			Open: func() (io.ReadCloser, error) {
+				return os.Open(path)
+			},
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			entry.Linkname, err = os.Readlink(path)
+			if err != nil {
+				return err
+			}
+		}
+		entries = append(entries, entry)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read template directory: %w", err)
+	}
+	return entries, nil
+}
+
+// ArchiveFileSource extracts a template from a local .zip, .tar.gz or .tgz file.
+type ArchiveFileSource struct {
+	Path   string
+	SHA256 string // Expected checksum, verified before extraction
+}
+
+func (s *ArchiveFileSource) Describe() string {
+	return "local archive " + s.Path
+}
+
+func (s *ArchiveFileSource) Fetch(_ context.Context, destPath string, opts ExtractOptions) (*TemplateInfo, error) {
+	checksum, err := fileSHA256(s.Path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read template archive: %w", err)
+	}
+	err = verifyChecksum(s.Path, s.SHA256, checksum)
+	if err != nil {
+		return nil, err
+	}
+
+	if isZipArchive(s.Path) {
+		err = extractZipFile(s.Path, destPath, opts)
+	} else {
+		err = extractTarGzFile(s.Path, destPath, opts)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &TemplateInfo{Source: "archive", Path: s.Path, SHA256: checksum, Subdir: opts.Subdir}, nil
+}
+
+// NewLocalTemplateSource picks the source for a --template-path value: a
+// .zip, .tar.gz or .tgz file is extracted, anything else must be a directory.
+func NewLocalTemplateSource(path string) (TemplateSource, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve template path: %w", err)
+	}
+
+	info, err := os.Stat(absPath)
+	if err != nil {
+		return nil, fmt.Errorf("template path %s: %w", path, err)
+	}
+
+	switch {
+	case info.IsDir():
+		return &LocalDirSource{Path: absPath}, nil
+	case isZipArchive(absPath) || isTarGzArchive(absPath):
+		return &ArchiveFileSource{Path: absPath}, nil
+	default:
+		return nil, fmt.Errorf("template path %s must be a directory or a .zip, .tar.gz or .tgz archive", path)
+	}
+}
+
+func isZipArchive(path string) bool {
+	return strings.HasSuffix(strings.ToLower(path), ".zip")
+}
+
+func isTarGzArchive(path string) bool {
+	lower := strings.ToLower(path)
+	return strings.HasSuffix(lower, ".tar.gz") || strings.HasSuffix(lower, ".tgz")
+}
+
+// fileSHA256 returns the hex-encoded SHA-256 digest of a file.
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
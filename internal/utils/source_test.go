@@ -0,0 +1,103 @@
+package utils
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLocalTemplateSources(t *testing.T) {
+	templateDir := t.TempDir()
+	files := map[string]string{
+		"package.json":       `{"name":"golden"}`,
+		"apps/.gitkeep":      "",
+		".git/HEAD":          "ref: refs/heads/main",
+		"tools/scripts/x.sh": "#!/bin/sh",
+	}
+	for name, body := range files {
+		path := filepath.Join(templateDir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("error creating template dir. Err: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(body), 0644); err != nil {
+			t.Fatalf("error writing template file. Err: %v", err)
+		}
+	}
+
+	source, err := NewLocalTemplateSource(templateDir)
+	if err != nil {
+		t.Fatalf("error creating source. Err: %v", err)
+	}
+	if _, ok := source.(*LocalDirSource); !ok {
+		t.Fatalf("expected a LocalDirSource; got %T", source)
+	}
+
+	dest := t.TempDir()
+	info, err := source.Fetch(context.Background(), dest, ExtractOptions{})
+	if err != nil {
+		t.Fatalf("error fetching template. Err: %v", err)
+	}
+	if info.Source != "directory" {
+		t.Errorf("expected source directory; got %s", info.Source)
+	}
+	if _, err := os.Stat(filepath.Join(dest, "tools", "scripts", "x.sh")); err != nil {
+		t.Errorf("expected nested files to be copied; got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dest, ".git")); !os.IsNotExist(err) {
+		t.Errorf("expected .git to be skipped; got %v", err)
+	}
+}
+
+func TestTarGzTemplateSource(t *testing.T) {
+	archivePath := filepath.Join(t.TempDir(), "template.tar.gz")
+	f, err := os.Create(archivePath)
+	if err != nil {
+		t.Fatalf("error creating archive. Err: %v", err)
+	}
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+	headers := []struct {
+		header tar.Header
+		body   string
+	}{
+		{tar.Header{Typeflag: tar.TypeXGlobalHeader, Name: "pax_global_header", PAXRecords: map[string]string{"comment": "abc"}}, ""},
+		{tar.Header{Typeflag: tar.TypeDir, Name: "golden-main/", Mode: 0755}, ""},
+		{tar.Header{Typeflag: tar.TypeReg, Name: "golden-main/package.json", Mode: 0644, Size: 2}, "{}"},
+		{tar.Header{Typeflag: tar.TypeReg, Name: "golden-main/bin/run", Mode: 0755, Size: 3}, "run"},
+	}
+	for _, h := range headers {
+		if err := tw.WriteHeader(&h.header); err != nil {
+			t.Fatalf("error writing tar header. Err: %v", err)
+		}
+		if _, err := tw.Write([]byte(h.body)); err != nil {
+			t.Fatalf("error writing tar body. Err: %v", err)
+		}
+	}
+	tw.Close()
+	gz.Close()
+	f.Close()
+
+	source, err := NewLocalTemplateSource(archivePath)
+	if err != nil {
+		t.Fatalf("error creating source. Err: %v", err)
+	}
+
+	dest := t.TempDir()
+	info, err := source.Fetch(context.Background(), dest, ExtractOptions{})
+	if err != nil {
+		t.Fatalf("error fetching template. Err: %v", err)
+	}
+	if info.SHA256 == "" {
+		t.Errorf("expected the archive checksum to be recorded")
+	}
+	data, err := os.ReadFile(filepath.Join(dest, "package.json"))
+	if err != nil || string(data) != "{}" {
+		t.Errorf("expected package.json at the destination root; got %q (%v)", data, err)
+	}
+	if info, err := os.Stat(filepath.Join(dest, "bin", "run")); err != nil || info.Mode().Perm()&0100 == 0 {
+		t.Errorf("expected bin/run to be executable; got %v", err)
+	}
+}
@@ -0,0 +1,349 @@
+package utils
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+
+	"gopkg.in/yaml.v3"
+)
+
+// WorkspaceSpec describes a whole workspace in a file that can be committed
+// and reviewed, as an alternative to the create flags and --inject string.
+// YAML and JSON are both accepted.
+//
+//	name: storefront
+//	template:
+//	  owner: nrwl
+//	  repo: nx
+//	  ref: 19.0.0
+//	  variables:
+//	    npmScope: acme
+//	apps:
+//	  - name: dashboard
+//	    tags: [scope:admin]
+//	imports:
+//	  - url: https://github.com/acme/shop
+//	    name: shop
+//	    ref: v2.1.0
+//	    subdir: packages/web
+//	libs:
+//	  - name: ui
+//	    buildable: true
+//	  - name: utils
+//	    framework: ts
+type WorkspaceSpec struct {
+	Name     string       `yaml:"name"` // Workspace name (default: the create argument)
+	Template SpecTemplate `yaml:"template"`
+	Apps     []SpecApp    `yaml:"apps"`    // New React apps
+	Imports  []SpecImport `yaml:"imports"` // Existing repositories imported as apps
+	Libs     []SpecLib    `yaml:"libs"`    // New or imported libraries
+}
+
+// SpecTemplate selects the base template, like the create flags of the
+// same names.
+type SpecTemplate struct {
+	Provider    string            `yaml:"provider"`
+	ProviderURL string            `yaml:"providerUrl"`
+	Owner       string            `yaml:"owner"`
+	Repo        string            `yaml:"repo"`
+	Ref         string            `yaml:"ref"`
+	Path        string            `yaml:"path"` // Local template directory or archive, relative to the spec
+	Subdir      string            `yaml:"subdir"`
+	Include     []string          `yaml:"include"`
+	Exclude     []string          `yaml:"exclude"`
+	SHA256      string            `yaml:"sha256"`
+	Variables   map[string]string `yaml:"variables"` // Template manifest variables
+}
+
+// SpecApp is a new React app.
+type SpecApp struct {
+	Name string   `yaml:"name"`
+	Tags []string `yaml:"tags"` // Nx project tags
+}
+
+// SpecImport is an existing repository imported as an app.
+type SpecImport struct {
+	URL    string   `yaml:"url"`    // Git URL, or a local directory or archive relative to the spec
+	Name   string   `yaml:"name"`   // App name (default: the repository name)
+	Ref    string   `yaml:"ref"`    // Branch, tag or commit SHA to import (default: main, then master)
+	Subdir string   `yaml:"subdir"` // Only import this directory of the repository
+	Tags   []string `yaml:"tags"`   // Nx project tags
+}
+
+// SpecLib is a library, created from scratch or, when url is set, imported
+// from a repository, directory or archive.
+type SpecLib struct {
+	Name      string   `yaml:"name"`      // Library name (default: the repository name of an import)
+	Framework string   `yaml:"framework"` // react (default) or ts
+	Buildable bool     `yaml:"buildable"` // Give the library a Vite build target
+	URL       string   `yaml:"url"`
+	Ref       string   `yaml:"ref"`
+	Subdir    string   `yaml:"subdir"`
+	Tags      []string `yaml:"tags"` // Nx project tags
+}
+
+// SpecError is a schema error in a workspace spec, located by line.
+type SpecError struct {
+	File string
+	Line int
+	Msg  string
+}
+
+func (e *SpecError) Error() string {
+	if e.Line == 0 {
+		return fmt.Sprintf("%s: %s", e.File, e.Msg)
+	}
+	return fmt.Sprintf("%s:%d: %s", e.File, e.Line, e.Msg)
+}
+
+var (
+	sha256Regex   = regexp.MustCompile(`^[0-9A-Fa-f]{64}$`)
+	yamlLineRegex = regexp.MustCompile(`^(?:yaml: )?line (\d+): (.*)$`)
+)
+
+// LoadWorkspaceSpec reads and validates a workspace spec file.
+func LoadWorkspaceSpec(specPath string) (*WorkspaceSpec, error) {
+	data, err := os.ReadFile(specPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read workspace spec: %w", err)
+	}
+	spec, err := ParseWorkspaceSpec(specPath, data)
+	if err != nil {
+		return nil, err
+	}
+	if spec.Template.Path != "" && !filepath.IsAbs(spec.Template.Path) {
+		spec.Template.Path = filepath.Join(filepath.Dir(specPath), spec.Template.Path)
+	}
+	for i, imp := range spec.Imports {
+		if importKind(imp.URL) != ImportGit && !filepath.IsAbs(imp.URL) {
+			spec.Imports[i].URL = filepath.Join(filepath.Dir(specPath), imp.URL)
+		}
+	}
+	for i, lib := range spec.Libs {
+		if lib.URL != "" && importKind(lib.URL) != ImportGit && !filepath.IsAbs(lib.URL) {
+			spec.Libs[i].URL = filepath.Join(filepath.Dir(specPath), lib.URL)
+		}
+	}
+	return spec, nil
+}
+
+// ParseWorkspaceSpec parses a workspace spec. name is used in error
+// messages. Import names are filled in from the repository URL.
+func ParseWorkspaceSpec(name string, data []byte) (*WorkspaceSpec, error) {
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+
+	var spec WorkspaceSpec
+	err := decoder.Decode(&spec)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, specDecodeError(name, err)
+	}
+
+	// Decode again keeping positions, to locate validation errors
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil, specDecodeError(name, err)
+	}
+	locate := func(msg string, keys ...interface{}) error {
+		return &SpecError{File: name, Line: specLine(&root, keys...), Msg: msg}
+	}
+
+	t := spec.Template
+	if t.Path != "" && (t.Owner != "" || t.Repo != "" || t.Ref != "" || t.Provider != "") {
+		return nil, locate("template: path cannot be combined with provider, owner, repo or ref", "template", "path")
+	}
+	if t.SHA256 != "" && !sha256Regex.MatchString(t.SHA256) {
+		return nil, locate("template: sha256 must be 64 hexadecimal characters", "template", "sha256")
+	}
+	if t.Subdir != "" {
+		if reason := unsafeEntryName(path.Clean(t.Subdir)); reason != "" {
+			return nil, locate("template: subdir "+reason, "template", "subdir")
+		}
+	}
+
+	names := make(map[string]string)
+	claim := func(appName, field string, keys ...interface{}) error {
+		if appName == "" {
+			return locate(field+": name is required", keys...)
+		}
+		if err := ValidateProjectName(appName); err != nil {
+			return locate(fmt.Sprintf("%s: %v", field, err), append(keys, "name")...)
+		}
+		if other, ok := names[appName]; ok {
+			return locate(fmt.Sprintf("%s: app name %q is already used by %s", field, appName, other), append(keys, "name")...)
+		}
+		names[appName] = field
+		return nil
+	}
+
+	for i, app := range spec.Apps {
+		field := fmt.Sprintf("apps[%d]", i)
+		if err := claim(app.Name, field, "apps", i); err != nil {
+			return nil, err
+		}
+	}
+
+	for i := range spec.Imports {
+		imp := &spec.Imports[i]
+		field := fmt.Sprintf("imports[%d]", i)
+		if imp.URL == "" {
+			return nil, locate(field+": url is required", "imports", i)
+		}
+		if imp.Subdir != "" {
+			if reason := unsafeEntryName(path.Clean(imp.Subdir)); reason != "" {
+				return nil, locate(field+": subdir "+reason, "imports", i, "subdir")
+			}
+		}
+		if imp.Name == "" {
+			imp.Name = specImportName(imp.URL)
+			if imp.Name == "" {
+				return nil, locate(field+": name is required, since none can be derived from the url", "imports", i, "url")
+			}
+		}
+		if err := claim(imp.Name, field, "imports", i); err != nil {
+			return nil, err
+		}
+	}
+
+	for i := range spec.Libs {
+		lib := &spec.Libs[i]
+		field := fmt.Sprintf("libs[%d]", i)
+		if lib.Framework != "" && lib.Framework != LibReact && lib.Framework != LibTS {
+			return nil, locate(fmt.Sprintf("%s: framework must be %s or %s", field, LibReact, LibTS), "libs", i, "framework")
+		}
+		if lib.URL == "" && (lib.Ref != "" || lib.Subdir != "") {
+			return nil, locate(field+": ref and subdir require a url", "libs", i)
+		}
+		if lib.Subdir != "" {
+			if reason := unsafeEntryName(path.Clean(lib.Subdir)); reason != "" {
+				return nil, locate(field+": subdir "+reason, "libs", i, "subdir")
+			}
+		}
+		if lib.Name == "" && lib.URL != "" {
+			lib.Name = specImportName(lib.URL)
+		}
+		if err := claim(lib.Name, field, "libs", i); err != nil {
+			return nil, err
+		}
+	}
+
+	return &spec, nil
+}
+
+// Instructions returns the apps, imports and libraries of the spec in the
+// form used by ProcessInjectionInstructions, in that order.
+func (s *WorkspaceSpec) Instructions() []InjectionInstruction {
+	var instructions []InjectionInstruction
+	for _, app := range s.Apps {
+		instructions = append(instructions, InjectionInstruction{
+			Type:    "create-new",
+			AppName: app.Name,
+			Tags:    app.Tags,
+		})
+	}
+	for _, imp := range s.Imports {
+		subdir := imp.Subdir
+		if subdir != "" {
+			subdir = path.Clean(subdir)
+		}
+		instructions = append(instructions, InjectionInstruction{
+			Type:    "import-repo",
+			RepoURL: imp.URL,
+			AppName: imp.Name,
+			Branch:  imp.Ref,
+			Subdir:  subdir,
+			Tags:    imp.Tags,
+		})
+	}
+	for _, lib := range s.Libs {
+		instruction := InjectionInstruction{
+			Type:      "create-lib",
+			AppName:   lib.Name,
+			Tags:      lib.Tags,
+			Framework: lib.Framework,
+			Buildable: lib.Buildable,
+		}
+		if lib.URL != "" {
+			instruction.Type = "import-lib"
+			instruction.RepoURL = lib.URL
+			instruction.Branch = lib.Ref
+			if lib.Subdir != "" {
+				instruction.Subdir = path.Clean(lib.Subdir)
+			}
+		}
+		instructions = append(instructions, instruction)
+	}
+	return instructions
+}
+
+// specImportName derives an app or library name from an import url.
+func specImportName(url string) string {
+	var repoName string
+	if location, ok := ParseRepoURL(url); ok {
+		repoName = location.Repo
+	}
+	return (&ImportSource{Kind: importKind(url), URL: url}).AppName(repoName)
+}
+
+// specDecodeError turns a yaml error into SpecErrors. yaml.v3 reports
+// every schema error of a document at once, each prefixed with its line.
+func specDecodeError(name string, err error) error {
+	msgs := []string{err.Error()}
+	var typeErr *yaml.TypeError
+	if errors.As(err, &typeErr) {
+		msgs = typeErr.Errors
+	}
+
+	var errs []error
+	for _, msg := range msgs {
+		specErr := &SpecError{File: name, Msg: msg}
+		if m := yamlLineRegex.FindStringSubmatch(msg); m != nil {
+			specErr.Line, _ = strconv.Atoi(m[1])
+			specErr.Msg = m[2]
+		}
+		errs = append(errs, specErr)
+	}
+	return errors.Join(errs...)
+}
+
+// specLine returns the line of the node at keys, a path of mapping keys
+// and sequence indexes. The deepest node found is used when the path does
+// not exist, and 0 when nothing matches.
+func specLine(root *yaml.Node, keys ...interface{}) int {
+	node := root
+	if node.Kind == yaml.DocumentNode && len(node.Content) > 0 {
+		node = node.Content[0]
+	}
+	line := node.Line
+	for _, key := range keys {
+		var next *yaml.Node
+		switch k := key.(type) {
+		case string:
+			if node.Kind == yaml.MappingNode {
+				for i := 0; i+1 < len(node.Content); i += 2 {
+					if node.Content[i].Value == k {
+						next = node.Content[i+1]
+						break
+					}
+				}
+			}
+		case int:
+			if node.Kind == yaml.SequenceNode && k < len(node.Content) {
+				next = node.Content[k]
+			}
+		}
+		if next == nil {
+			break
+		}
+		node = next
+		line = node.Line
+	}
+	return line
+}
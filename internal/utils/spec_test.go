@@ -0,0 +1,78 @@
+package utils
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseWorkspaceSpec(t *testing.T) {
+	yamlSpec := `name: storefront
+template:
+  owner: acme
+  repo: templates
+  ref: v3
+  variables:
+    npmScope: acme
+apps:
+  - name: dashboard
+    tags: [scope:admin]
+imports:
+  - url: https://github.com/acme/shop
+    ref: v2.1.0
+    subdir: packages/web/
+libs:
+  - name: ui
+    buildable: true
+  - url: https://github.com/acme/utils
+    framework: ts
+`
+	spec, err := ParseWorkspaceSpec("workspace.yaml", []byte(yamlSpec))
+	if err != nil {
+		t.Fatalf("error parsing spec. Err: %v", err)
+	}
+	want := []InjectionInstruction{
+		{Type: "create-new", AppName: "dashboard", Tags: []string{"scope:admin"}},
+		{Type: "import-repo", RepoURL: "https://github.com/acme/shop", AppName: "shop", Branch: "v2.1.0", Subdir: "packages/web"},
+		{Type: "create-lib", AppName: "ui", Buildable: true},
+		{Type: "import-lib", RepoURL: "https://github.com/acme/utils", AppName: "utils", Framework: "ts"},
+	}
+	if got := spec.Instructions(); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %+v; got %+v", want, got)
+	}
+	if spec.Name != "storefront" || spec.Template.Variables["npmScope"] != "acme" {
+		t.Errorf("expected the workspace name and variables; got %+v", spec)
+	}
+
+	jsonSpec := `{"apps": [{"name": "admin"}], "imports": [{"url": "https://example.com/x.git", "name": "legacy"}]}`
+	spec, err = ParseWorkspaceSpec("workspace.json", []byte(jsonSpec))
+	if err != nil {
+		t.Fatalf("error parsing JSON spec. Err: %v", err)
+	}
+	if len(spec.Instructions()) != 2 {
+		t.Errorf("expected 2 instructions; got %d", len(spec.Instructions()))
+	}
+
+	tests := []struct {
+		spec string
+		want string
+	}{
+		{"apps:\n  - name: a\n    port: 3000\n", "workspace.yaml:3: field port not found"},
+		{"apps:\n  - name: a\n  - tags: [x]\n", "workspace.yaml:3: apps[1]: name is required"},
+		{"apps:\n  - name: a\nimports:\n  - url: https://github.com/o/a\n", "workspace.yaml:4: imports[0]: app name \"a\" is already used by apps[0]"},
+		{"imports:\n  - name: a\n", "workspace.yaml:2: imports[0]: url is required"},
+		{"imports:\n  - url: https://example.com/\n", "workspace.yaml:2: imports[0]: name is required"},
+		{"imports:\n  - url: https://github.com/o/a\n    subdir: ../x\n", "workspace.yaml:3: imports[0]: subdir"},
+		{"template:\n  path: ./t\n  owner: o\n", "workspace.yaml:2: template: path cannot be combined"},
+		{"apps: {name: a}\n", "workspace.yaml:1: cannot unmarshal"},
+		{"libs:\n  - name: ui\n    framework: vue\n", "workspace.yaml:3: libs[0]: framework must be react or ts"},
+		{"libs:\n  - ref: v1\n", "workspace.yaml:2: libs[0]: ref and subdir require a url"},
+		{"apps:\n  - name: ui\nlibs:\n  - name: ui\n", "workspace.yaml:4: libs[0]: app name \"ui\" is already used by apps[0]"},
+	}
+	for _, tt := range tests {
+		_, err := ParseWorkspaceSpec("workspace.yaml", []byte(tt.spec))
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%q: expected an error containing %q; got %v", tt.spec, tt.want, err)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package utils
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// stagingDirRegex matches the staging directory names of StageWorkspace.
+var stagingDirRegex = regexp.MustCompile(`^\.(.+)\.partial-[0-9]+$`)
+
+// StagedWorkspace is a workspace built in a hidden directory next to its
+// destination. It is moved into place only once it is complete, so a failed
+// build leaves nothing behind at the destination.
+type StagedWorkspace struct {
+	Path string // Directory the workspace is built in
+	Dest string // Directory the workspace is moved to by Commit
+}
+
+// StageWorkspace creates the staging directory for a workspace at destPath.
+// destPath itself is not touched until Commit.
+func StageWorkspace(destPath string) (*StagedWorkspace, error) {
+	info, err := os.Stat(destPath)
+	if err == nil && !info.IsDir() {
+		return nil, fmt.Errorf("cannot create workspace at %s: a file with that name already exists", destPath)
+	}
+
+	parent := filepath.Dir(destPath)
+	err = os.MkdirAll(parent, 0755)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create directory %s: %w", parent, err)
+	}
+	return stageWorkspaceIn(parent, destPath)
+}
+
+// StageDryRun creates a staging directory for a workspace at destPath in the
+// system temporary directory, leaving destPath and its parent untouched.
+// It is meant to be discarded, not committed.
+func StageDryRun(destPath string) (*StagedWorkspace, error) {
+	return stageWorkspaceIn("", destPath)
+}
+
+func stageWorkspaceIn(dir, destPath string) (*StagedWorkspace, error) {
+	staging, err := os.MkdirTemp(dir, "."+filepath.Base(destPath)+".partial-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create staging directory: %w", err)
+	}
+	return &StagedWorkspace{Path: staging, Dest: destPath}, nil
+}
+
+// Commit moves the staged workspace to its destination. A new destination is
+// renamed into place in one step. An existing directory has the workspace
+// merged into it entry by entry, which is not atomic, so Commit first makes
+// sure no staged file would replace one already there and moves nothing if
+// one would.
+func (s *StagedWorkspace) Commit() error {
+	_, err := os.Lstat(s.Dest)
+	if os.IsNotExist(err) {
+		err = os.Chmod(s.Path, 0755) // MkdirTemp creates it private
+		if err != nil {
+			return fmt.Errorf("failed to move workspace into place: %w", err)
+		}
+		err = os.Rename(s.Path, s.Dest)
+		if err != nil {
+			return fmt.Errorf("failed to move workspace into place: %w", err)
+		}
+		return nil
+	}
+
+	collisions, err := stagedCollisions(s.Path, s.Dest)
+	if err != nil {
+		return fmt.Errorf("failed to check %s: %w", s.Dest, err)
+	}
+	if len(collisions) > 0 {
+		return fmt.Errorf("cannot create workspace in %s: %d paths already exist there, including %s", s.Dest, len(collisions), strings.Join(collisions[:min(len(collisions), 5)], ", "))
+	}
+
+	err = moveTree(s.Path, s.Dest)
+	if err != nil {
+		return fmt.Errorf("failed to move workspace into %s: %w", s.Dest, err)
+	}
+	return os.RemoveAll(s.Path)
+}
+
+// stagedCollisions returns the slash-separated paths of the staged workspace
+// at src that already exist at dst. Directories present in both are merged
+// rather than replaced, so only their contents count.
+func stagedCollisions(src, dst string) ([]string, error) {
+	var collisions []string
+	err := filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || path == src {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		info, err := os.Lstat(filepath.Join(dst, rel))
+		if os.IsNotExist(err) {
+			if d.IsDir() {
+				return filepath.SkipDir // Moved as a whole
+			}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && info.IsDir() {
+			return nil
+		}
+		collisions = append(collisions, filepath.ToSlash(rel))
+		if d.IsDir() {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	return collisions, err
+}
+
+// Discard removes the staged workspace.
+func (s *StagedWorkspace) Discard() error {
+	return os.RemoveAll(s.Path)
+}
+
+// workspaceDirName returns the name of the workspace directory path will
+// become: its base name, or that of the destination while it is staged.
+func workspaceDirName(path string) string {
+	name := filepath.Base(path)
+	if match := stagingDirRegex.FindStringSubmatch(name); match != nil {
+		return match[1]
+	}
+	return name
+}
@@ -0,0 +1,88 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestStageWorkspace(t *testing.T) {
+	parent := t.TempDir()
+
+	// A new workspace is renamed into place
+	dest := filepath.Join(parent, "store")
+	staged, err := StageWorkspace(dest)
+	if err != nil {
+		t.Fatalf("error staging workspace. Err: %v", err)
+	}
+	if _, err := os.Stat(dest); err == nil {
+		t.Errorf("expected %s not to exist before the commit", dest)
+	}
+	if name := workspaceDirName(staged.Path); name != "store" {
+		t.Errorf("expected the staged workspace to be named store; got %s", name)
+	}
+	os.WriteFile(filepath.Join(staged.Path, "nx.json"), []byte(`{}`), 0644)
+	if err := staged.Commit(); err != nil {
+		t.Fatalf("error committing workspace. Err: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dest, "nx.json")); err != nil {
+		t.Errorf("expected nx.json in the workspace. Err: %v", err)
+	}
+	if _, err := os.Stat(staged.Path); !os.IsNotExist(err) {
+		t.Errorf("expected the staging directory to be gone; got %v", err)
+	}
+
+	// An existing directory keeps its files
+	staged, err = StageWorkspace(dest)
+	if err != nil {
+		t.Fatalf("error staging workspace. Err: %v", err)
+	}
+	os.WriteFile(filepath.Join(staged.Path, "package.json"), []byte(`{}`), 0644)
+	if err := staged.Commit(); err != nil {
+		t.Fatalf("error committing workspace. Err: %v", err)
+	}
+	for _, file := range []string{"nx.json", "package.json"} {
+		if _, err := os.Stat(filepath.Join(dest, file)); err != nil {
+			t.Errorf("expected %s in the workspace. Err: %v", file, err)
+		}
+	}
+
+	// Nothing is moved when a staged file would replace an existing one
+	staged, err = StageWorkspace(dest)
+	if err != nil {
+		t.Fatalf("error staging workspace. Err: %v", err)
+	}
+	os.MkdirAll(filepath.Join(staged.Path, "apps", "web"), 0755)
+	os.WriteFile(filepath.Join(staged.Path, "apps", "web", "project.json"), []byte(`{}`), 0644)
+	os.WriteFile(filepath.Join(staged.Path, "nx.json"), []byte(`{"new": true}`), 0644)
+	err = staged.Commit()
+	if err == nil || !strings.Contains(err.Error(), "nx.json") {
+		t.Errorf("expected an error naming nx.json; got %v", err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dest, "nx.json")); string(data) != `{}` {
+		t.Errorf("expected nx.json to be kept; got %q", data)
+	}
+	if _, err := os.Stat(filepath.Join(dest, "apps")); !os.IsNotExist(err) {
+		t.Errorf("expected apps not to be moved; got %v", err)
+	}
+	staged.Discard()
+
+	// A discarded workspace leaves nothing behind
+	staged, err = StageWorkspace(filepath.Join(parent, "blog"))
+	if err != nil {
+		t.Fatalf("error staging workspace. Err: %v", err)
+	}
+	if err := staged.Discard(); err != nil {
+		t.Fatalf("error discarding workspace. Err: %v", err)
+	}
+	entries, _ := os.ReadDir(parent)
+	if len(entries) != 1 {
+		t.Errorf("expected only the store workspace to be left; got %d entries", len(entries))
+	}
+
+	os.WriteFile(filepath.Join(parent, "notes.txt"), nil, 0644)
+	if _, err := StageWorkspace(filepath.Join(parent, "notes.txt")); err == nil {
+		t.Errorf("expected an error for a destination that is a file")
+	}
+}
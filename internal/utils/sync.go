@@ -0,0 +1,385 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/google/go-github/v53/github"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// SyncManifestFile lists the shared files a workspace pulls from other repositories.
+	SyncManifestFile = "nx-scaffolder.sync.yaml"
+	// SyncLockFile records the blob SHA of every synced file.
+	SyncLockFile = "nx-scaffolder.sync.lock"
+)
+
+// SyncManifest is the contents of nx-scaffolder.sync.yaml.
+type SyncManifest struct {
+	Sources []SyncSource `yaml:"sources"`
+}
+
+// SyncSource is a file, directory or glob in a GitHub repository that is
+// kept in sync with a local directory.
+type SyncSource struct {
+	Repo string `yaml:"repo"` // owner/repo
+	Ref  string `yaml:"ref"`  // Branch, tag or commit SHA (default: the repository's default branch)
+	Path string `yaml:"path"` // File, directory or glob in the repository
+	// Dest is the local directory matched files are written to. Paths below
+	// the source directory (or the glob's leading directories) are kept.
+	// Defaults to the source directory, so files keep their repository paths.
+	Dest string `yaml:"dest"`
+}
+
+func (s SyncSource) String() string {
+	if s.Ref == "" {
+		return s.Repo + ":" + s.Path
+	}
+	return s.Repo + ":" + s.Path + "@" + s.Ref
+}
+
+// SyncLock is the contents of nx-scaffolder.sync.lock, keyed by the
+// slash-separated local path of each synced file.
+type SyncLock struct {
+	Files map[string]SyncLockEntry `json:"files"`
+}
+
+// SyncLockEntry records where a synced file came from.
+type SyncLockEntry struct {
+	Repo   string `json:"repo"`
+	Source string `json:"source"` // Path of the manifest source that matched the file
+	Path   string `json:"path"`   // Path in the repository
+	Ref    string `json:"ref,omitempty"`
+	Commit string `json:"commit"`
+	SHA    string `json:"sha"` // Git blob SHA of the content last written
+}
+
+// SyncState describes how a synced file differs from its upstream.
+type SyncState string
+
+const (
+	SyncUpToDate        SyncState = "up-to-date"
+	SyncNew             SyncState = "new"              // Upstream file not synced yet
+	SyncUpstreamChanged SyncState = "upstream-changed" // Only upstream changed
+	SyncLocalEdited     SyncState = "local-edited"     // Only the local copy changed
+	SyncDiverged        SyncState = "diverged"         // Both changed
+	SyncRemoved         SyncState = "removed-upstream" // Deleted upstream, local copy unchanged
+)
+
+// SyncFile is the outcome of syncing one file.
+type SyncFile struct {
+	Path    string // Slash-separated path relative to the workspace
+	Source  string
+	State   SyncState
+	Note    string
+	Updated bool // The local file was written or removed
+}
+
+// SyncOptions controls what Sync changes.
+type SyncOptions struct {
+	Check bool // Only report drift, without writing anything
+	Force bool // Overwrite local edits with the upstream version
+}
+
+// LoadSyncManifest reads nx-scaffolder.sync.yaml from the workspace root.
+func LoadSyncManifest(workspacePath string) (*SyncManifest, error) {
+	data, err := os.ReadFile(filepath.Join(workspacePath, SyncManifestFile))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", SyncManifestFile, err)
+	}
+
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+
+	var manifest SyncManifest
+	err = decoder.Decode(&manifest)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("invalid %s: %w", SyncManifestFile, err)
+	}
+
+	for i, source := range manifest.Sources {
+		owner, repo, ok := strings.Cut(source.Repo, "/")
+		if !ok || owner == "" || repo == "" || strings.Contains(repo, "/") {
+			return nil, fmt.Errorf("invalid %s: source %d: repo %q must be owner/repo", SyncManifestFile, i+1, source.Repo)
+		}
+		if strings.Trim(source.Path, "/") == "" {
+			return nil, fmt.Errorf("invalid %s: source %d has no path", SyncManifestFile, i+1)
+		}
+		if source.Dest != "" && source.Dest != "." {
+			if reason := unsafeManifestPath(source.Dest); reason != "" {
+				return nil, fmt.Errorf("invalid %s: source %d dest %q: %s", SyncManifestFile, i+1, source.Dest, reason)
+			}
+		}
+	}
+	return &manifest, nil
+}
+
+// Sync brings the files listed in the workspace's sync manifest up to date.
+// Files changed only upstream are updated; local edits are reported and
+// kept unless opts.Force is set. The lock file is rewritten afterwards,
+// dropping files whose source was removed from the manifest.
+func Sync(ctx context.Context, workspacePath string, opts SyncOptions) ([]SyncFile, error) {
+	manifest, err := LoadSyncManifest(workspacePath)
+	if err != nil {
+		return nil, err
+	}
+
+	session := defaultGitHubSession()
+	results, err := syncWorkspace(ctx, session.api, workspacePath, manifest, opts)
+	if err != nil {
+		return nil, explainGitHubError(err, session.cred)
+	}
+	return results, nil
+}
+
+func syncWorkspace(ctx context.Context, client *github.Client, workspacePath string, manifest *SyncManifest, opts SyncOptions) ([]SyncFile, error) {
+	lock, err := loadSyncLock(workspacePath)
+	if err != nil {
+		return nil, err
+	}
+
+	updated := &SyncLock{Files: make(map[string]SyncLockEntry)}
+	claimed := make(map[string]string)
+	var results []SyncFile
+
+	for _, source := range manifest.Sources {
+		owner, repo, _ := strings.Cut(source.Repo, "/")
+		commit, files, err := listGitHubFiles(ctx, client, owner, repo, source.Ref, source.Path)
+		if err != nil {
+			return nil, err
+		}
+
+		base := syncBase(source.Path, files)
+		dest := source.Dest
+		if dest == "" {
+			dest = base
+		}
+
+		seen := make(map[string]bool)
+		for _, file := range files {
+			relPath := path.Join(dest, strings.TrimPrefix(file.Path, base+"/"))
+			if other, ok := claimed[relPath]; ok {
+				return nil, fmt.Errorf("%s is synced by both %s and %s", relPath, other, source)
+			}
+			claimed[relPath] = source.String()
+			seen[relPath] = true
+
+			next := SyncLockEntry{Repo: source.Repo, Source: source.Path, Path: file.Path, Ref: source.Ref, Commit: commit, SHA: file.SHA}
+			entry, locked := lock.Files[relPath]
+			result, err := syncState(workspacePath, relPath, file.SHA, entry, locked)
+			if err != nil {
+				return nil, err
+			}
+			result.Source = source.String()
+
+			write := result.State == SyncNew || result.State == SyncUpstreamChanged ||
+				(opts.Force && (result.State == SyncLocalEdited || result.State == SyncDiverged))
+			switch {
+			case write && !opts.Check:
+				_, err := writeRemoteFile(ctx, client, owner, repo, file, workspacePath, relPath)
+				if err != nil {
+					return nil, err
+				}
+				result.Updated = true
+				updated.Files[relPath] = next
+			case result.State == SyncUpToDate:
+				updated.Files[relPath] = next
+			case locked:
+				// Keep the last synced SHA so the drift is reported again
+				updated.Files[relPath] = entry
+			}
+			results = append(results, result)
+		}
+
+		// Files that no longer exist upstream
+		for relPath, entry := range lock.Files {
+			if entry.Repo != source.Repo || entry.Source != source.Path || seen[relPath] {
+				continue
+			}
+			if _, ok := claimed[relPath]; ok {
+				continue
+			}
+			result, err := syncRemoval(workspacePath, relPath, entry, opts)
+			if err != nil {
+				return nil, err
+			}
+			result.Source = source.String()
+			if !result.Updated {
+				updated.Files[relPath] = entry
+			}
+			results = append(results, result)
+		}
+	}
+
+	sort.Slice(results, func(i, j int) bool { return results[i].Path < results[j].Path })
+	if opts.Check {
+		return results, nil
+	}
+	return results, writeSyncLock(workspacePath, updated)
+}
+
+// syncState compares a local file with its lock entry and its upstream blob.
+func syncState(workspacePath, relPath, upstreamSHA string, entry SyncLockEntry, locked bool) (SyncFile, error) {
+	result := SyncFile{Path: relPath}
+	if reason := unsafeEntryName(relPath); reason != "" {
+		return result, fmt.Errorf("refusing to sync %s: %s", relPath, reason)
+	}
+
+	localSHA, exists, err := localBlobSHA(filepath.Join(workspacePath, filepath.FromSlash(relPath)))
+	if err != nil {
+		return result, err
+	}
+
+	switch {
+	case exists && localSHA == upstreamSHA:
+		result.State = SyncUpToDate
+	case !locked && !exists:
+		result.State = SyncNew
+	case !locked:
+		result.State = SyncDiverged
+		result.Note = "local file is not tracked"
+	default:
+		upstreamChanged := entry.SHA != upstreamSHA
+		localEdited := !exists || localSHA != entry.SHA
+		switch {
+		case upstreamChanged && localEdited:
+			result.State = SyncDiverged
+		case localEdited:
+			result.State = SyncLocalEdited
+		default:
+			result.State = SyncUpstreamChanged
+		}
+		if !exists {
+			result.Note = "deleted locally"
+		}
+	}
+	return result, nil
+}
+
+// syncRemoval handles a locked file that its source no longer matches. The
+// local copy is removed unless it was edited.
+func syncRemoval(workspacePath, relPath string, entry SyncLockEntry, opts SyncOptions) (SyncFile, error) {
+	result := SyncFile{Path: relPath, State: SyncRemoved}
+	if reason := unsafeEntryName(relPath); reason != "" {
+		return result, fmt.Errorf("refusing to sync %s: %s", relPath, reason)
+	}
+
+	localPath := filepath.Join(workspacePath, filepath.FromSlash(relPath))
+	localSHA, exists, err := localBlobSHA(localPath)
+	if err != nil {
+		return result, err
+	}
+	if exists && localSHA != entry.SHA {
+		result.State = SyncDiverged
+		result.Note = "removed upstream but edited locally"
+		if !opts.Force {
+			return result, nil
+		}
+	}
+	if opts.Check {
+		return result, nil
+	}
+
+	if exists {
+		if err := os.Remove(localPath); err != nil {
+			return result, fmt.Errorf("failed to remove %s: %w", relPath, err)
+		}
+	}
+	result.Updated = true
+	return result, nil
+}
+
+// syncBase returns the repository directory that files matched by pattern
+// are placed relative to: the directory itself, the parent of a single
+// file, or the leading directories of a glob. "." is the repository root.
+func syncBase(pattern string, files []RemoteFile) string {
+	pattern = strings.Trim(filepath.ToSlash(pattern), "/")
+	if strings.ContainsAny(pattern, "*?[") {
+		if prefix := literalPrefix(pattern); prefix != "" {
+			return prefix
+		}
+		return "."
+	}
+	if len(files) == 1 && files[0].Path == pattern {
+		return path.Dir(pattern)
+	}
+	return pattern
+}
+
+// localBlobSHA returns the git blob SHA of a local file, as git hash-object
+// would compute it. Symlinks hash their target like git stores them.
+func localBlobSHA(localPath string) (string, bool, error) {
+	info, err := os.Lstat(localPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+
+	var content []byte
+	switch {
+	case info.Mode()&os.ModeSymlink != 0:
+		target, err := os.Readlink(localPath)
+		if err != nil {
+			return "", false, err
+		}
+		content = []byte(target)
+	case info.Mode().IsRegular():
+		content, err = os.ReadFile(localPath)
+		if err != nil {
+			return "", false, err
+		}
+	default:
+		return "", false, fmt.Errorf("%s is not a regular file", localPath)
+	}
+	return gitBlobSHA(content), true, nil
+}
+
+// gitBlobSHA hashes content the way git hashes a blob object.
+func gitBlobSHA(content []byte) string {
+	h := sha1.New()
+	fmt.Fprintf(h, "blob %d\x00", len(content))
+	h.Write(content)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func loadSyncLock(workspacePath string) (*SyncLock, error) {
+	lock := &SyncLock{Files: make(map[string]SyncLockEntry)}
+	data, err := os.ReadFile(filepath.Join(workspacePath, SyncLockFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return lock, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", SyncLockFile, err)
+	}
+
+	err = json.Unmarshal(data, lock)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", SyncLockFile, err)
+	}
+	if lock.Files == nil {
+		lock.Files = make(map[string]SyncLockEntry)
+	}
+	return lock, nil
+}
+
+func writeSyncLock(workspacePath string, lock *SyncLock) error {
+	data, err := json.MarshalIndent(lock, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(workspacePath, SyncLockFile), append(data, '\n'), 0644)
+}
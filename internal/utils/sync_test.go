@@ -0,0 +1,108 @@
+package utils
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSyncWorkspace(t *testing.T) {
+	upstream := map[string]string{
+		".github/workflows/ci.yml":      "ci",
+		".github/workflows/release.yml": "release",
+		".github/workflows/lint.yml":    "lint",
+		"tools/eslint/base.json":        "{}",
+	}
+	client := newFakeGitHub(t, upstream)
+	manifest := &SyncManifest{Sources: []SyncSource{
+		{Repo: "o/r", Path: ".github/workflows", Dest: "ci"},
+		{Repo: "o/r", Path: "tools/eslint/base.json"},
+	}}
+	workspace := t.TempDir()
+	ctx := context.Background()
+
+	sync := func(opts SyncOptions) map[string]SyncFile {
+		t.Helper()
+		results, err := syncWorkspace(ctx, client, workspace, manifest, opts)
+		if err != nil {
+			t.Fatalf("error syncing. Err: %v", err)
+		}
+		states := make(map[string]SyncFile)
+		for _, result := range results {
+			states[result.Path] = result
+		}
+		return states
+	}
+	expectState := func(states map[string]SyncFile, path string, want SyncState, updated bool) {
+		t.Helper()
+		if got := states[path]; got.State != want || got.Updated != updated {
+			t.Errorf("%s: expected %s (updated %v); got %s (updated %v)", path, want, updated, got.State, got.Updated)
+		}
+	}
+	readLocal := func(path string) string {
+		t.Helper()
+		data, _ := os.ReadFile(filepath.Join(workspace, filepath.FromSlash(path)))
+		return string(data)
+	}
+
+	states := sync(SyncOptions{})
+	expectState(states, "ci/ci.yml", SyncNew, true)
+	expectState(states, "tools/eslint/base.json", SyncNew, true)
+	if readLocal("ci/release.yml") != "release" {
+		t.Errorf("expected ci/release.yml to be written")
+	}
+	if _, err := os.Stat(filepath.Join(workspace, SyncLockFile)); err != nil {
+		t.Fatalf("expected a lock file; got %v", err)
+	}
+
+	// Change upstream, edit locally and do both
+	upstream[".github/workflows/ci.yml"] = "ci v2"
+	upstream["tools/eslint/base.json"] = `{"root":true}`
+	delete(upstream, ".github/workflows/lint.yml")
+	os.WriteFile(filepath.Join(workspace, "ci", "release.yml"), []byte("release (local)"), 0644)
+	os.WriteFile(filepath.Join(workspace, "tools", "eslint", "base.json"), []byte(`{"local":true}`), 0644)
+
+	states = sync(SyncOptions{Check: true})
+	expectState(states, "ci/ci.yml", SyncUpstreamChanged, false)
+	expectState(states, "ci/release.yml", SyncLocalEdited, false)
+	expectState(states, "ci/lint.yml", SyncRemoved, false)
+	expectState(states, "tools/eslint/base.json", SyncDiverged, false)
+	if readLocal("ci/ci.yml") != "ci" {
+		t.Errorf("expected --check to leave files untouched")
+	}
+
+	states = sync(SyncOptions{})
+	expectState(states, "ci/ci.yml", SyncUpstreamChanged, true)
+	expectState(states, "ci/release.yml", SyncLocalEdited, false)
+	expectState(states, "ci/lint.yml", SyncRemoved, true)
+	expectState(states, "tools/eslint/base.json", SyncDiverged, false)
+	if readLocal("ci/ci.yml") != "ci v2" || readLocal("ci/release.yml") != "release (local)" {
+		t.Errorf("expected only upstream changes to be applied")
+	}
+	if _, err := os.Stat(filepath.Join(workspace, "ci", "lint.yml")); !os.IsNotExist(err) {
+		t.Errorf("expected ci/lint.yml to be removed; got %v", err)
+	}
+
+	// Drift is reported until it is resolved
+	states = sync(SyncOptions{})
+	expectState(states, "ci/ci.yml", SyncUpToDate, false)
+	expectState(states, "tools/eslint/base.json", SyncDiverged, false)
+
+	states = sync(SyncOptions{Force: true})
+	expectState(states, "ci/release.yml", SyncLocalEdited, true)
+	expectState(states, "tools/eslint/base.json", SyncDiverged, true)
+	if readLocal("tools/eslint/base.json") != `{"root":true}` || readLocal("ci/release.yml") != "release" {
+		t.Errorf("expected --force to restore the upstream versions")
+	}
+}
+
+func TestGitBlobSHA(t *testing.T) {
+	// git hash-object of an empty file and of "hello\n"
+	if got := gitBlobSHA(nil); got != "e69de29bb2d1d6434b8b29ae775ad8c2e48c5391" {
+		t.Errorf("expected the empty blob SHA; got %s", got)
+	}
+	if got := gitBlobSHA([]byte("hello\n")); got != "ce013625030ba8dba906f756967f9e9ca394464a" {
+		t.Errorf("expected the SHA of hello; got %s", got)
+	}
+}